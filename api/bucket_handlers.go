@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bonearadu/kvstore/kv_store"
+)
+
+// handleListBuckets handles GET requests to list all buckets
+func (h *Handler) handleListBuckets(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.buckets.Names())
+}
+
+// handleCreateBucket handles PUT requests to create a bucket
+func (h *Handler) handleCreateBucket(w http.ResponseWriter, r *http.Request) {
+	created, err := h.buckets.Create(r.PathValue("bucket"))
+	switch {
+	case errors.Is(err, kv_store.ErrInvalidBucketName):
+		http.Error(w, "Invalid bucket name", http.StatusBadRequest)
+		return
+	case errors.Is(err, kv_store.ErrBucketsUnsupported):
+		http.Error(w, "Store does not support buckets", http.StatusNotImplemented)
+		return
+	case err != nil:
+		http.Error(w, "Failed to create bucket", http.StatusInternalServerError)
+		return
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleDeleteBucket handles DELETE requests to delete a bucket and all its keys
+func (h *Handler) handleDeleteBucket(w http.ResponseWriter, r *http.Request) {
+	err := h.buckets.Delete(r.PathValue("bucket"))
+	switch {
+	case errors.Is(err, kv_store.ErrBucketNotFound):
+		http.Error(w, "Bucket not found", http.StatusNotFound)
+		return
+	case errors.Is(err, kv_store.ErrDefaultBucket):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Failed to delete bucket", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
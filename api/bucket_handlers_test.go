@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bonearadu/kvstore/kv_store"
+)
+
+// TestBucketRoutes tests the bucket endpoints against in-memory stores
+func TestBucketRoutes(t *testing.T) {
+	buckets := kv_store.NewBuckets(kv_store.NewInMemoryStore(), func(string) (kv_store.KeyValueStore, error) {
+		return kv_store.NewInMemoryStore(), nil
+	})
+	handler := NewBucketHandler(buckets)
+
+	// The requests run in order and build on each other
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"create bucket", "PUT", "/buckets/users", "", http.StatusCreated, ""},
+		{"create existing bucket", "PUT", "/buckets/users", "", http.StatusOK, ""},
+		{"create invalid bucket", "PUT", "/buckets/a.b", "", http.StatusBadRequest, ""},
+		{"list buckets", "GET", "/buckets", "", http.StatusOK, `["default","users"]`},
+
+		{"put default key", "PUT", "/keys/name", "default", http.StatusCreated, ""},
+		{"put bucket key", "PUT", "/buckets/users/keys/name", "users", http.StatusCreated, ""},
+		{"get default key", "GET", "/keys/name", "", http.StatusOK, "default"},
+		{"get bucket key", "GET", "/buckets/users/keys/name", "", http.StatusOK, "users"},
+		{"get default key by name", "GET", "/buckets/default/keys/name", "", http.StatusOK, "default"},
+		{"list bucket entries", "GET", "/buckets/users/keys", "", http.StatusOK, `[{"Key":"name","Value":"users"}]`},
+		{"bucket counter", "POST", "/buckets/users/keys/n/incr", "", http.StatusOK, "1"},
+		{"missing bucket", "GET", "/buckets/nope/keys/name", "", http.StatusNotFound, ""},
+
+		{"delete default bucket", "DELETE", "/buckets/default", "", http.StatusBadRequest, ""},
+		{"delete bucket", "DELETE", "/buckets/users", "", http.StatusOK, ""},
+		{"delete missing bucket", "DELETE", "/buckets/users", "", http.StatusNotFound, ""},
+		{"get deleted bucket key", "GET", "/buckets/users/keys/name", "", http.StatusNotFound, ""},
+		{"default key survives", "GET", "/keys/name", "", http.StatusOK, "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("handler returned wrong body: got %v want %v",
+					rr.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestBucketRoutesUnsupported tests that handlers created for a single store
+// cannot create buckets
+func TestBucketRoutesUnsupported(t *testing.T) {
+	handler := NewHandler(&MockStore{})
+
+	req := httptest.NewRequest("PUT", "/buckets/users", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rr.Code, http.StatusNotImplemented)
+	}
+}
@@ -0,0 +1,338 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bonearadu/kvstore/kv_store"
+)
+
+// collectionStore returns the store as a CollectionStore, writing an error
+// response if it does not support collection values. Wrapped stores are not
+// unwrapped, as collection writes would bypass their indexes, versions and quotas.
+func collectionStore(w http.ResponseWriter, store kv_store.KeyValueStore) (kv_store.CollectionStore, bool) {
+	cs, ok := store.(kv_store.CollectionStore)
+	if !ok {
+		http.Error(w, "Store does not support collections", http.StatusNotImplemented)
+	}
+	return cs, ok
+}
+
+// writeCollectionError maps errors from collection operations to HTTP responses
+func writeCollectionError(w http.ResponseWriter, err error) {
+	if writeLimitError(w, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, kv_store.ErrCollectionsUnsupported):
+		http.Error(w, "Store does not support collections", http.StatusNotImplemented)
+	case errors.Is(err, kv_store.ErrWrongType):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, kv_store.ErrKeyNotFound):
+		http.Error(w, "Key not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to access collection", http.StatusInternalServerError)
+	}
+}
+
+// writeJSON marshals v and writes it as a JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// writeText writes s as a plain text response
+func writeText(w http.ResponseWriter, s string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(s))
+}
+
+// readJSON decodes the request body into v, writing an error response on failure
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, ok := readBody(w, r)
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		http.Error(w, "Invalid JSON request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// parseRange extracts the "start" and "stop" query parameters, defaulting to
+// the whole collection
+func parseRange(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	bounds := [2]int{0, -1}
+	for i, name := range []string{"start", "stop"} {
+		if param := r.URL.Query().Get(name); param != "" {
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return 0, 0, false
+			}
+			bounds[i] = n
+		}
+	}
+	return bounds[0], bounds[1], true
+}
+
+// handleKeyType handles GET requests for the type of the value held by a key
+func (h *Handler) handleKeyType(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	cs, ok := collectionStore(w, store)
+	if !ok {
+		return
+	}
+
+	writeText(w, string(cs.Type(r.PathValue("key"))))
+}
+
+// handlePush returns a handler for POST requests that push the values in a
+// JSON array request body onto a list
+func (h *Handler) handlePush(left bool) storeHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+		cs, ok := collectionStore(w, store)
+		if !ok {
+			return
+		}
+
+		var values []string
+		if !readJSON(w, r, &values) {
+			return
+		}
+
+		push := cs.RPush
+		if left {
+			push = cs.LPush
+		}
+		n, err := push(r.PathValue("key"), values...)
+		if err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+		writeText(w, strconv.Itoa(n))
+	}
+}
+
+// handlePop returns a handler for POST requests that pop an element from a list
+func (h *Handler) handlePop(left bool) storeHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+		cs, ok := collectionStore(w, store)
+		if !ok {
+			return
+		}
+
+		pop := cs.RPop
+		if left {
+			pop = cs.LPop
+		}
+		value, err := pop(r.PathValue("key"))
+		if err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+		writeText(w, value)
+	}
+}
+
+// handleListRange handles GET requests for a range of elements of a list
+func (h *Handler) handleListRange(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	cs, ok := collectionStore(w, store)
+	if !ok {
+		return
+	}
+
+	start, stop, ok := parseRange(w, r)
+	if !ok {
+		return
+	}
+
+	values, err := cs.LRange(r.PathValue("key"), start, stop)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	writeJSON(w, values)
+}
+
+// handleSetAdd handles POST requests that add the members in a JSON array
+// request body to a set
+func (h *Handler) handleSetAdd(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	h.handleMembers(w, r, store, func(cs kv_store.CollectionStore, key string, members []string) (int, error) {
+		return cs.SAdd(key, members...)
+	})
+}
+
+// handleSetRemove handles POST requests that remove the members in a JSON
+// array request body from a set
+func (h *Handler) handleSetRemove(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	h.handleMembers(w, r, store, func(cs kv_store.CollectionStore, key string, members []string) (int, error) {
+		return cs.SRem(key, members...)
+	})
+}
+
+// handleSortedSetRemove handles POST requests that remove the members in a
+// JSON array request body from a sorted set
+func (h *Handler) handleSortedSetRemove(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	h.handleMembers(w, r, store, func(cs kv_store.CollectionStore, key string, members []string) (int, error) {
+		return cs.ZRem(key, members...)
+	})
+}
+
+// handleMembers applies op to the members in a JSON array request body and
+// writes the resulting count
+func (h *Handler) handleMembers(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore,
+	op func(cs kv_store.CollectionStore, key string, members []string) (int, error)) {
+	cs, ok := collectionStore(w, store)
+	if !ok {
+		return
+	}
+
+	var members []string
+	if !readJSON(w, r, &members) {
+		return
+	}
+
+	n, err := op(cs, r.PathValue("key"), members)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	writeText(w, strconv.Itoa(n))
+}
+
+// handleSetMembers handles GET requests for the members of a set
+func (h *Handler) handleSetMembers(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	cs, ok := collectionStore(w, store)
+	if !ok {
+		return
+	}
+
+	members, err := cs.SMembers(r.PathValue("key"))
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	writeJSON(w, members)
+}
+
+// handleHashGetAll handles GET requests for all fields of a hash
+func (h *Handler) handleHashGetAll(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	cs, ok := collectionStore(w, store)
+	if !ok {
+		return
+	}
+
+	fields, err := cs.HGetAll(r.PathValue("key"))
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	writeJSON(w, fields)
+}
+
+// handleHashGet handles GET requests for a field of a hash
+func (h *Handler) handleHashGet(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	cs, ok := collectionStore(w, store)
+	if !ok {
+		return
+	}
+
+	value, err := cs.HGet(r.PathValue("key"), r.PathValue("field"))
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	writeText(w, value)
+}
+
+// handleHashSet handles PUT requests to create or update a field of a hash
+func (h *Handler) handleHashSet(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	cs, ok := collectionStore(w, store)
+	if !ok {
+		return
+	}
+
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	created, err := cs.HSet(r.PathValue("key"), r.PathValue("field"), string(body))
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleHashDelete handles DELETE requests for a field of a hash
+func (h *Handler) handleHashDelete(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	cs, ok := collectionStore(w, store)
+	if !ok {
+		return
+	}
+
+	if _, err := cs.HDel(r.PathValue("key"), r.PathValue("field")); err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleSortedSetAdd handles POST requests that add the members of a JSON
+// object request body, mapping members to scores, to a sorted set
+func (h *Handler) handleSortedSetAdd(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	cs, ok := collectionStore(w, store)
+	if !ok {
+		return
+	}
+
+	var members map[string]float64
+	if !readJSON(w, r, &members) {
+		return
+	}
+
+	n, err := cs.ZAdd(r.PathValue("key"), members)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	writeText(w, strconv.Itoa(n))
+}
+
+// handleSortedSetRange handles GET requests for a range of members of a sorted set
+func (h *Handler) handleSortedSetRange(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	cs, ok := collectionStore(w, store)
+	if !ok {
+		return
+	}
+
+	start, stop, ok := parseRange(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := cs.ZRange(r.PathValue("key"), start, stop)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	writeJSON(w, members)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bonearadu/kvstore/kv_store"
+)
+
+// TestCollectionRoutes tests the collection endpoints against an in-memory store
+func TestCollectionRoutes(t *testing.T) {
+	store := kv_store.NewInMemoryStore()
+	store.Put("text", "value")
+
+	handler := NewHandler(store)
+
+	// The requests run in order and build on each other
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"rpush", "POST", "/keys/list/rpush", `["b","c"]`, http.StatusOK, "2"},
+		{"lpush", "POST", "/keys/list/lpush", `["a"]`, http.StatusOK, "3"},
+		{"lrange", "GET", "/keys/list/lrange?start=0&stop=-1", "", http.StatusOK, `["a","b","c"]`},
+		{"rpop", "POST", "/keys/list/rpop", "", http.StatusOK, "c"},
+		{"lpop", "POST", "/keys/list/lpop", "", http.StatusOK, "a"},
+		{"type of list", "GET", "/keys/list/type", "", http.StatusOK, "list"},
+		{"pop missing list", "POST", "/keys/nolist/lpop", "", http.StatusNotFound, ""},
+		{"invalid push body", "POST", "/keys/list/rpush", `"a"`, http.StatusBadRequest, ""},
+		{"invalid range", "GET", "/keys/list/lrange?start=x", "", http.StatusBadRequest, ""},
+
+		{"sadd", "POST", "/keys/set/sadd", `["x","y","x"]`, http.StatusOK, "2"},
+		{"srem", "POST", "/keys/set/srem", `["y","z"]`, http.StatusOK, "1"},
+		{"smembers", "GET", "/keys/set/smembers", "", http.StatusOK, `["x"]`},
+
+		{"hset new field", "PUT", "/keys/hash/hash/name", "ada", http.StatusCreated, ""},
+		{"hset existing field", "PUT", "/keys/hash/hash/name", "grace", http.StatusOK, ""},
+		{"hget", "GET", "/keys/hash/hash/name", "", http.StatusOK, "grace"},
+		{"hgetall", "GET", "/keys/hash/hash", "", http.StatusOK, `{"name":"grace"}`},
+		{"hget missing field", "GET", "/keys/hash/hash/role", "", http.StatusNotFound, ""},
+		{"hdel", "DELETE", "/keys/hash/hash/name", "", http.StatusOK, ""},
+
+		{"zadd", "POST", "/keys/zset/zadd", `{"a":2,"b":1}`, http.StatusOK, "2"},
+		{"zrange", "GET", "/keys/zset/zrange", "", http.StatusOK, `[{"member":"b","score":1},{"member":"a","score":2}]`},
+		{"zrem", "POST", "/keys/zset/zrem", `["b"]`, http.StatusOK, "1"},
+
+		{"wrong type collection op", "POST", "/keys/text/sadd", `["a"]`, http.StatusConflict, ""},
+		{"wrong type string op", "GET", "/keys/set", "", http.StatusConflict, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("handler returned wrong body: got %v want %v",
+					rr.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestCollectionRoutesIndexedStore tests that collections are not supported
+// by wrappers that do not implement them, even around an in-memory store
+func TestCollectionRoutesIndexedStore(t *testing.T) {
+	handler := NewHandler(kv_store.NewIndexedStore(kv_store.NewInMemoryStore()))
+
+	req := httptest.NewRequest("POST", "/keys/list/rpush", strings.NewReader(`["a"]`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rr.Code, http.StatusNotImplemented)
+	}
+}
+
+// TestCollectionRoutesQuotaStore tests that collection writes are subject to
+// the quotas of a quota store
+func TestCollectionRoutesQuotaStore(t *testing.T) {
+	store, err := kv_store.NewQuotaStore(kv_store.NewInMemoryStore(), kv_store.Limits{MaxTotalBytes: 10})
+	if err != nil {
+		t.Fatalf("Failed to create quota store: %v", err)
+	}
+	handler := NewHandler(store)
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{"write within quota", `["ab"]`, http.StatusOK},
+		{"write over quota", `["abcdef"]`, http.StatusInsufficientStorage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/keys/list/rpush", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedCode)
+			}
+		})
+	}
+}
+
+// TestCollectionRoutesUnsupportedStore tests that stores without collection
+// support are reported as such
+func TestCollectionRoutesUnsupportedStore(t *testing.T) {
+	handler := NewHandler(&MockStore{})
+
+	req := httptest.NewRequest("GET", "/keys/mykey/smembers", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rr.Code, http.StatusNotImplemented)
+	}
+}
@@ -2,24 +2,52 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/bonearadu/kvstore/document"
 	"github.com/bonearadu/kvstore/kv_store"
 )
 
 // Handler handles HTTP requests for the key-value store
 type Handler struct {
-	store kv_store.KeyValueStore
-	mux   *http.ServeMux
+	buckets     *kv_store.Buckets
+	mux         *http.ServeMux
+	maxBodySize int64
 }
 
-// NewHandler creates a new Handler with the given store
+// Option configures a Handler
+type Option func(h *Handler)
+
+// WithMaxBodySize limits the size of request bodies. Larger requests are
+// rejected with 413 Request Entity Too Large.
+func WithMaxBodySize(n int64) Option {
+	return func(h *Handler) {
+		h.maxBodySize = n
+	}
+}
+
+// storeHandlerFunc handles a request against the store of the bucket it addresses
+type storeHandlerFunc func(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore)
+
+// NewHandler creates a new Handler with the given store as the only bucket
 func NewHandler(store kv_store.KeyValueStore) *Handler {
+	return NewBucketHandler(kv_store.NewBuckets(store, nil))
+}
+
+// NewBucketHandler creates a new Handler serving the given buckets
+func NewBucketHandler(buckets *kv_store.Buckets, opts ...Option) *Handler {
 	h := &Handler{
-		store: store,
-		mux:   http.NewServeMux(),
+		buckets: buckets,
+		mux:     http.NewServeMux(),
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
 
 	// Register routes
@@ -30,17 +58,114 @@ func NewHandler(store kv_store.KeyValueStore) *Handler {
 
 // registerRoutes sets up all the routes for the API
 func (h *Handler) registerRoutes() {
+	// GET /buckets - List all buckets
+	h.mux.HandleFunc("GET /buckets", h.handleListBuckets)
+
+	// PUT /buckets/{bucket} - Create a bucket
+	h.mux.HandleFunc("PUT /buckets/{bucket}", h.handleCreateBucket)
+
+	// DELETE /buckets/{bucket} - Delete a bucket and all its keys
+	h.mux.HandleFunc("DELETE /buckets/{bucket}", h.handleDeleteBucket)
+
+	// The routes below are served for the default bucket at the root, e.g. /keys,
+	// and for any bucket under /buckets/{bucket}, e.g. /buckets/{bucket}/keys
+
 	// GET /keys - List all entries (key-value pairs)
-	h.mux.HandleFunc("GET /keys", h.handleListEntries)
+	h.handleKeys("GET /keys", h.handleListEntries)
 
 	// GET /keys/{key} - Get a specific key
-	h.mux.HandleFunc("GET /keys/", h.handleGetKey)
+	h.handleKeys("GET /keys/", h.handleGetKey)
 
 	// PUT /keys/{key} - Create or update a key
-	h.mux.HandleFunc("PUT /keys/", h.handlePutKey)
+	h.handleKeys("PUT /keys/", h.handlePutKey)
 
 	// DELETE /keys/{key} - Delete a specific key
-	h.mux.HandleFunc("DELETE /keys/", h.handleDeleteKey)
+	h.handleKeys("DELETE /keys/", h.handleDeleteKey)
+
+	// PATCH /keys/{key} - Partially update a key
+	h.handleKeys("PATCH /keys/", h.handlePatchKey)
+
+	// The routes below take precedence over the ones above for a key followed by
+	// one of their suffixes, e.g. /keys/a/history. A key containing a slash must
+	// escape it as %2F to be addressed as a whole, e.g. /keys/a%2Fhistory: the
+	// routes match the escaped path segment by segment, and the key is unescaped
+
+	// GET /keys/{key}/history - List the retained versions of a key
+	h.handleKeys("GET /keys/{key}/history", h.handleKeyHistory)
+
+	// POST /keys/{key}/revert - Restore a key to an older version
+	h.handleKeys("POST /keys/{key}/revert", h.handleRevertKey)
+
+	// POST /keys/{key}/incr - Atomically increment an integer value
+	h.handleKeys("POST /keys/{key}/incr", h.handleIncrementKey)
+
+	// POST /keys/{key}/decr - Atomically decrement an integer value
+	h.handleKeys("POST /keys/{key}/decr", h.handleDecrementKey)
+
+	// GET /keys/{key}/type - Get the type of the value held by a key
+	h.handleKeys("GET /keys/{key}/type", h.handleKeyType)
+
+	// Lists
+	h.handleKeys("POST /keys/{key}/lpush", h.handlePush(true))
+	h.handleKeys("POST /keys/{key}/rpush", h.handlePush(false))
+	h.handleKeys("POST /keys/{key}/lpop", h.handlePop(true))
+	h.handleKeys("POST /keys/{key}/rpop", h.handlePop(false))
+	h.handleKeys("GET /keys/{key}/lrange", h.handleListRange)
+
+	// Sets
+	h.handleKeys("POST /keys/{key}/sadd", h.handleSetAdd)
+	h.handleKeys("POST /keys/{key}/srem", h.handleSetRemove)
+	h.handleKeys("GET /keys/{key}/smembers", h.handleSetMembers)
+
+	// Hashes
+	h.handleKeys("GET /keys/{key}/hash", h.handleHashGetAll)
+	h.handleKeys("GET /keys/{key}/hash/{field}", h.handleHashGet)
+	h.handleKeys("PUT /keys/{key}/hash/{field}", h.handleHashSet)
+	h.handleKeys("DELETE /keys/{key}/hash/{field}", h.handleHashDelete)
+
+	// Sorted sets
+	h.handleKeys("POST /keys/{key}/zadd", h.handleSortedSetAdd)
+	h.handleKeys("POST /keys/{key}/zrem", h.handleSortedSetRemove)
+	h.handleKeys("GET /keys/{key}/zrange", h.handleSortedSetRange)
+
+	// Secondary indexes
+	h.handleKeys("GET /index", h.handleListIndexes)
+	h.handleKeys("GET /index/{name}", h.handleQueryIndex)
+	h.handleKeys("PUT /index/{name}", h.handleCreateIndex)
+	h.handleKeys("DELETE /index/{name}", h.handleDeleteIndex)
+
+	// GET /stats - Get statistics about the store's internals
+	h.handleKeys("GET /stats", h.handleStats)
+}
+
+// handleKeys registers a "METHOD /path" pattern for the default bucket, and
+// the same pattern under /buckets/{bucket} for the named buckets
+func (h *Handler) handleKeys(pattern string, handler storeHandlerFunc) {
+	method, path, _ := strings.Cut(pattern, " ")
+	h.mux.HandleFunc(pattern, h.withBucket(handler))
+	h.mux.HandleFunc(method+" /buckets/{bucket}"+path, h.withBucket(handler))
+}
+
+// withBucket resolves the store of the bucket addressed by the request,
+// defaulting to the default bucket, and passes it to handler
+func (h *Handler) withBucket(handler storeHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := r.PathValue("bucket")
+		if bucket == "" {
+			bucket = kv_store.DefaultBucket
+		}
+
+		store, err := h.buckets.Get(bucket)
+		if err != nil {
+			http.Error(w, "Bucket not found", http.StatusNotFound)
+			return
+		}
+
+		if h.maxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+		}
+		handler(w, r, store)
+	}
 }
 
 // ServeHTTP delegates to the internal mux
@@ -50,25 +175,134 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // extractKey extracts the key from the URL path
 func extractKey(r *http.Request) string {
-	// The pattern is registered as "/keys/"
-	// So we need to extract everything after "/keys/"
+	// The pattern is registered as "/keys/" or "/buckets/{bucket}/keys/"
+	// So we need to extract everything after "/keys/", skipping the bucket
 	path := r.URL.Path
-	parts := strings.Split(path, "/keys/")
-	if len(parts) < 2 {
+	if rest, ok := strings.CutPrefix(path, "/buckets/"); ok {
+		if i := strings.Index(rest, "/"); i >= 0 {
+			path = rest[i:]
+		}
+	}
+	key, ok := strings.CutPrefix(path, "/keys/")
+	if !ok {
 		return ""
 	}
-	return parts[1]
+	return key
+}
+
+// readBody reads the request body, writing an error response on failure
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// writeLimitError writes an error response if err is caused by the store's
+// limits, and returns whether it did
+func writeLimitError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, kv_store.ErrKeyTooLong):
+		http.Error(w, err.Error(), http.StatusRequestURITooLong)
+	case errors.Is(err, kv_store.ErrValueTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, kv_store.ErrQuotaExceeded), errors.Is(err, kv_store.ErrOutOfMemory):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	default:
+		return false
+	}
+	return true
+}
+
+// parseRevision extracts the optional "rev" query parameter from the request.
+// Returns the revision and true if the parameter is present.
+func parseRevision(r *http.Request) (int64, bool, error) {
+	param := r.URL.Query().Get("rev")
+	if param == "" {
+		return 0, false, nil
+	}
+	rev, err := strconv.ParseInt(param, 10, 64)
+	if err != nil || rev < 0 {
+		return 0, true, errors.New("invalid revision")
+	}
+	return rev, true, nil
+}
+
+// versionedStore returns the store as a VersionedStore, writing an error
+// response if the store does not support reads at past revisions.
+func versionedStore(w http.ResponseWriter, store kv_store.KeyValueStore) (kv_store.VersionedStore, bool) {
+	vs, ok := store.(kv_store.VersionedStore)
+	if !ok {
+		http.Error(w, "Store does not support revisions", http.StatusNotImplemented)
+	}
+	return vs, ok
+}
+
+// writeRevisionError maps errors from reads at a past revision to HTTP responses
+func writeRevisionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, kv_store.ErrCompacted):
+		http.Error(w, "Revision has been compacted", http.StatusGone)
+	case errors.Is(err, kv_store.ErrFutureRevision):
+		http.Error(w, "Revision is in the future", http.StatusBadRequest)
+	default:
+		http.Error(w, "Key not found", http.StatusNotFound)
+	}
 }
 
 // handleGetKey handles GET requests for a specific key
-func (h *Handler) handleGetKey(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleGetKey(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
 	// Extract key from path
 	key := extractKey(r)
 
-	// Get the value from the store
-	value, err := h.store.Get(key)
+	rev, atRevision, err := parseRevision(r)
 	if err != nil {
-		http.Error(w, "Key not found", http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get the value from the store, optionally as of a past revision
+	var value string
+	if atRevision {
+		vs, ok := versionedStore(w, store)
+		if !ok {
+			return
+		}
+		value, err = vs.GetAt(key, rev)
+		if err != nil {
+			writeRevisionError(w, err)
+			return
+		}
+	} else {
+		value, err = store.Get(key)
+		if errors.Is(err, kv_store.ErrWrongType) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Key not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	// Select a sub-document if a JSONPath expression is given
+	if path := r.URL.Query().Get("path"); path != "" {
+		sub, err := document.Get(value, path)
+		if err != nil {
+			writeDocumentError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(sub))
 		return
 	}
 
@@ -79,23 +313,43 @@ func (h *Handler) handleGetKey(w http.ResponseWriter, r *http.Request) {
 }
 
 // handlePutKey handles PUT requests to create or update a key
-func (h *Handler) handlePutKey(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handlePutKey(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
 	// Extract key from path
 	key := extractKey(r)
 
 	// Read the value from the request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+	body, ok := readBody(w, r)
+	if !ok {
 		return
 	}
 
 	// Check if the key already exists to determine the status code
-	_, err = h.store.Get(key)
+	_, err := store.Get(key)
 	isNewKey := err != nil
 
-	// Store the key-value pair
-	err = h.store.Put(key, string(body))
+	// Store the key-value pair, with a time to live if one is given
+	if param := r.URL.Query().Get("ttl"); param != "" {
+		ttl, parseErr := time.ParseDuration(param)
+		if parseErr != nil || ttl <= 0 {
+			http.Error(w, "Invalid ttl", http.StatusBadRequest)
+			return
+		}
+		ts, ok := store.(kv_store.TTLStore)
+		if !ok {
+			http.Error(w, "Store does not support expiring keys", http.StatusNotImplemented)
+			return
+		}
+		err = ts.PutWithTTL(key, string(body), ttl)
+	} else {
+		err = store.Put(key, string(body))
+	}
+	if writeLimitError(w, err) {
+		return
+	}
+	if errors.Is(err, kv_store.ErrTTLUnsupported) {
+		http.Error(w, "Store does not support expiring keys", http.StatusNotImplemented)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to store value", http.StatusInternalServerError)
 		return
@@ -109,13 +363,121 @@ func (h *Handler) handlePutKey(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handlePatchKey handles PATCH requests to partially update a key.
+// JSON documents are patched according to the request's content type:
+// "application/json-patch+json" for RFC 6902 JSON Patch and
+// "application/merge-patch+json" for RFC 7386 JSON Merge Patch. Otherwise, the
+// "op" query parameter selects a byte-level update: "append" appends the
+// request body to the value, and "overwrite" writes the body at the byte given
+// by the "offset" query parameter.
+func (h *Handler) handlePatchKey(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	// Extract key from path
+	key := extractKey(r)
+
+	// Read the data from the request body
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json-patch+json":
+		h.patchDocument(w, store, key, body, document.ApplyJSONPatch)
+		return
+	case "application/merge-patch+json":
+		h.patchDocument(w, store, key, body, document.ApplyMergePatch)
+		return
+	}
+
+	// Apply the requested update
+	var n int
+	var err error
+	switch r.URL.Query().Get("op") {
+	case "append":
+		n, err = store.Append(key, string(body))
+	case "overwrite":
+		offset, parseErr := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+		if parseErr != nil {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		n, err = store.SetRange(key, offset, string(body))
+	default:
+		http.Error(w, "Unknown patch operation", http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, kv_store.ErrInvalidOffset) {
+		http.Error(w, "Offset out of range", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, kv_store.ErrWrongType) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if writeLimitError(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update value", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the new length of the value
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strconv.Itoa(n)))
+}
+
+// patchDocument atomically applies a patch to the JSON document stored at key
+// and writes the patched document. A missing key is patched as a null document.
+func (h *Handler) patchDocument(w http.ResponseWriter, store kv_store.KeyValueStore, key string, patch []byte,
+	apply func(doc string, patch []byte) (string, error)) {
+	value, err := store.Update(key, func(value string, exists bool) (string, error) {
+		if !exists {
+			value = "null"
+		}
+		return apply(value, patch)
+	})
+	if err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+
+	// Set content type and write response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(value))
+}
+
+// writeDocumentError maps errors from JSON document operations to HTTP responses
+func writeDocumentError(w http.ResponseWriter, err error) {
+	if writeLimitError(w, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, document.ErrInvalidDocument):
+		http.Error(w, "Value is not a valid JSON document", http.StatusUnprocessableEntity)
+	case errors.Is(err, document.ErrInvalidPath), errors.Is(err, document.ErrInvalidPatch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, document.ErrPathNotFound):
+		http.Error(w, "Path not found", http.StatusNotFound)
+	case errors.Is(err, document.ErrConflict), errors.Is(err, kv_store.ErrWrongType):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Failed to update value", http.StatusInternalServerError)
+	}
+}
+
 // handleDeleteKey handles DELETE requests for a specific key
-func (h *Handler) handleDeleteKey(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleDeleteKey(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
 	// Extract key from path
 	key := extractKey(r)
 
 	// Delete the key from the store
-	err := h.store.Delete(key)
+	err := store.Delete(key)
 	if err != nil {
 		http.Error(w, "Failed to delete key", http.StatusInternalServerError)
 		return
@@ -126,14 +488,33 @@ func (h *Handler) handleDeleteKey(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleListEntries handles GET requests to list all key-value pairs
-func (h *Handler) handleListEntries(w http.ResponseWriter, r *http.Request) {
-	// Get all entries from the store
-	entries, err := h.store.Entries()
+func (h *Handler) handleListEntries(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	rev, atRevision, err := parseRevision(r)
 	if err != nil {
-		http.Error(w, "Failed to list entries", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// Get all entries from the store, optionally as of a past revision
+	var entries []kv_store.Entry
+	if atRevision {
+		vs, ok := versionedStore(w, store)
+		if !ok {
+			return
+		}
+		entries, err = vs.EntriesAt(rev)
+		if err != nil {
+			writeRevisionError(w, err)
+			return
+		}
+	} else {
+		entries, err = store.Entries()
+		if err != nil {
+			http.Error(w, "Failed to list entries", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Marshal entries map to JSON
 	jsonData, err := json.Marshal(entries)
 	if err != nil {
@@ -146,3 +527,119 @@ func (h *Handler) handleListEntries(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(jsonData)
 }
+
+// historyStore returns the store as a HistoryStore, writing an error response
+// if the store does not keep key history.
+func historyStore(w http.ResponseWriter, store kv_store.KeyValueStore) (kv_store.HistoryStore, bool) {
+	hs, ok := store.(kv_store.HistoryStore)
+	if !ok {
+		http.Error(w, "Store does not keep key history", http.StatusNotImplemented)
+	}
+	return hs, ok
+}
+
+// handleKeyHistory handles GET requests for the history of a specific key
+func (h *Handler) handleKeyHistory(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	hs, ok := historyStore(w, store)
+	if !ok {
+		return
+	}
+
+	// Get the retained versions from the store
+	history, err := hs.History(r.PathValue("key"))
+	if err != nil {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	// Marshal versions to JSON
+	jsonData, err := json.Marshal(history)
+	if err != nil {
+		http.Error(w, "Failed to marshal history", http.StatusInternalServerError)
+		return
+	}
+
+	// Set content type and write response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// handleRevertKey handles POST requests to restore a key to an older version
+func (h *Handler) handleRevertKey(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	hs, ok := historyStore(w, store)
+	if !ok {
+		return
+	}
+
+	// Parse the version to restore
+	version, err := strconv.ParseInt(r.URL.Query().Get("version"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	// Restore the version
+	err = hs.Revert(r.PathValue("key"), version)
+	if errors.Is(err, kv_store.ErrVersionNotFound) {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	if writeLimitError(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to revert key", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleIncrementKey handles POST requests to increment an integer value
+func (h *Handler) handleIncrementKey(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	h.handleCounter(w, r, store.Increment)
+}
+
+// handleDecrementKey handles POST requests to decrement an integer value
+func (h *Handler) handleDecrementKey(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	h.handleCounter(w, r, store.Decrement)
+}
+
+// handleCounter applies a numeric operation with the delta given by the
+// optional "by" query parameter (default 1) and writes the new value
+func (h *Handler) handleCounter(w http.ResponseWriter, r *http.Request, op func(string, int64) (int64, error)) {
+	// Parse the delta
+	delta := int64(1)
+	if param := r.URL.Query().Get("by"); param != "" {
+		var err error
+		delta, err = strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid delta", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Apply the operation
+	n, err := op(r.PathValue("key"), delta)
+	if errors.Is(err, kv_store.ErrNotInteger) || errors.Is(err, kv_store.ErrOverflow) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, kv_store.ErrWrongType) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if writeLimitError(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update value", http.StatusInternalServerError)
+		return
+	}
+
+	// Set content type and write response
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strconv.FormatInt(n, 10)))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/bonearadu/kvstore/kv_store"
@@ -11,10 +12,14 @@ import (
 
 // MockStore is a mock implementation of the KeyValueStore interface for testing
 type MockStore struct {
-	GetFunc     func(key string) (string, error)
-	PutFunc     func(key string, value string) error
-	DeleteFunc  func(key string) error
-	EntriesFunc func() ([]kv_store.Entry, error)
+	GetFunc       func(key string) (string, error)
+	PutFunc       func(key string, value string) error
+	DeleteFunc    func(key string) error
+	EntriesFunc   func() ([]kv_store.Entry, error)
+	IncrementFunc func(key string, delta int64) (int64, error)
+	AppendFunc    func(key string, suffix string) (int, error)
+	SetRangeFunc  func(key string, offset int64, data string) (int, error)
+	UpdateFunc    func(key string, fn kv_store.UpdateFunc) (string, error)
 }
 
 func (m *MockStore) Get(key string) (string, error) {
@@ -45,6 +50,38 @@ func (m *MockStore) Entries() ([]kv_store.Entry, error) {
 	return []kv_store.Entry{}, nil
 }
 
+func (m *MockStore) Increment(key string, delta int64) (int64, error) {
+	if m.IncrementFunc != nil {
+		return m.IncrementFunc(key, delta)
+	}
+	return 0, nil
+}
+
+func (m *MockStore) Decrement(key string, delta int64) (int64, error) {
+	return m.Increment(key, -delta)
+}
+
+func (m *MockStore) Append(key string, suffix string) (int, error) {
+	if m.AppendFunc != nil {
+		return m.AppendFunc(key, suffix)
+	}
+	return 0, nil
+}
+
+func (m *MockStore) SetRange(key string, offset int64, data string) (int, error) {
+	if m.SetRangeFunc != nil {
+		return m.SetRangeFunc(key, offset, data)
+	}
+	return 0, nil
+}
+
+func (m *MockStore) Update(key string, fn kv_store.UpdateFunc) (string, error) {
+	if m.UpdateFunc != nil {
+		return m.UpdateFunc(key, fn)
+	}
+	return fn("", false)
+}
+
 // TestExtractKey tests the extractKey function
 func TestExtractKey(t *testing.T) {
 	tests := []struct {
@@ -72,6 +109,11 @@ func TestExtractKey(t *testing.T) {
 			path:     "/keys",
 			expected: "",
 		},
+		{
+			name:     "bucket key",
+			path:     "/buckets/keys/keys/mykey",
+			expected: "mykey",
+		},
 	}
 
 	for _, tt := range tests {
@@ -152,6 +194,46 @@ func TestRouting(t *testing.T) {
 	}
 }
 
+// TestRoutingEscapedKeys tests that keys with an escaped slash are addressed
+// as a whole, rather than as a key followed by an operation
+func TestRoutingEscapedKeys(t *testing.T) {
+	handler := NewHandler(kv_store.NewInMemoryStore())
+
+	// The requests run in order and build on each other
+	tests := []struct {
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"PUT", "/keys/a%2Fhistory", "value", http.StatusCreated, ""},
+		{"GET", "/keys/a%2Fhistory", "", http.StatusOK, "value"},
+		{"GET", "/keys/a/history", "", http.StatusNotImplemented, ""},
+		{"POST", "/keys/a%2Fb/incr", "", http.StatusOK, "1"},
+		{"GET", "/keys/a/b", "", http.StatusOK, "1"},
+		{"GET", "/keys/a%2Fb/type", "", http.StatusOK, "string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("handler returned wrong body: got %v want %v",
+					rr.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
 // TestHandleGetKey tests the handleGetKey function
 func TestHandleGetKey(t *testing.T) {
 	// Create a mock store
@@ -311,3 +393,707 @@ func TestHandleListEntries(t *testing.T) {
 		}
 	}
 }
+
+// TestHandleGetKeyAtRevision tests reads of a key at a past revision
+func TestHandleGetKeyAtRevision(t *testing.T) {
+	// Create a versioned store with some history
+	store, err := kv_store.NewMVCCStore(kv_store.NewInMemoryStore(), 1, 0)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	store.Put("mykey", "v1")
+	store.Put("mykey", "v2")
+	store.Put("mykey", "v3")
+
+	handler := NewHandler(store)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "latest revision",
+			path:           "/keys/mykey",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "v3",
+		},
+		{
+			name:           "retained revision",
+			path:           "/keys/mykey?rev=2",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "v2",
+		},
+		{
+			name:           "compacted revision",
+			path:           "/keys/mykey?rev=1",
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name:           "future revision",
+			path:           "/keys/mykey?rev=4",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid revision",
+			path:           "/keys/mykey?rev=abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing key",
+			path:           "/keys/otherkey?rev=2",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("handler returned wrong body: got %v want %v",
+					rr.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestHandleListEntriesAtRevision tests listing entries at a past revision
+func TestHandleListEntriesAtRevision(t *testing.T) {
+	t.Run("versioned store", func(t *testing.T) {
+		store, err := kv_store.NewMVCCStore(kv_store.NewInMemoryStore(), 10, 0)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		store.Put("key1", "value1")
+		store.Put("key2", "value2")
+
+		handler := NewHandler(store)
+
+		req := httptest.NewRequest("GET", "/keys?rev=1", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v",
+				rr.Code, http.StatusOK)
+		}
+
+		var responseList []kv_store.Entry
+		if err := json.Unmarshal(rr.Body.Bytes(), &responseList); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		if len(responseList) != 1 || responseList[0].Key != "key1" {
+			t.Errorf("handler returned wrong entries: got %+v", responseList)
+		}
+	})
+
+	t.Run("unversioned store", func(t *testing.T) {
+		handler := NewHandler(&MockStore{})
+
+		req := httptest.NewRequest("GET", "/keys?rev=1", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotImplemented {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				rr.Code, http.StatusNotImplemented)
+		}
+	})
+}
+
+// TestHandleKeyHistory tests listing the versions of a key
+func TestHandleKeyHistory(t *testing.T) {
+	t.Run("versioned store", func(t *testing.T) {
+		store, err := kv_store.NewMVCCStore(kv_store.NewInMemoryStore(), 0, 5)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		store.Put("mykey", "v1")
+		store.Put("mykey", "v2")
+
+		handler := NewHandler(store)
+
+		req := httptest.NewRequest("GET", "/keys/mykey/history", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v",
+				rr.Code, http.StatusOK)
+		}
+
+		var history []kv_store.Version
+		if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		if len(history) != 2 || history[0].Value != "v2" || history[1].Value != "v1" {
+			t.Errorf("handler returned wrong history: got %+v", history)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		store, _ := kv_store.NewMVCCStore(kv_store.NewInMemoryStore(), 0, 5)
+		handler := NewHandler(store)
+
+		req := httptest.NewRequest("GET", "/keys/mykey/history", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				rr.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("unversioned store", func(t *testing.T) {
+		handler := NewHandler(&MockStore{})
+
+		req := httptest.NewRequest("GET", "/keys/mykey/history", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotImplemented {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				rr.Code, http.StatusNotImplemented)
+		}
+	})
+}
+
+// TestHandleRevertKey tests restoring a key to an older version
+func TestHandleRevertKey(t *testing.T) {
+	store, err := kv_store.NewMVCCStore(kv_store.NewInMemoryStore(), 0, 5)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	store.Put("mykey", "v1")
+	store.Put("mykey", "v2")
+
+	handler := NewHandler(store)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "missing version",
+			path:           "/keys/mykey/revert",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown version",
+			path:           "/keys/mykey/revert?version=7",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "retained version",
+			path:           "/keys/mykey/revert?version=1",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, nil)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+
+	value, _ := store.Get("mykey")
+	if value != "v1" {
+		t.Errorf("Expected reverted value 'v1', got '%s'", value)
+	}
+}
+
+// TestHandleCounters tests the increment and decrement endpoints
+func TestHandleCounters(t *testing.T) {
+	store := kv_store.NewInMemoryStore()
+	store.Put("text", "abc")
+
+	handler := NewHandler(store)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "increment missing key",
+			path:           "/keys/counter/incr",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "1",
+		},
+		{
+			name:           "increment by delta",
+			path:           "/keys/counter/incr?by=10",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "11",
+		},
+		{
+			name:           "decrement by delta",
+			path:           "/keys/counter/decr?by=4",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "7",
+		},
+		{
+			name:           "invalid delta",
+			path:           "/keys/counter/incr?by=x",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "non-numeric value",
+			path:           "/keys/text/incr",
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, nil)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("handler returned wrong body: got %v want %v",
+					rr.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestHandlePatchKey tests partial updates of a key
+func TestHandlePatchKey(t *testing.T) {
+	store := kv_store.NewInMemoryStore()
+	store.Put("mykey", "hello")
+
+	handler := NewHandler(store)
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+		expectedValue  string
+	}{
+		{
+			name:           "append",
+			path:           "/keys/mykey?op=append",
+			body:           " world",
+			expectedStatus: http.StatusOK,
+			expectedValue:  "hello world",
+		},
+		{
+			name:           "overwrite",
+			path:           "/keys/mykey?op=overwrite&offset=6",
+			body:           "there",
+			expectedStatus: http.StatusOK,
+			expectedValue:  "hello there",
+		},
+		{
+			name:           "missing offset",
+			path:           "/keys/mykey?op=overwrite",
+			body:           "x",
+			expectedStatus: http.StatusBadRequest,
+			expectedValue:  "hello there",
+		},
+		{
+			name:           "negative offset",
+			path:           "/keys/mykey?op=overwrite&offset=-1",
+			body:           "x",
+			expectedStatus: http.StatusBadRequest,
+			expectedValue:  "hello there",
+		},
+		{
+			name:           "unknown operation",
+			path:           "/keys/mykey?op=prepend",
+			body:           "x",
+			expectedStatus: http.StatusBadRequest,
+			expectedValue:  "hello there",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedStatus)
+			}
+			if value, _ := store.Get("mykey"); value != tt.expectedValue {
+				t.Errorf("store has wrong value: got %v want %v", value, tt.expectedValue)
+			}
+		})
+	}
+}
+
+// TestHandleGetKeyPath tests fetching a sub-document with a JSONPath expression
+func TestHandleGetKeyPath(t *testing.T) {
+	store := kv_store.NewInMemoryStore()
+	store.Put("doc", `{"a": {"b": [1, 2]}}`)
+	store.Put("text", "not json")
+
+	handler := NewHandler(store)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "sub-document",
+			path:           "/keys/doc?path=$.a.b",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[1,2]",
+		},
+		{
+			name:           "missing path",
+			path:           "/keys/doc?path=$.a.c",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid path",
+			path:           "/keys/doc?path=a.b",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid document",
+			path:           "/keys/text?path=$.a",
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("handler returned wrong body: got %v want %v",
+					rr.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestHandlePatchDocument tests JSON Patch and JSON Merge Patch requests
+func TestHandlePatchDocument(t *testing.T) {
+	tests := []struct {
+		name           string
+		initial        string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedValue  string
+	}{
+		{
+			name:           "json patch",
+			initial:        `{"a":1}`,
+			contentType:    "application/json-patch+json",
+			body:           `[{"op":"add","path":"/b","value":2}]`,
+			expectedStatus: http.StatusOK,
+			expectedValue:  `{"a":1,"b":2}`,
+		},
+		{
+			name:           "merge patch",
+			initial:        `{"a":1,"b":2}`,
+			contentType:    "application/merge-patch+json; charset=utf-8",
+			body:           `{"a":null,"c":3}`,
+			expectedStatus: http.StatusOK,
+			expectedValue:  `{"b":2,"c":3}`,
+		},
+		{
+			name:           "failed test operation",
+			initial:        `{"a":1}`,
+			contentType:    "application/json-patch+json",
+			body:           `[{"op":"test","path":"/a","value":2},{"op":"remove","path":"/a"}]`,
+			expectedStatus: http.StatusConflict,
+			expectedValue:  `{"a":1}`,
+		},
+		{
+			name:           "malformed patch",
+			initial:        `{"a":1}`,
+			contentType:    "application/json-patch+json",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+			expectedValue:  `{"a":1}`,
+		},
+		{
+			name:           "invalid document",
+			initial:        `not json`,
+			contentType:    "application/merge-patch+json",
+			body:           `{"a":1}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedValue:  `not json`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := kv_store.NewInMemoryStore()
+			store.Put("doc", tt.initial)
+			handler := NewHandler(store)
+
+			req := httptest.NewRequest("PATCH", "/keys/doc", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedStatus)
+			}
+			if value, _ := store.Get("doc"); value != tt.expectedValue {
+				t.Errorf("store has wrong value: got %v want %v", value, tt.expectedValue)
+			}
+		})
+	}
+}
+
+// TestHandleLimits tests that requests exceeding the body size or the store's
+// limits are rejected
+func TestHandleLimits(t *testing.T) {
+	store, err := kv_store.NewQuotaStore(kv_store.NewInMemoryStore(), kv_store.Limits{
+		MaxKeyLength: 8,
+		MaxKeys:      1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create quota store: %v", err)
+	}
+	handler := NewBucketHandler(kv_store.NewBuckets(store, nil), WithMaxBodySize(5))
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{"within limits", "PUT", "/keys/key", "value", http.StatusCreated},
+		{"body too large", "PUT", "/keys/key", "value!", http.StatusRequestEntityTooLarge},
+		{"key too long", "PUT", "/keys/longerkey", "v", http.StatusRequestURITooLong},
+		{"too many keys", "PUT", "/keys/other", "v", http.StatusInsufficientStorage},
+		{"counter over quota", "POST", "/keys/other/incr", "", http.StatusInsufficientStorage},
+		{"patch body too large", "PATCH", "/keys/key?op=append", "value!", http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+// TestIndexRoutes tests the secondary index endpoints
+func TestIndexRoutes(t *testing.T) {
+	store := kv_store.NewIndexedStore(kv_store.NewInMemoryStore())
+	store.Put("ada", `{"age":36}`)
+	store.Put("alan", `{"age":41}`)
+
+	handler := NewHandler(store)
+
+	// The requests run in order and build on each other
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"create index", "PUT", "/index/age?path=$.age", http.StatusCreated, ""},
+		{"invalid path", "PUT", "/index/bad?path=age", http.StatusBadRequest, ""},
+		{"list indexes", "GET", "/index", http.StatusOK, `{"age":"$.age"}`},
+		{"lookup", "GET", "/index/age?eq=41", http.StatusOK, `[{"Key":"alan","Value":"{\"age\":41}"}]`},
+		{"range", "GET", "/index/age?from=30&to=40", http.StatusOK, `[{"Key":"ada","Value":"{\"age\":36}"}]`},
+		{"no match", "GET", "/index/age?eq=1", http.StatusOK, `[]`},
+		{"unknown index", "GET", "/index/name?eq=ada", http.StatusNotFound, ""},
+		{"delete index", "DELETE", "/index/age", http.StatusOK, ""},
+		{"delete missing index", "DELETE", "/index/age", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedStatus)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("handler returned wrong body: got %v want %v",
+					rr.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+
+	t.Run("unsupported store", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/index/age?eq=1", nil)
+		rr := httptest.NewRecorder()
+
+		NewHandler(&MockStore{}).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotImplemented {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				rr.Code, http.StatusNotImplemented)
+		}
+	})
+}
+
+// TestHandlePutKeyWithTTL tests storing keys that expire
+func TestHandlePutKeyWithTTL(t *testing.T) {
+	tests := []struct {
+		name           string
+		store          kv_store.KeyValueStore
+		ttl            string
+		expectedStatus int
+	}{
+		{"valid ttl", kv_store.NewInMemoryStore(), "1m", http.StatusCreated},
+		{"invalid ttl", kv_store.NewInMemoryStore(), "soon", http.StatusBadRequest},
+		{"negative ttl", kv_store.NewInMemoryStore(), "-1s", http.StatusBadRequest},
+		{"unsupported store", &MockStore{
+			GetFunc: func(key string) (string, error) { return "", kv_store.ErrKeyNotFound },
+		}, "1m", http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/keys/mykey?ttl="+tt.ttl, strings.NewReader("value"))
+			rr := httptest.NewRecorder()
+
+			NewHandler(tt.store).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+
+	t.Run("out of memory", func(t *testing.T) {
+		store, _ := kv_store.NewBoundedInMemoryStore(4, kv_store.EvictReject)
+
+		req := httptest.NewRequest("PUT", "/keys/mykey", strings.NewReader("value"))
+		rr := httptest.NewRecorder()
+
+		NewHandler(store).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusInsufficientStorage {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				rr.Code, http.StatusInsufficientStorage)
+		}
+	})
+}
+
+func TestHandleStats(t *testing.T) {
+	t.Run("store with stats", func(t *testing.T) {
+		store := kv_store.NewTieredStore(t.TempDir(), 10)
+		store.Put("key", "value")
+		store.Get("key")
+
+		req := httptest.NewRequest("GET", "/stats", nil)
+		rr := httptest.NewRecorder()
+		NewHandler(store).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		var stats struct {
+			Hot struct {
+				Keys int `json:"keys"`
+				Hits int `json:"hits"`
+			} `json:"hot"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if stats.Hot.Keys != 1 || stats.Hot.Hits != 1 {
+			t.Fatalf("Expected 1 key and 1 hit in memory, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("cached store", func(t *testing.T) {
+		store := kv_store.NewPersistentCachedStore(t.TempDir(), 10)
+		store.Put("key", "value")
+		store.Get("key")
+		store.Get("missing")
+
+		req := httptest.NewRequest("GET", "/stats", nil)
+		rr := httptest.NewRecorder()
+		NewHandler(store).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		var stats struct {
+			Cache struct {
+				Entries  int     `json:"entries"`
+				HitRatio float64 `json:"hit_ratio"`
+			} `json:"cache"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if stats.Cache.Entries != 1 || stats.Cache.HitRatio != 0.5 {
+			t.Fatalf("Expected 1 cached entry and a hit ratio of 0.5, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("store without stats", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/stats", nil)
+		rr := httptest.NewRecorder()
+		NewHandler(kv_store.NewInMemoryStore()).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotImplemented {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotImplemented)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bonearadu/kvstore/document"
+	"github.com/bonearadu/kvstore/kv_store"
+)
+
+// indexStore returns the IndexStore wrapped by the store, writing an error
+// response if the store does not maintain secondary indexes.
+func indexStore(w http.ResponseWriter, store kv_store.KeyValueStore) (kv_store.IndexStore, bool) {
+	is, ok := kv_store.As[kv_store.IndexStore](store)
+	if !ok {
+		http.Error(w, "Store does not support indexes", http.StatusNotImplemented)
+	}
+	return is, ok
+}
+
+// handleListIndexes handles GET requests to list all indexes and their paths
+func (h *Handler) handleListIndexes(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	is, ok := indexStore(w, store)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, is.Indexes())
+}
+
+// handleCreateIndex handles PUT requests to create or replace an index on the
+// JSONPath expression given by the "path" query parameter
+func (h *Handler) handleCreateIndex(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	is, ok := indexStore(w, store)
+	if !ok {
+		return
+	}
+
+	created, err := is.CreateIndex(r.PathValue("name"), r.URL.Query().Get("path"))
+	if errors.Is(err, document.ErrInvalidPath) {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create index", http.StatusInternalServerError)
+		return
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleDeleteIndex handles DELETE requests for an index
+func (h *Handler) handleDeleteIndex(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	is, ok := indexStore(w, store)
+	if !ok {
+		return
+	}
+
+	if err := is.DropIndex(r.PathValue("name")); err != nil {
+		http.Error(w, "Index not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleQueryIndex handles GET requests for the entries matching an index query:
+// the "eq" query parameter selects an exact value, and "from" and "to" select
+// an inclusive range. Without parameters, all indexed entries are returned.
+func (h *Handler) handleQueryIndex(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	is, ok := indexStore(w, store)
+	if !ok {
+		return
+	}
+
+	var entries []kv_store.Entry
+	var err error
+	query := r.URL.Query()
+	if query.Has("eq") {
+		entries, err = is.Lookup(r.PathValue("name"), query.Get("eq"))
+	} else {
+		entries, err = is.Range(r.PathValue("name"), query.Get("from"), query.Get("to"))
+	}
+	if errors.Is(err, kv_store.ErrIndexNotFound) {
+		http.Error(w, "Index not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to query index", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, entries)
+}
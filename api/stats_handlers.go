@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/bonearadu/kvstore/kv_store"
+)
+
+// handleStats handles GET requests for the statistics reported by the store
+func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request, store kv_store.KeyValueStore) {
+	sr, ok := kv_store.As[kv_store.StatsReporter](store)
+	if !ok {
+		http.Error(w, "Store does not report statistics", http.StatusNotImplemented)
+		return
+	}
+
+	writeJSON(w, sr.Stats())
+}
@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// ARCCache is an Adaptive Replacement Cache. Entries used once are kept in
+// recent, and entries used more than once in frequent. The keys last evicted
+// from each of them are remembered in the ghost lists recentGhost and
+// frequentGhost: writing one of those keys again is a sign that the matching
+// list is too small, and moves target, the share of the capacity given to recent.
+type ARCCache[K comparable, V any] struct {
+	recent        *orderedList[K, V]
+	frequent      *orderedList[K, V]
+	recentGhost   *orderedList[K, V]
+	frequentGhost *orderedList[K, V]
+	target        int
+	capacity      int
+	onEvict       EvictFunc[K, V]
+	stats         counters[K, V]
+	mu            sync.Mutex
+}
+
+func NewARCCache[K comparable, V any](capacity int) *ARCCache[K, V] {
+	return &ARCCache[K, V]{
+		recent:        newOrderedList[K, V](),
+		frequent:      newOrderedList[K, V](),
+		recentGhost:   newOrderedList[K, V](),
+		frequentGhost: newOrderedList[K, V](),
+		capacity:      capacity,
+		mu:            sync.Mutex{},
+	}
+}
+
+// replace evicts an entry from recent if it exceeds its target size, or from
+// frequent otherwise, remembering its key in the matching ghost list.
+// frequentGhostHit is true when making room for a key found in frequentGhost.
+func (c *ARCCache[K, V]) replace(frequentGhostHit bool) {
+	var e *entry[K, V]
+	n := c.recent.len()
+	if n > 0 && (n > c.target || (frequentGhostHit && n == c.target)) {
+		e, _ = c.recent.removeBack()
+		c.recentGhost.push(&entry[K, V]{key: e.key})
+	} else if e, _ = c.frequent.removeBack(); e != nil {
+		c.frequentGhost.push(&entry[K, V]{key: e.key})
+	} else {
+		e, _ = c.recent.removeBack()
+		c.recentGhost.push(&entry[K, V]{key: e.key})
+	}
+
+	c.stats.remove(e.key, e.val)
+	c.stats.evict(c.onEvict, e.key, e.val, e.evictReason(time.Now()))
+}
+
+// expire evicts the entry of key if it has expired. The caller must hold mu.
+func (c *ARCCache[K, V]) expire(key K) {
+	for _, l := range []*orderedList[K, V]{c.recent, c.frequent} {
+		if e, ok := l.get(key); ok && e.expired(time.Now()) {
+			l.remove(key)
+			c.stats.remove(key, e.val)
+			c.stats.evict(c.onEvict, key, e.val, EvictExpired)
+		}
+	}
+}
+
+// full reports whether the cache holds as many entries as its capacity.
+func (c *ARCCache[K, V]) full() bool {
+	return c.recent.len()+c.frequent.len() >= c.capacity
+}
+
+func (c *ARCCache[K, V]) Read(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(key)
+	if e, ok := c.recent.remove(key); ok {
+		c.frequent.push(e)
+		c.stats.read(true)
+		return e.val, true
+	}
+	if e, ok := c.frequent.get(key); ok {
+		c.frequent.moveToFront(key)
+		c.stats.read(true)
+		return e.val, true
+	}
+	c.stats.read(false)
+	var zero V
+	return zero, false
+}
+
+func (c *ARCCache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := c.recent.get(key); ok && !e.expired(now) {
+		return e.val, true
+	}
+	if e, ok := c.frequent.get(key); ok && !e.expired(now) {
+		return e.val, true
+	}
+	var zero V
+	return zero, false
+}
+
+func (c *ARCCache[K, V]) Write(key K, value V) {
+	c.write(key, value, time.Time{})
+}
+
+func (c *ARCCache[K, V]) WriteWithTTL(key K, value V, ttl time.Duration) {
+	c.write(key, value, time.Now().Add(ttl))
+}
+
+// write replaces the value of key, which expires at expires, or never if
+// expires is zero.
+func (c *ARCCache[K, V]) write(key K, value V, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capacity <= 0 {
+		return
+	}
+
+	// A cached key is now used more than once
+	e, ok := c.recent.remove(key)
+	if !ok {
+		e, ok = c.frequent.get(key)
+	}
+	if ok {
+		c.stats.remove(key, e.val)
+		c.stats.insert(key, value, false)
+		c.frequent.pushFront(key, value, expires)
+		return
+	}
+	defer c.stats.insert(key, value, true)
+
+	// A key evicted from recent too early: grow recent
+	if _, ok := c.recentGhost.get(key); ok {
+		delta := max(c.frequentGhost.len()/c.recentGhost.len(), 1)
+		c.target = min(c.target+delta, c.capacity)
+		if c.full() {
+			c.replace(false)
+		}
+		c.recentGhost.remove(key)
+		c.frequent.pushFront(key, value, expires)
+		return
+	}
+
+	// A key evicted from frequent too early: grow frequent
+	if _, ok := c.frequentGhost.get(key); ok {
+		delta := max(c.recentGhost.len()/c.frequentGhost.len(), 1)
+		c.target = max(c.target-delta, 0)
+		if c.full() {
+			c.replace(true)
+		}
+		c.frequentGhost.remove(key)
+		c.frequent.pushFront(key, value, expires)
+		return
+	}
+
+	// A new key
+	if c.full() {
+		c.replace(false)
+	}
+	if c.recentGhost.len() > c.capacity-c.target {
+		c.recentGhost.removeBack()
+	}
+	if c.frequentGhost.len() > c.target {
+		c.frequentGhost.removeBack()
+	}
+	c.recent.pushFront(key, value, expires)
+}
+
+func (c *ARCCache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.recent.remove(key); ok {
+		c.stats.remove(key, e.val)
+	}
+	if e, ok := c.frequent.remove(key); ok {
+		c.stats.remove(key, e.val)
+	}
+	c.recentGhost.remove(key)
+	c.frequentGhost.remove(key)
+}
+
+func (c *ARCCache[K, V]) OnEvict(fn EvictFunc[K, V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onEvict = fn
+}
+
+func (c *ARCCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.recent.len() + c.frequent.len()
+}
+
+func (c *ARCCache[K, V]) Stats() Stats {
+	return c.stats.stats()
+}
+
+// Keys returns the keys used more than once, then the others, each from the
+// most to the least recently used.
+func (c *ARCCache[K, V]) Keys() []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append(c.frequent.keys(), c.recent.keys()...)
+}
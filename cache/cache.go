@@ -1,13 +1,161 @@
 package cache
 
-type Cache interface {
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// Cache holds values of type V by keys of type K, up to a capacity set when
+// it is created, evicting entries according to its policy.
+type Cache[K comparable, V any] interface {
 	// Read returns the latest value for a given key from the Cache,
 	// and a boolean representing either a cache hit (true) or miss (false).
-	Read(key string) (string, bool)
+	Read(key K) (V, bool)
+
+	// Peek returns the value for a given key like Read, without counting
+	// as a use of the key for eviction.
+	Peek(key K) (V, bool)
 
 	// Write writes a value to the cache.
-	Write(key string, value string)
+	Write(key K, value V)
+
+	// WriteWithTTL writes a value to the cache, which expires after ttl: it is
+	// then read as missing, and evicted when read or when making room for others.
+	WriteWithTTL(key K, value V, ttl time.Duration)
 
 	// Deletes a key from the cache.
-	Delete(key string)
+	Delete(key K)
+
+	// OnEvict sets fn to be called for every entry evicted to make room for
+	// others, rejected when written, or expired. It isn't called for entries
+	// deleted or overwritten. fn is called with the cache locked, so it must not
+	// use the cache. It is called from Write, and also from Read for expired
+	// entries: callers reading under a shared lock of their own must not rely
+	// on holding it exclusively when the reason is EvictExpired.
+	OnEvict(fn EvictFunc[K, V])
+
+	// Len returns the number of entries in the cache.
+	Len() int
+
+	// Keys returns the keys in the cache, approximately from the one it would
+	// evict last to the one it would evict first.
+	Keys() []K
+
+	// Stats returns the statistics of the cache since it was created.
+	Stats() Stats
+}
+
+// EvictFunc is called with the key and value of an entry evicted from a cache,
+// and the reason it was evicted.
+type EvictFunc[K comparable, V any] func(key K, value V, reason EvictReason)
+
+// Weigher returns the weight of an entry, for caches bounded by the total weight
+// of their entries. It must always return the same weight for the same entry.
+type Weigher[K comparable, V any] func(key K, value V) int64
+
+// ByteSize weighs an entry by the size of its key and value in bytes: the
+// length of strings and byte slices, and the size of other types in memory,
+// without what they point to.
+func ByteSize[K comparable, V any](key K, value V) int64 {
+	return byteSize(key) + byteSize(value)
+}
+
+func byteSize[T any](v T) int64 {
+	switch s := any(v).(type) {
+	case string:
+		return int64(len(s))
+	case []byte:
+		return int64(len(s))
+	}
+	return int64(unsafe.Sizeof(v))
+}
+
+// defaultEntryWeightRatio is the share of the total weight a single entry may
+// weigh, unless set otherwise.
+const defaultEntryWeightRatio = 8
+
+// Weights bounds a cache by the total weight of its entries.
+type Weights[K comparable, V any] struct {
+	// MaxWeight is the total weight of the entries held by the cache.
+	MaxWeight int64
+
+	// MaxEntryWeight is the weight above which an entry isn't cached, so that a
+	// single entry can't evict most of the others. Defaults to an eighth of MaxWeight.
+	MaxEntryWeight int64
+
+	// Weigher weighs each entry. Defaults to ByteSize.
+	Weigher Weigher[K, V]
+}
+
+func (w Weights[K, V]) weigher() Weigher[K, V] {
+	if w.Weigher == nil {
+		return ByteSize[K, V]
+	}
+	return w.Weigher
+}
+
+func (w Weights[K, V]) maxEntryWeight() int64 {
+	if w.MaxEntryWeight <= 0 {
+		return w.MaxWeight / defaultEntryWeightRatio
+	}
+	return min(w.MaxEntryWeight, w.MaxWeight)
+}
+
+// Policy selects the entries a cache evicts when it is full.
+type Policy string
+
+const (
+	// PolicyLRU evicts the least recently used entry.
+	PolicyLRU Policy = "lru"
+
+	// PolicyLFU evicts the least frequently used entry, and the least recently
+	// used one among those.
+	PolicyLFU Policy = "lfu"
+
+	// PolicyARC is the Adaptive Replacement Cache, which balances recency and
+	// frequency based on the hits on recently evicted keys.
+	PolicyARC Policy = "arc"
+
+	// Policy2Q admits new entries to a small queue, and only keeps the ones
+	// used again after being evicted from it, which makes it resistant to scans.
+	Policy2Q Policy = "2q"
+
+	// PolicyTinyLFU is Window-TinyLFU, which admits entries evicted from a small
+	// LRU window only if they are used more often than the entries they replace.
+	PolicyTinyLFU Policy = "tinylfu"
+)
+
+// Policies lists all the supported policies.
+var Policies = []Policy{PolicyLRU, PolicyLFU, PolicyARC, Policy2Q, PolicyTinyLFU}
+
+// New creates a cache holding at most capacity entries, evicted according to policy.
+func New[K comparable, V any](policy Policy, capacity int) (Cache[K, V], error) {
+	switch policy {
+	case PolicyLRU:
+		return NewLRUCache[K, V](capacity), nil
+	case PolicyLFU:
+		return NewLFUCache[K, V](capacity), nil
+	case PolicyARC:
+		return NewARCCache[K, V](capacity), nil
+	case Policy2Q:
+		return NewTwoQueueCache[K, V](capacity), nil
+	case PolicyTinyLFU:
+		return NewTinyLFUCache[K, V](capacity), nil
+	default:
+		return nil, fmt.Errorf("unknown cache policy %q", policy)
+	}
+}
+
+// NewWeighted creates a cache bounded by the total weight of its entries, evicted
+// according to policy. Only PolicyLRU supports weights.
+func NewWeighted[K comparable, V any](policy Policy, weights Weights[K, V]) (Cache[K, V], error) {
+	switch policy {
+	case PolicyLRU:
+		return NewWeightedLRUCache(weights), nil
+	case PolicyLFU, PolicyARC, Policy2Q, PolicyTinyLFU:
+		return nil, fmt.Errorf("cache policy %q doesn't support a weighted capacity", policy)
+	default:
+		return nil, fmt.Errorf("unknown cache policy %q", policy)
+	}
 }
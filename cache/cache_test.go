@@ -0,0 +1,368 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCaches checks the behaviour every Cache implementation must share.
+func TestCaches(t *testing.T) {
+	for _, policy := range Policies {
+		newCache := func(t *testing.T, capacity int) Cache[string, string] {
+			c, err := New[string, string](policy, capacity)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			return c
+		}
+
+		t.Run(string(policy), func(t *testing.T) {
+			t.Run("read, write and delete", func(t *testing.T) {
+				c := newCache(t, 10)
+
+				if _, ok := c.Read("key"); ok {
+					t.Fatalf("Expected a miss for a missing key")
+				}
+				c.Write("key", "value")
+				if val, ok := c.Read("key"); !ok || val != "value" {
+					t.Fatalf("Expected value, got %s, %v", val, ok)
+				}
+				c.Write("key", "other")
+				if val, ok := c.Peek("key"); !ok || val != "other" {
+					t.Fatalf("Expected other, got %s, %v", val, ok)
+				}
+				c.Delete("key")
+				if _, ok := c.Read("key"); ok {
+					t.Fatalf("Expected key to be deleted")
+				}
+			})
+
+			t.Run("length and stats", func(t *testing.T) {
+				c := newCache(t, 10)
+
+				c.Write("a", "1")
+				c.Write("b", "22")
+				c.Write("b", "333")
+				c.Read("a")
+				c.Read("missing")
+				c.Peek("b")
+				c.Delete("a")
+
+				if c.Len() != 1 {
+					t.Fatalf("Expected 1 entry, got %d", c.Len())
+				}
+				want := Stats{Hits: 1, Misses: 1, Inserts: 2, Bytes: 4}
+				if stats := c.Stats(); stats != want {
+					t.Fatalf("Expected %+v, got %+v", want, stats)
+				}
+				if ratio := c.Stats().HitRatio(); ratio != 0.5 {
+					t.Fatalf("Expected a hit ratio of 0.5, got %v", ratio)
+				}
+			})
+
+			t.Run("keys start with the most used", func(t *testing.T) {
+				c := newCache(t, 10)
+
+				c.Write("a", "1")
+				c.Write("b", "2")
+				c.Write("c", "3")
+				c.Read("a")
+				c.Read("a")
+
+				keys := c.Keys()
+				if len(keys) != 3 || keys[0] != "a" {
+					t.Fatalf("Expected 3 keys starting with a, got %v", keys)
+				}
+				seen := make(map[string]bool)
+				for _, key := range keys {
+					seen[key] = true
+				}
+				if !seen["b"] || !seen["c"] {
+					t.Fatalf("Expected b and c to be listed, got %v", keys)
+				}
+			})
+
+			t.Run("entries expire after their time to live", func(t *testing.T) {
+				c := newCache(t, 10)
+
+				var expired []string
+				c.OnEvict(func(key string, value string, reason EvictReason) {
+					if reason == EvictExpired {
+						expired = append(expired, key)
+					}
+				})
+
+				c.WriteWithTTL("short", "1", time.Millisecond)
+				c.WriteWithTTL("long", "1", time.Hour)
+				c.WriteWithTTL("overwritten", "1", time.Millisecond)
+				c.Write("overwritten", "2")
+				time.Sleep(5 * time.Millisecond)
+
+				if _, ok := c.Peek("short"); ok {
+					t.Fatalf("Expected \"short\" to have expired")
+				}
+				if _, ok := c.Read("short"); ok {
+					t.Fatalf("Expected \"short\" to have expired")
+				}
+				for _, key := range []string{"long", "overwritten"} {
+					if _, ok := c.Read(key); !ok {
+						t.Fatalf("Expected %q to be cached", key)
+					}
+				}
+				if len(expired) != 1 || expired[0] != "short" || c.Len() != 2 {
+					t.Fatalf("Expected only \"short\" to be evicted, got %v and %d entries", expired, c.Len())
+				}
+			})
+
+			t.Run("holds at most its capacity", func(t *testing.T) {
+				c := newCache(t, 10)
+
+				evicted := 0
+				c.OnEvict(func(string, string, EvictReason) {
+					evicted++
+				})
+
+				for i := 0; i < 100; i++ {
+					c.Write(strconv.Itoa(i), strconv.Itoa(i))
+					c.Read(strconv.Itoa(i / 2))
+				}
+
+				cached, bytes := 0, int64(0)
+				for i := 0; i < 100; i++ {
+					if val, ok := c.Peek(strconv.Itoa(i)); ok {
+						cached++
+						bytes += ByteSize(strconv.Itoa(i), val)
+						if val != strconv.Itoa(i) {
+							t.Fatalf("Expected %d, got %s", i, val)
+						}
+					}
+				}
+				if cached == 0 || cached > 10 {
+					t.Fatalf("Expected between 1 and 10 cached entries, got %d", cached)
+				}
+				if cached+evicted != 100 {
+					t.Fatalf("Expected every entry to be either cached or evicted, got %d and %d", cached, evicted)
+				}
+				stats := c.Stats()
+				if c.Len() != cached || stats.Evictions != uint64(evicted) || stats.Inserts != 100 {
+					t.Fatalf("Expected %d entries, %d evictions and 100 inserts, got %d and %+v", cached, evicted, c.Len(), stats)
+				}
+				if stats.Bytes != bytes {
+					t.Fatalf("Expected the cached entries to weigh %d bytes, got %d", bytes, stats.Bytes)
+				}
+			})
+
+			t.Run("capacity of one", func(t *testing.T) {
+				c := newCache(t, 1)
+
+				c.Write("a", "1")
+				c.Read("a")
+				c.Write("b", "2")
+				c.Read("b")
+				c.Write("c", "3")
+
+				cached := 0
+				for _, key := range []string{"a", "b", "c"} {
+					if _, ok := c.Peek(key); ok {
+						cached++
+					}
+				}
+				if cached != 1 {
+					t.Fatalf("Expected 1 cached entry, got %d", cached)
+				}
+			})
+
+			t.Run("concurrent use", func(t *testing.T) {
+				c := newCache(t, 16)
+
+				var wg sync.WaitGroup
+				for g := 0; g < 8; g++ {
+					wg.Add(1)
+					go func(g int) {
+						defer wg.Done()
+						for i := 0; i < 1000; i++ {
+							key := strconv.Itoa((g*7 + i) % 40)
+							switch i % 5 {
+							case 0:
+								c.Write(key, key)
+							case 1:
+								c.Delete(key)
+							default:
+								if val, ok := c.Read(key); ok && val != key {
+									t.Errorf("Expected %s, got %s", key, val)
+								}
+							}
+						}
+					}(g)
+				}
+				wg.Wait()
+			})
+
+			t.Run("keys and values of other types", func(t *testing.T) {
+				type point struct{ x, y int }
+				c, _ := New[int, point](policy, 2)
+
+				var evicted []int
+				c.OnEvict(func(key int, value point, reason EvictReason) {
+					evicted = append(evicted, key)
+				})
+
+				c.Write(1, point{1, 2})
+				if val, ok := c.Read(1); !ok || val != (point{1, 2}) {
+					t.Fatalf("Expected {1 2}, got %v, %v", val, ok)
+				}
+				if val, ok := c.Read(2); ok || val != (point{}) {
+					t.Fatalf("Expected a miss with the zero value, got %v, %v", val, ok)
+				}
+				for i := 2; i <= 10; i++ {
+					c.Write(i, point{i, i})
+				}
+				if c.Len() > 2 || c.Len()+len(evicted) != 10 {
+					t.Fatalf("Expected every entry to be either cached or evicted, got %d and %v", c.Len(), evicted)
+				}
+				if bytes := c.Stats().Bytes; bytes != int64(c.Len())*ByteSize(0, point{}) {
+					t.Fatalf("Expected the bytes of %d entries, got %d", c.Len(), bytes)
+				}
+			})
+		})
+	}
+
+	t.Run("unknown policy", func(t *testing.T) {
+		if _, err := New[string, string]("fifo", 10); err == nil {
+			t.Fatalf("Expected an error for an unknown policy")
+		}
+	})
+
+	t.Run("weighted", func(t *testing.T) {
+		if _, err := NewWeighted(PolicyLRU, Weights[string, string]{MaxWeight: 100}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := NewWeighted(PolicyARC, Weights[string, string]{MaxWeight: 100}); err == nil {
+			t.Fatalf("Expected an error for a policy without weights")
+		}
+	})
+}
+
+func TestByteSize(t *testing.T) {
+	if size := ByteSize("key", "value"); size != 8 {
+		t.Fatalf("Expected 8 bytes for strings, got %d", size)
+	}
+	if size := ByteSize("key", []byte("value")); size != 8 {
+		t.Fatalf("Expected 8 bytes for byte slices, got %d", size)
+	}
+	if size := ByteSize(int32(1), int64(2)); size != 12 {
+		t.Fatalf("Expected 12 bytes for fixed size types, got %d", size)
+	}
+}
+
+func TestEvictionOrder(t *testing.T) {
+	t.Run("lfu evicts the least frequently used entry", func(t *testing.T) {
+		c := NewLFUCache[string, string](3)
+		c.Write("a", "1")
+		c.Write("b", "2")
+		c.Write("c", "3")
+		c.Read("a")
+		c.Read("a")
+		c.Read("c")
+
+		// b was used the least
+		c.Write("d", "4")
+		if _, ok := c.Peek("b"); ok {
+			t.Fatalf("Expected \"b\" to be evicted")
+		}
+
+		// d was used once, and c twice
+		c.Write("e", "5")
+		if _, ok := c.Peek("d"); ok {
+			t.Fatalf("Expected \"d\" to be evicted")
+		}
+		for _, key := range []string{"a", "c", "e"} {
+			if _, ok := c.Peek(key); !ok {
+				t.Fatalf("Expected %q to be cached", key)
+			}
+		}
+	})
+
+	t.Run("2q keeps reused entries through a scan", func(t *testing.T) {
+		c := NewTwoQueueCache[string, string](8)
+		c.Write("hot", "1")
+		c.Read("hot")
+
+		for i := 0; i < 100; i++ {
+			c.Write("scan"+strconv.Itoa(i), "v")
+		}
+		if _, ok := c.Peek("hot"); !ok {
+			t.Fatalf("Expected \"hot\" to survive the scan")
+		}
+	})
+
+	t.Run("2q admits keys written again after eviction to frequent", func(t *testing.T) {
+		c := NewTwoQueueCache[string, string](8)
+		for i := 0; i < 10; i++ {
+			c.Write(strconv.Itoa(i), "v")
+		}
+		if _, ok := c.recentGhost.get("0"); !ok {
+			t.Fatalf("Expected \"0\" to be remembered after its eviction")
+		}
+
+		c.Write("0", "v")
+		if _, ok := c.frequent.get("0"); !ok {
+			t.Fatalf("Expected \"0\" to be added to frequent")
+		}
+	})
+
+	t.Run("arc keeps reused entries through a scan", func(t *testing.T) {
+		c := NewARCCache[string, string](8)
+		c.Write("hot", "1")
+		c.Read("hot")
+
+		for i := 0; i < 100; i++ {
+			c.Write("scan"+strconv.Itoa(i), "v")
+		}
+		if _, ok := c.Peek("hot"); !ok {
+			t.Fatalf("Expected \"hot\" to survive the scan")
+		}
+	})
+
+	t.Run("tinylfu rejects entries used less than the ones they replace", func(t *testing.T) {
+		c := NewTinyLFUCache[string, string](100)
+
+		rejected := 0
+		c.OnEvict(func(key string, value string, reason EvictReason) {
+			if reason == EvictRejected {
+				rejected++
+			}
+		})
+		for i := 0; i < 100; i++ {
+			key := "hot" + strconv.Itoa(i)
+			c.Write(key, "v")
+			for j := 0; j < 3; j++ {
+				c.Read(key)
+			}
+		}
+
+		for i := 0; i < 1000; i++ {
+			c.Write("once"+strconv.Itoa(i), "v")
+		}
+
+		// LRU would keep none of them. Estimates are approximate, so a few
+		// entries used once may still be admitted.
+		cached := 0
+		for i := 0; i < 100; i++ {
+			if _, ok := c.Peek("hot" + strconv.Itoa(i)); ok {
+				cached++
+			}
+		}
+		if cached < 90 {
+			t.Fatalf("Expected at least 90 hot entries to stay cached, got %d", cached)
+		}
+		if stats := c.Stats(); stats.Evictions != 1000 || c.Len() != 100 {
+			t.Fatalf("Expected 100 entries and 1000 evictions, got %d and %+v", c.Len(), stats)
+		}
+		if rejected < 900 {
+			t.Fatalf("Expected at least 900 entries to be rejected, got %d", rejected)
+		}
+	})
+}
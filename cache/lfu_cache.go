@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LFUCache evicts the least frequently used entry, and the least recently used
+// one among those. Entries are grouped in buckets of equal use counts, kept in
+// increasing order, so that every operation takes constant time.
+type LFUCache[K comparable, V any] struct {
+	buckets  *list.List
+	elements map[K]*list.Element
+	capacity int
+	onEvict  EvictFunc[K, V]
+	stats    counters[K, V]
+	mu       sync.Mutex
+}
+
+// lfuBucket holds the entries used count times, from the most to the least recently used.
+type lfuBucket struct {
+	count   int
+	entries *list.List
+}
+
+// lfuEntry is an entry of an LFUCache, along with the bucket holding it.
+type lfuEntry[K comparable, V any] struct {
+	entry[K, V]
+	bucket *list.Element
+}
+
+func NewLFUCache[K comparable, V any](capacity int) *LFUCache[K, V] {
+	return &LFUCache[K, V]{
+		buckets:  list.New(),
+		elements: make(map[K]*list.Element),
+		capacity: capacity,
+		mu:       sync.Mutex{},
+	}
+}
+
+// use moves the entry e to the bucket of the next use count.
+func (c *LFUCache[K, V]) use(e *list.Element) {
+	le := e.Value.(*lfuEntry[K, V])
+	b := le.bucket.Value.(*lfuBucket)
+
+	next := le.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket).count != b.count+1 {
+		next = c.buckets.InsertAfter(&lfuBucket{count: b.count + 1, entries: list.New()}, le.bucket)
+	}
+
+	b.entries.Remove(e)
+	if b.entries.Len() == 0 {
+		c.buckets.Remove(le.bucket)
+	}
+	le.bucket = next
+	c.elements[le.key] = next.Value.(*lfuBucket).entries.PushFront(le)
+}
+
+// remove removes the entry e from its bucket.
+func (c *LFUCache[K, V]) remove(e *list.Element) {
+	le := e.Value.(*lfuEntry[K, V])
+	b := le.bucket.Value.(*lfuBucket)
+
+	b.entries.Remove(e)
+	if b.entries.Len() == 0 {
+		c.buckets.Remove(le.bucket)
+	}
+	delete(c.elements, le.key)
+	c.stats.remove(le.key, le.val)
+}
+
+func (c *LFUCache[K, V]) Read(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.elements[key]
+	if ok && e.Value.(*lfuEntry[K, V]).expired(time.Now()) {
+		le := e.Value.(*lfuEntry[K, V])
+		c.remove(e)
+		c.stats.evict(c.onEvict, le.key, le.val, EvictExpired)
+		ok = false
+	}
+
+	c.stats.read(ok)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.use(e)
+	return e.Value.(*lfuEntry[K, V]).val, true
+}
+
+func (c *LFUCache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.elements[key]
+	if !ok || e.Value.(*lfuEntry[K, V]).expired(time.Now()) {
+		var zero V
+		return zero, false
+	}
+	return e.Value.(*lfuEntry[K, V]).val, true
+}
+
+func (c *LFUCache[K, V]) Write(key K, value V) {
+	c.write(key, value, time.Time{})
+}
+
+func (c *LFUCache[K, V]) WriteWithTTL(key K, value V, ttl time.Duration) {
+	c.write(key, value, time.Now().Add(ttl))
+}
+
+// write replaces the value of key, which expires at expires, or never if
+// expires is zero.
+func (c *LFUCache[K, V]) write(key K, value V, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.elements[key]; ok {
+		le := e.Value.(*lfuEntry[K, V])
+		c.stats.remove(key, le.val)
+		c.stats.insert(key, value, false)
+		le.val, le.expires = value, expires
+		c.use(e)
+		return
+	}
+	if c.capacity <= 0 {
+		return
+	}
+
+	if len(c.elements) >= c.capacity {
+		// The least recently used entry of the lowest use count
+		victim := c.buckets.Front().Value.(*lfuBucket).entries.Back()
+		le := victim.Value.(*lfuEntry[K, V])
+		c.remove(victim)
+		c.stats.evict(c.onEvict, le.key, le.val, le.evictReason(time.Now()))
+	}
+
+	first := c.buckets.Front()
+	if first == nil || first.Value.(*lfuBucket).count != 1 {
+		first = c.buckets.PushFront(&lfuBucket{count: 1, entries: list.New()})
+	}
+	le := &lfuEntry[K, V]{entry: entry[K, V]{key: key, val: value, expires: expires}, bucket: first}
+	c.elements[key] = first.Value.(*lfuBucket).entries.PushFront(le)
+	c.stats.insert(key, value, true)
+}
+
+func (c *LFUCache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.elements[key]; ok {
+		c.remove(e)
+	}
+}
+
+func (c *LFUCache[K, V]) OnEvict(fn EvictFunc[K, V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onEvict = fn
+}
+
+func (c *LFUCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.elements)
+}
+
+func (c *LFUCache[K, V]) Stats() Stats {
+	return c.stats.stats()
+}
+
+// Keys returns the keys from the most to the least frequently used, and from the
+// most to the least recently used among those.
+func (c *LFUCache[K, V]) Keys() []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]K, 0, len(c.elements))
+	for b := c.buckets.Back(); b != nil; b = b.Prev() {
+		for e := b.Value.(*lfuBucket).entries.Front(); e != nil; e = e.Next() {
+			keys = append(keys, e.Value.(*lfuEntry[K, V]).key)
+		}
+	}
+	return keys
+}
@@ -2,74 +2,259 @@ package cache
 
 import (
 	"container/list"
+	"math"
 	"sync"
+	"time"
 )
 
-type entry struct {
-	key string
-	val string
+type entry[K comparable, V any] struct {
+	key     K
+	val     V
+	expires time.Time
 }
 
-type LRUCache struct {
-	store    *list.List
-	elements map[string]*list.Element
-	capacity int
-	mu       sync.RWMutex
+// expired reports whether e has a time to live, which is over at now.
+func (e *entry[K, V]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
 }
 
-func (c *LRUCache) evict() {
-	for len(c.elements) > c.capacity {
-		lru := c.store.Back()
-		e := c.store.Remove(lru)
-		delete(c.elements, e.(*entry).key)
+// evictReason returns the reason for evicting e to make room at now.
+func (e *entry[K, V]) evictReason(now time.Time) EvictReason {
+	if e.expired(now) {
+		return EvictExpired
 	}
+	return EvictCapacity
 }
 
-func NewLRUCache(capacity int) *LRUCache {
-	return &LRUCache{
-		elements: make(map[string]*list.Element),
-		store:    list.New(),
-		capacity: capacity,
-		mu:       sync.RWMutex{},
+// readBufferSize is the number of reads an LRUCache records before applying them.
+const readBufferSize = 64
+
+// LRUCache evicts the least recently used entries. Reads only take the read
+// lock: instead of moving the entry they read to the front of the list right
+// away, they record it in a buffer of reads, which is applied to the list on
+// the next write, or by the read that fills it. When the buffer is full and
+// another goroutine holds the lock, the read is not recorded, so recency is
+// approximate under heavy contention.
+//
+// A weighted LRUCache is bounded by the total weight of its entries instead of
+// their number.
+type LRUCache[K comparable, V any] struct {
+	store          *list.List
+	elements       map[K]*list.Element
+	capacity       int
+	weigher        Weigher[K, V]
+	weight         int64
+	maxWeight      int64
+	maxEntryWeight int64
+	onEvict        EvictFunc[K, V]
+	stats          counters[K, V]
+	reads          chan *list.Element
+	mu             sync.RWMutex
+}
+
+// promote records a read of e, applying the buffered reads if the buffer is full.
+// The caller must not hold mu.
+func (c *LRUCache[K, V]) promote(e *list.Element) {
+	select {
+	case c.reads <- e:
+		return
+	default:
+	}
+
+	if c.mu.TryLock() {
+		c.applyReads()
+		c.store.MoveToFront(e)
+		c.mu.Unlock()
+	}
+}
+
+// applyReads moves the entries read since the last call to the front of the
+// list, in the order they were read. Entries removed since they were read are
+// skipped by MoveToFront. The caller must hold mu for writing.
+func (c *LRUCache[K, V]) applyReads() {
+	for {
+		select {
+		case e := <-c.reads:
+			c.store.MoveToFront(e)
+		default:
+			return
+		}
+	}
+}
+
+// weigh returns the weight of an entry, which is always 0 unless the cache is weighted.
+func (c *LRUCache[K, V]) weigh(key K, value V) int64 {
+	if c.weigher == nil {
+		return 0
+	}
+	return c.weigher(key, value)
+}
+
+// full reports whether the cache holds more entries, or more weight, than it can.
+func (c *LRUCache[K, V]) full() bool {
+	return len(c.elements) > c.capacity || c.weight > c.maxWeight
+}
+
+// remove removes the entry of e from the cache. The caller must hold mu for writing.
+func (c *LRUCache[K, V]) remove(e *list.Element) *entry[K, V] {
+	en := c.store.Remove(e).(*entry[K, V])
+	delete(c.elements, en.key)
+	c.weight -= c.weigh(en.key, en.val)
+	c.stats.remove(en.key, en.val)
+	return en
+}
+
+func (c *LRUCache[K, V]) evict() {
+	for c.full() {
+		e := c.remove(c.store.Back())
+		c.stats.evict(c.onEvict, e.key, e.val, e.evictReason(time.Now()))
+	}
+}
+
+func NewLRUCache[K comparable, V any](capacity int) *LRUCache[K, V] {
+	return &LRUCache[K, V]{
+		elements:       make(map[K]*list.Element),
+		store:          list.New(),
+		capacity:       capacity,
+		maxWeight:      math.MaxInt64,
+		maxEntryWeight: math.MaxInt64,
+		reads:          make(chan *list.Element, readBufferSize),
+		mu:             sync.RWMutex{},
+	}
+}
+
+// NewWeightedLRUCache creates an LRU cache holding entries up to a total weight
+// of weights.MaxWeight, however many there are.
+func NewWeightedLRUCache[K comparable, V any](weights Weights[K, V]) *LRUCache[K, V] {
+	c := NewLRUCache[K, V](math.MaxInt)
+	c.weigher = weights.weigher()
+	c.maxWeight = weights.MaxWeight
+	c.maxEntryWeight = weights.maxEntryWeight()
+	return c
+}
+
+// expire evicts the expired entry e, unless it was removed since it was read.
+// The caller must not hold mu.
+func (c *LRUCache[K, V]) expire(e *list.Element) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	en := e.Value.(*entry[K, V])
+	if c.elements[en.key] != e {
+		return
 	}
+	c.remove(e)
+	c.stats.evict(c.onEvict, en.key, en.val, EvictExpired)
 }
 
-func (c *LRUCache) Read(key string) (string, bool) {
+// Read returns the value of key and marks it as the most recently used.
+func (c *LRUCache[K, V]) Read(key K) (V, bool) {
+	c.mu.RLock()
+	e, ok := c.elements[key]
+	c.mu.RUnlock()
+
+	// Entries are never modified, only replaced, so e can be read without the lock
+	if ok && e.Value.(*entry[K, V]).expired(time.Now()) {
+		c.expire(e)
+		ok = false
+	}
+
+	c.stats.read(ok)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.promote(e)
+	return e.Value.(*entry[K, V]).val, true
+}
+
+// Peek returns the value of key without changing its recency.
+func (c *LRUCache[K, V]) Peek(key K) (V, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	val, ok := c.elements[key]
 
-	if ok {
-		return val.Value.(*entry).val, ok
+	e, ok := c.elements[key]
+	if !ok || e.Value.(*entry[K, V]).expired(time.Now()) {
+		var zero V
+		return zero, false
 	}
+	return e.Value.(*entry[K, V]).val, true
+}
+
+func (c *LRUCache[K, V]) Write(key K, value V) {
+	c.write(key, value, time.Time{})
+}
 
-	return "", false
+func (c *LRUCache[K, V]) WriteWithTTL(key K, value V, ttl time.Duration) {
+	c.write(key, value, time.Now().Add(ttl))
 }
 
-func (c *LRUCache) Write(key string, value string) {
+// write replaces the value of key, which expires at expires, or never if
+// expires is zero.
+func (c *LRUCache[K, V]) write(key K, value V, expires time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	val, ok := c.elements[key]
-	if ok {
-		c.store.Remove(val)
+	// Apply the buffered reads first, so that they count towards eviction
+	c.applyReads()
+
+	e, cached := c.elements[key]
+	if cached {
+		c.remove(e)
+	}
+
+	// An entry too heavy to be cached is evicted right away, instead of the
+	// entries it would push out
+	weight := c.weigh(key, value)
+	if weight > c.maxEntryWeight {
+		c.stats.evict(c.onEvict, key, value, EvictRejected)
+		return
 	}
 
-	elem := c.store.PushFront(&entry{key, value})
-	c.elements[key] = elem
+	c.elements[key] = c.store.PushFront(&entry[K, V]{key: key, val: value, expires: expires})
+	c.weight += weight
+	c.stats.insert(key, value, !cached)
 
-	if len(c.elements) > c.capacity {
+	if c.full() {
 		c.evict()
 	}
 }
 
-func (c *LRUCache) Delete(key string) {
+func (c *LRUCache[K, V]) Delete(key K) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	e, ok := c.elements[key]
-	if ok {
-		delete(c.elements, key)
-		c.store.Remove(e)
+	if e, ok := c.elements[key]; ok {
+		c.remove(e)
+	}
+}
+
+func (c *LRUCache[K, V]) OnEvict(fn EvictFunc[K, V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onEvict = fn
+}
+
+func (c *LRUCache[K, V]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.elements)
+}
+
+func (c *LRUCache[K, V]) Stats() Stats {
+	return c.stats.stats()
+}
+
+func (c *LRUCache[K, V]) Keys() []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.applyReads()
+	keys := make([]K, 0, len(c.elements))
+	for e := c.store.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(*entry[K, V]).key)
 	}
+	return keys
 }
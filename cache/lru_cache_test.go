@@ -1,13 +1,16 @@
 package cache
 
 import (
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewLRUCache(t *testing.T) {
 	capacity := 10
 
-	cache := NewLRUCache(capacity)
+	cache := NewLRUCache[string, string](capacity)
 
 	if cache.capacity != 10 {
 		t.Fatalf("Expected capacity %d, got %d.", capacity, cache.capacity)
@@ -15,12 +18,12 @@ func TestNewLRUCache(t *testing.T) {
 }
 
 func TestRead(t *testing.T) {
-	cache := NewLRUCache(10)
+	cache := NewLRUCache[string, string](10)
 
 	t.Run("returns correct value for cache hit", func(t *testing.T) {
 		key := "abc"
 		expectedVal := "def"
-		cache.elements[key] = cache.store.PushFront(&entry{key, expectedVal})
+		cache.elements[key] = cache.store.PushFront(&entry[string, string]{key: key, val: expectedVal})
 
 		val, ok := cache.Read(key)
 
@@ -46,7 +49,7 @@ func TestRead(t *testing.T) {
 
 func TestWrite(t *testing.T) {
 	t.Run("updates map state correctly", func(t *testing.T) {
-		cache := NewLRUCache(10)
+		cache := NewLRUCache[string, string](10)
 
 		cache.Write("123", "456")
 		cache.Write("some_key", "someVal")
@@ -69,14 +72,14 @@ func TestWrite(t *testing.T) {
 
 		for _, p := range pairs {
 			actual := cache.elements[p.key]
-			if actual.Value.(*entry).val != p.val {
-				t.Fatalf("Wrong value for key %s. Expected %s, got %s", p.key, p.val, actual.Value.(*entry).val)
+			if actual.Value.(*entry[string, string]).val != p.val {
+				t.Fatalf("Wrong value for key %s. Expected %s, got %s", p.key, p.val, actual.Value.(*entry[string, string]).val)
 			}
 		}
 	})
 
 	t.Run("triggers eviction when cache is full", func(t *testing.T) {
-		cache := NewLRUCache(1)
+		cache := NewLRUCache[string, string](1)
 
 		cache.Write("1", "11")
 
@@ -110,7 +113,7 @@ func TestWrite(t *testing.T) {
 	})
 
 	t.Run("does not trigger eviction when cache is not full", func(t *testing.T) {
-		cache := NewLRUCache(2)
+		cache := NewLRUCache[string, string](2)
 
 		cache.Write("1", "11")
 
@@ -146,7 +149,7 @@ func TestWrite(t *testing.T) {
 
 func TestDelete(t *testing.T) {
 	t.Run("deletes existing key from cache", func(t *testing.T) {
-		cache := NewLRUCache(2)
+		cache := NewLRUCache[string, string](2)
 		cache.Write("key1", "val1")
 		cache.Write("key2", "val2")
 
@@ -166,7 +169,7 @@ func TestDelete(t *testing.T) {
 	})
 
 	t.Run("does not affect nonexistent key", func(t *testing.T) {
-		cache := NewLRUCache(2)
+		cache := NewLRUCache[string, string](2)
 		cache.Write("key1", "val1")
 
 		cache.Delete("nonexistent_key")
@@ -176,3 +179,262 @@ func TestDelete(t *testing.T) {
 		}
 	})
 }
+
+func TestOnEvict(t *testing.T) {
+	t.Run("called for evicted entries", func(t *testing.T) {
+		cache := NewLRUCache[string, string](1)
+
+		var evicted []string
+		cache.OnEvict(func(key string, value string, reason EvictReason) {
+			evicted = append(evicted, key+"="+value)
+		})
+
+		cache.Write("1", "11")
+		cache.Write("2", "22")
+
+		if len(evicted) != 1 || evicted[0] != "1=11" {
+			t.Fatalf("Expected [1=11] to be evicted, got %v", evicted)
+		}
+	})
+
+	t.Run("tells why entries are evicted", func(t *testing.T) {
+		cache := NewWeightedLRUCache(Weights[string, string]{MaxWeight: 4, MaxEntryWeight: 3})
+
+		reasons := make(map[string]EvictReason)
+		cache.OnEvict(func(key string, value string, reason EvictReason) {
+			reasons[key] = reason
+		})
+
+		cache.Write("a", "1")
+		cache.Write("b", "2")
+		cache.Write("c", "3")
+		cache.Write("d", "444")
+
+		if reasons["a"] != EvictCapacity || reasons["d"] != EvictRejected || len(reasons) != 2 {
+			t.Fatalf("Expected a to be evicted for capacity and d to be rejected, got %v", reasons)
+		}
+	})
+
+	t.Run("expired entries evicted to make room are reported as expired", func(t *testing.T) {
+		cache := NewLRUCache[string, string](1)
+
+		var reasons []EvictReason
+		cache.OnEvict(func(key string, value string, reason EvictReason) {
+			reasons = append(reasons, reason)
+		})
+
+		cache.WriteWithTTL("1", "11", time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+		cache.Write("2", "22")
+
+		if len(reasons) != 1 || reasons[0] != EvictExpired {
+			t.Fatalf("Expected [expired], got %v", reasons)
+		}
+	})
+
+	t.Run("not called for overwrites and deletes", func(t *testing.T) {
+		cache := NewLRUCache[string, string](1)
+
+		calls := 0
+		cache.OnEvict(func(string, string, EvictReason) {
+			calls++
+		})
+
+		cache.Write("1", "11")
+		cache.Write("1", "12")
+		cache.Delete("1")
+
+		if calls != 0 {
+			t.Fatalf("Expected no evictions, got %d", calls)
+		}
+	})
+}
+
+func TestReadPromotion(t *testing.T) {
+	t.Run("hot-read keys survive eviction", func(t *testing.T) {
+		cache := NewLRUCache[string, string](3)
+		cache.Write("a", "1")
+		cache.Write("b", "2")
+		cache.Write("c", "3")
+
+		cache.Read("a")
+		cache.Write("d", "4")
+
+		if _, ok := cache.Read("a"); !ok {
+			t.Fatalf("Expected recently read key \"a\" to survive eviction")
+		}
+		if _, ok := cache.Read("b"); ok {
+			t.Fatalf("Expected least recently used key \"b\" to be evicted")
+		}
+	})
+
+	t.Run("peek does not promote", func(t *testing.T) {
+		cache := NewLRUCache[string, string](2)
+		cache.Write("a", "1")
+		cache.Write("b", "2")
+
+		if val, ok := cache.Peek("a"); !ok || val != "1" {
+			t.Fatalf("Expected value 1, got %s, %v", val, ok)
+		}
+		cache.Write("c", "3")
+
+		if _, ok := cache.Peek("a"); ok {
+			t.Fatalf("Expected peeked key \"a\" to be evicted")
+		}
+		if _, ok := cache.Peek("missing"); ok {
+			t.Fatalf("Expected ok = false for a missing key")
+		}
+	})
+
+	t.Run("reads are applied when the buffer is full", func(t *testing.T) {
+		cache := NewLRUCache[string, string](2)
+		cache.Write("a", "1")
+		cache.Write("b", "2")
+
+		for i := 0; i < readBufferSize+1; i++ {
+			cache.Read("a")
+		}
+
+		if front := cache.store.Front().Value.(*entry[string, string]).key; front != "a" {
+			t.Fatalf("Expected \"a\" to be the most recently used key, got %s", front)
+		}
+	})
+
+	t.Run("hot keys survive a scan of cold keys", func(t *testing.T) {
+		cache := NewLRUCache[string, string](10)
+		for i := 0; i < 5; i++ {
+			cache.Write("hot"+strconv.Itoa(i), "v")
+		}
+
+		for i := 0; i < 100; i++ {
+			for j := 0; j < 5; j++ {
+				cache.Read("hot" + strconv.Itoa(j))
+			}
+			cache.Write("cold"+strconv.Itoa(i), "v")
+		}
+
+		for i := 0; i < 5; i++ {
+			if _, ok := cache.Peek("hot" + strconv.Itoa(i)); !ok {
+				t.Fatalf("Expected hot key %d to survive eviction", i)
+			}
+		}
+	})
+
+	t.Run("concurrent reads and writes", func(t *testing.T) {
+		cache := NewLRUCache[string, string](16)
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					key := strconv.Itoa((g + i) % 32)
+					if i%4 == 0 {
+						cache.Write(key, key)
+					} else if val, ok := cache.Read(key); ok && val != key {
+						t.Errorf("Expected value %s, got %s", key, val)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		if len(cache.elements) > 16 || cache.store.Len() != len(cache.elements) {
+			t.Fatalf("Expected at most 16 consistent entries, got %d in map and %d in list",
+				len(cache.elements), cache.store.Len())
+		}
+	})
+}
+
+func TestWeightedLRUCache(t *testing.T) {
+	t.Run("evicts until under the total weight", func(t *testing.T) {
+		cache := NewWeightedLRUCache(Weights[string, string]{MaxWeight: 20, MaxEntryWeight: 20})
+
+		var evicted []string
+		cache.OnEvict(func(key string, value string, reason EvictReason) {
+			evicted = append(evicted, key)
+		})
+
+		cache.Write("a", "123456789")
+		cache.Write("b", "1")
+		cache.Write("c", "1")
+		if len(evicted) != 0 || cache.weight != 14 {
+			t.Fatalf("Expected no evictions and a weight of 14, got %v and %d", evicted, cache.weight)
+		}
+
+		// Both a and b have to go to make room
+		cache.Write("d", "1234567890123456")
+		if len(evicted) != 2 || evicted[0] != "a" || evicted[1] != "b" {
+			t.Fatalf("Expected [a b] to be evicted, got %v", evicted)
+		}
+		if cache.weight != 19 {
+			t.Fatalf("Expected a weight of 19, got %d", cache.weight)
+		}
+	})
+
+	t.Run("many small entries fit where few large ones do", func(t *testing.T) {
+		cache := NewWeightedLRUCache(Weights[string, string]{MaxWeight: 1000})
+
+		for i := 0; i < 100; i++ {
+			cache.Write(strconv.Itoa(i%10), "123456789")
+		}
+		if len(cache.elements) != 10 {
+			t.Fatalf("Expected 10 small entries, got %d", len(cache.elements))
+		}
+	})
+
+	t.Run("overwrites and deletes update the weight", func(t *testing.T) {
+		cache := NewWeightedLRUCache(Weights[string, string]{MaxWeight: 100})
+
+		cache.Write("key", "1")
+		cache.Write("key", "12345")
+		if cache.weight != 8 {
+			t.Fatalf("Expected a weight of 8, got %d", cache.weight)
+		}
+		cache.Delete("key")
+		if cache.weight != 0 {
+			t.Fatalf("Expected a weight of 0, got %d", cache.weight)
+		}
+	})
+
+	t.Run("entries over the entry weight are not cached", func(t *testing.T) {
+		cache := NewWeightedLRUCache(Weights[string, string]{MaxWeight: 80})
+
+		var evicted []string
+		cache.OnEvict(func(key string, value string, reason EvictReason) {
+			evicted = append(evicted, key)
+		})
+
+		cache.Write("a", "1")
+		cache.Write("huge", "1")
+		cache.Write("huge", "123456789")
+
+		// The default entry weight is an eighth of the total
+		if _, ok := cache.Peek("huge"); ok {
+			t.Fatalf("Expected \"huge\" not to be cached")
+		}
+		if _, ok := cache.Peek("a"); !ok {
+			t.Fatalf("Expected \"a\" to stay cached")
+		}
+		if len(evicted) != 1 || evicted[0] != "huge" {
+			t.Fatalf("Expected [huge] to be evicted, got %v", evicted)
+		}
+	})
+
+	t.Run("custom weigher", func(t *testing.T) {
+		cache := NewWeightedLRUCache(Weights[string, string]{
+			MaxWeight: 3,
+			Weigher: func(key string, value string) int64 {
+				return int64(len(value))
+			},
+		})
+
+		cache.Write("longer key", "1")
+		cache.Write("key", "22")
+		cache.Write("other", "3")
+		if _, ok := cache.Peek("longer key"); ok {
+			t.Fatalf("Expected \"longer key\" to be evicted")
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"container/list"
+	"time"
+)
+
+// orderedList keeps entries from the most to the least recently added or
+// moved, indexed by key. It is the building block of the caches made of
+// several LRU lists, and is not safe for concurrent use.
+type orderedList[K comparable, V any] struct {
+	order    *list.List
+	elements map[K]*list.Element
+}
+
+func newOrderedList[K comparable, V any]() *orderedList[K, V] {
+	return &orderedList[K, V]{order: list.New(), elements: make(map[K]*list.Element)}
+}
+
+func (l *orderedList[K, V]) len() int {
+	return len(l.elements)
+}
+
+// get returns the entry of key, without changing its position.
+func (l *orderedList[K, V]) get(key K) (*entry[K, V], bool) {
+	e, ok := l.elements[key]
+	if !ok {
+		return nil, false
+	}
+	return e.Value.(*entry[K, V]), true
+}
+
+// pushFront adds key with value, expiring at expires, at the front of the list,
+// replacing any previous entry.
+func (l *orderedList[K, V]) pushFront(key K, value V, expires time.Time) *entry[K, V] {
+	return l.push(&entry[K, V]{key: key, val: value, expires: expires})
+}
+
+// push adds e at the front of the list, replacing any previous entry with its key.
+// Moving entries between lists with push keeps them identical.
+func (l *orderedList[K, V]) push(e *entry[K, V]) *entry[K, V] {
+	l.remove(e.key)
+	l.elements[e.key] = l.order.PushFront(e)
+	return e
+}
+
+// moveToFront moves key to the front of the list, if present.
+func (l *orderedList[K, V]) moveToFront(key K) {
+	if e, ok := l.elements[key]; ok {
+		l.order.MoveToFront(e)
+	}
+}
+
+// remove removes key from the list and returns its entry, if present.
+func (l *orderedList[K, V]) remove(key K) (*entry[K, V], bool) {
+	e, ok := l.elements[key]
+	if !ok {
+		return nil, false
+	}
+	l.order.Remove(e)
+	delete(l.elements, key)
+	return e.Value.(*entry[K, V]), true
+}
+
+// back returns the entry at the back of the list, if any.
+func (l *orderedList[K, V]) back() (*entry[K, V], bool) {
+	e := l.order.Back()
+	if e == nil {
+		return nil, false
+	}
+	return e.Value.(*entry[K, V]), true
+}
+
+// removeBack removes the entry at the back of the list and returns it, if any.
+func (l *orderedList[K, V]) removeBack() (*entry[K, V], bool) {
+	e, ok := l.back()
+	if !ok {
+		return nil, false
+	}
+	return l.remove(e.key)
+}
+
+// keys returns the keys of the list, from the front to the back.
+func (l *orderedList[K, V]) keys() []K {
+	keys := make([]K, 0, l.len())
+	for e := l.order.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(*entry[K, V]).key)
+	}
+	return keys
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"fmt"
+	"hash/maphash"
+	"time"
+)
+
+// ShardedCache spreads keys over several LRUCache shards by key hash, so that
+// writes to different shards don't contend for the same lock. The capacity is
+// split evenly between the shards, and each shard evicts its own least recently
+// used entries: the cache as a whole holds at most its capacity, but evicts
+// only approximately in LRU order, and sooner than a single LRUCache when keys
+// aren't spread evenly.
+type ShardedCache[K comparable, V any] struct {
+	shards []*LRUCache[K, V]
+	mask   uint64
+	seed   maphash.Seed
+}
+
+// NewShardedCache creates a cache holding at most capacity entries, split
+// between the given number of shards, which must be a power of two.
+func NewShardedCache[K comparable, V any](shards int, capacity int) (*ShardedCache[K, V], error) {
+	return newShardedCache(shards, func(i int) *LRUCache[K, V] {
+		// Shards get one more entry each until the remainder is used up
+		share := capacity / shards
+		if i < capacity%shards {
+			share++
+		}
+		return NewLRUCache[K, V](share)
+	})
+}
+
+// NewWeightedShardedCache creates a cache holding entries up to a total weight
+// of weights.MaxWeight, split between the given number of shards, which must be
+// a power of two.
+func NewWeightedShardedCache[K comparable, V any](shards int, weights Weights[K, V]) (*ShardedCache[K, V], error) {
+	return newShardedCache(shards, func(i int) *LRUCache[K, V] {
+		share := weights
+		share.MaxWeight = weights.MaxWeight / int64(shards)
+		share.MaxEntryWeight = min(weights.maxEntryWeight(), share.MaxWeight)
+		return NewWeightedLRUCache(share)
+	})
+}
+
+func newShardedCache[K comparable, V any](shards int, newShard func(i int) *LRUCache[K, V]) (*ShardedCache[K, V], error) {
+	if shards <= 0 || shards&(shards-1) != 0 {
+		return nil, fmt.Errorf("shard count %d is not a power of two", shards)
+	}
+
+	c := &ShardedCache[K, V]{
+		shards: make([]*LRUCache[K, V], shards),
+		mask:   uint64(shards - 1),
+		seed:   maphash.MakeSeed(),
+	}
+	for i := range c.shards {
+		c.shards[i] = newShard(i)
+	}
+	return c, nil
+}
+
+// shard returns the shard holding key.
+func (c *ShardedCache[K, V]) shard(key K) *LRUCache[K, V] {
+	return c.shards[maphash.Comparable(c.seed, key)&c.mask]
+}
+
+func (c *ShardedCache[K, V]) Read(key K) (V, bool) {
+	return c.shard(key).Read(key)
+}
+
+func (c *ShardedCache[K, V]) Peek(key K) (V, bool) {
+	return c.shard(key).Peek(key)
+}
+
+func (c *ShardedCache[K, V]) Write(key K, value V) {
+	c.shard(key).Write(key, value)
+}
+
+func (c *ShardedCache[K, V]) WriteWithTTL(key K, value V, ttl time.Duration) {
+	c.shard(key).WriteWithTTL(key, value, ttl)
+}
+
+func (c *ShardedCache[K, V]) Delete(key K) {
+	c.shard(key).Delete(key)
+}
+
+// OnEvict sets fn on every shard. fn may be called concurrently for entries of
+// different shards.
+func (c *ShardedCache[K, V]) OnEvict(fn EvictFunc[K, V]) {
+	for _, shard := range c.shards {
+		shard.OnEvict(fn)
+	}
+}
+
+func (c *ShardedCache[K, V]) Len() int {
+	n := 0
+	for _, shard := range c.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// Stats returns the sum of the statistics of the shards.
+func (c *ShardedCache[K, V]) Stats() Stats {
+	var stats Stats
+	for _, shard := range c.shards {
+		stats = stats.add(shard.Stats())
+	}
+	return stats
+}
+
+// Keys interleaves the keys of the shards, so that the most recently used keys
+// of every shard come first.
+func (c *ShardedCache[K, V]) Keys() []K {
+	shardKeys := make([][]K, len(c.shards))
+	n := 0
+	for i, shard := range c.shards {
+		shardKeys[i] = shard.Keys()
+		n = max(n, len(shardKeys[i]))
+	}
+
+	var keys []K
+	for j := 0; j < n; j++ {
+		for _, sk := range shardKeys {
+			if j < len(sk) {
+				keys = append(keys, sk[j])
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardedCache(t *testing.T) {
+	t.Run("shard count must be a power of two", func(t *testing.T) {
+		for _, shards := range []int{0, -1, 3, 12} {
+			if _, err := NewShardedCache[string, string](shards, 100); err == nil {
+				t.Fatalf("Expected an error for %d shards", shards)
+			}
+		}
+	})
+
+	t.Run("capacity is split between the shards", func(t *testing.T) {
+		cache, err := NewShardedCache[string, string](4, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		total := 0
+		for _, shard := range cache.shards {
+			if shard.capacity < 2 || shard.capacity > 3 {
+				t.Fatalf("Expected a shard capacity of 2 or 3, got %d", shard.capacity)
+			}
+			total += shard.capacity
+		}
+		if total != 10 {
+			t.Fatalf("Expected a total capacity of 10, got %d", total)
+		}
+	})
+
+	t.Run("read, write and delete", func(t *testing.T) {
+		cache, _ := NewShardedCache[string, string](8, 1000)
+
+		for i := 0; i < 50; i++ {
+			cache.Write(strconv.Itoa(i), strconv.Itoa(i))
+		}
+		for i := 0; i < 50; i++ {
+			if val, ok := cache.Read(strconv.Itoa(i)); !ok || val != strconv.Itoa(i) {
+				t.Fatalf("Expected %d, got %s, %v", i, val, ok)
+			}
+		}
+
+		cache.Delete("7")
+		if _, ok := cache.Peek("7"); ok {
+			t.Fatalf("Expected key to be deleted")
+		}
+	})
+
+	t.Run("holds at most its capacity", func(t *testing.T) {
+		cache, _ := NewShardedCache[string, string](4, 40)
+
+		var evicted atomic.Int64
+		cache.OnEvict(func(string, string, EvictReason) {
+			evicted.Add(1)
+		})
+
+		for i := 0; i < 1000; i++ {
+			cache.Write(strconv.Itoa(i), "v")
+		}
+
+		cached := 0
+		for i := 0; i < 1000; i++ {
+			if _, ok := cache.Peek(strconv.Itoa(i)); ok {
+				cached++
+			}
+		}
+		if cached > 40 {
+			t.Fatalf("Expected at most 40 cached entries, got %d", cached)
+		}
+		// With 1000 keys, every shard is full
+		if cached != 40 || cached+int(evicted.Load()) != 1000 {
+			t.Fatalf("Expected 40 cached entries and 960 evicted, got %d and %d", cached, evicted.Load())
+		}
+		if stats := cache.Stats(); cache.Len() != 40 || stats.Evictions != 960 || stats.Inserts != 1000 {
+			t.Fatalf("Expected the stats of the shards to add up, got %d entries and %+v", cache.Len(), stats)
+		}
+	})
+
+	t.Run("keys interleave the shards", func(t *testing.T) {
+		cache, _ := NewShardedCache[string, string](4, 1000)
+		for i := 0; i < 40; i++ {
+			cache.Write(strconv.Itoa(i), "v")
+		}
+
+		keys := cache.Keys()
+		if len(keys) != 40 {
+			t.Fatalf("Expected 40 keys, got %d", len(keys))
+		}
+		// The most recently written key comes first in its shard, so among the first of all shards
+		found := false
+		for _, key := range keys[:4] {
+			found = found || key == "39"
+		}
+		if !found {
+			t.Fatalf("Expected 39 to be among the first keys, got %v", keys)
+		}
+	})
+
+	t.Run("keys of other types are spread over the shards", func(t *testing.T) {
+		cache, _ := NewShardedCache[int, bool](4, 1000)
+		for i := 0; i < 100; i++ {
+			cache.Write(i, i%2 == 0)
+		}
+
+		for i, shard := range cache.shards {
+			if shard.Len() == 0 {
+				t.Fatalf("Expected shard %d to hold some of the keys", i)
+			}
+		}
+		if val, ok := cache.Read(42); !ok || !val {
+			t.Fatalf("Expected true, got %v, %v", val, ok)
+		}
+	})
+
+	t.Run("weighted shards split the weight", func(t *testing.T) {
+		cache, _ := NewWeightedShardedCache(4, Weights[string, string]{MaxWeight: 400, MaxEntryWeight: 200})
+
+		for _, shard := range cache.shards {
+			if shard.maxWeight != 100 || shard.maxEntryWeight != 100 {
+				t.Fatalf("Expected weights of 100 and 100, got %d and %d", shard.maxWeight, shard.maxEntryWeight)
+			}
+		}
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		cache, _ := NewShardedCache[string, string](4, 16)
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					key := strconv.Itoa((g*7 + i) % 40)
+					switch i % 5 {
+					case 0:
+						cache.Write(key, key)
+					case 1:
+						cache.Delete(key)
+					default:
+						if val, ok := cache.Read(key); ok && val != key {
+							t.Errorf("Expected %s, got %s", key, val)
+						}
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+	})
+}
+
+// benchmarkParallelMixed measures the throughput of a 90% read, 10% write
+// workload from parallel goroutines, on a cache large enough to hold every key.
+func benchmarkParallelMixed(b *testing.B, cache Cache[string, string]) {
+	for j := 0; j < 1024; j++ {
+		cache.Write(strconv.Itoa(j), "value")
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		j := 0
+		for pb.Next() {
+			key := strconv.Itoa(j % 1024)
+			if j%10 == 0 {
+				cache.Write(key, "value")
+			} else {
+				cache.Read(key)
+			}
+			j++
+		}
+	})
+}
+
+// benchmarkParallelWrites measures the throughput of writes from parallel
+// goroutines, evicting entries as they go.
+func benchmarkParallelWrites(b *testing.B, cache Cache[string, string]) {
+	b.RunParallel(func(pb *testing.PB) {
+		j := 0
+		for pb.Next() {
+			cache.Write(strconv.Itoa(j%4096), "value")
+			j++
+		}
+	})
+}
+
+// BenchmarkLRUCache and BenchmarkShardedCache compare the throughput of a
+// single LRUCache with the sharded one:
+//
+//	go test -run xxx -bench 'LRUCache|ShardedCache' -cpu 1,4,8 ./cache
+func BenchmarkLRUCache(b *testing.B) {
+	b.Run("writes", func(b *testing.B) {
+		benchmarkParallelWrites(b, NewLRUCache[string, string](1024))
+	})
+	b.Run("mixed", func(b *testing.B) {
+		benchmarkParallelMixed(b, NewLRUCache[string, string](2048))
+	})
+}
+
+func BenchmarkShardedCache(b *testing.B) {
+	for _, shards := range []int{4, 16, 64} {
+		b.Run(fmt.Sprintf("writes/%d shards", shards), func(b *testing.B) {
+			cache, _ := NewShardedCache[string, string](shards, 1024)
+			benchmarkParallelWrites(b, cache)
+		})
+		b.Run(fmt.Sprintf("mixed/%d shards", shards), func(b *testing.B) {
+			cache, _ := NewShardedCache[string, string](shards, 2048)
+			benchmarkParallelMixed(b, cache)
+		})
+	}
+}
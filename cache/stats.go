@@ -0,0 +1,106 @@
+package cache
+
+import "sync/atomic"
+
+// EvictReason tells why an entry was evicted from a cache.
+type EvictReason string
+
+const (
+	// EvictCapacity is the reason for entries evicted to make room for others.
+	EvictCapacity EvictReason = "capacity"
+
+	// EvictRejected is the reason for entries the cache refused to keep when
+	// they were written: too heavy for a weighted cache, or not admitted by
+	// the admission policy of a TinyLFUCache.
+	EvictRejected EvictReason = "rejected"
+
+	// EvictExpired is the reason for entries evicted after their time to live,
+	// when read or when making room for others.
+	EvictExpired EvictReason = "expired"
+)
+
+// Stats counts the operations of a cache since it was created.
+type Stats struct {
+	// Hits and Misses count the reads of cached and missing keys. Peeks aren't counted.
+	Hits   uint64
+	Misses uint64
+
+	// Inserts counts the writes of keys that weren't cached.
+	Inserts uint64
+
+	// Evictions counts the entries evicted, for any reason.
+	Evictions uint64
+
+	// Bytes is the total size of the keys and values currently cached, as weighed by ByteSize.
+	Bytes int64
+}
+
+// HitRatio returns the share of reads that were hits, or 0 before the first read.
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// add returns the sum of s and other, for caches made of several others.
+func (s Stats) add(other Stats) Stats {
+	return Stats{
+		Hits:      s.Hits + other.Hits,
+		Misses:    s.Misses + other.Misses,
+		Inserts:   s.Inserts + other.Inserts,
+		Evictions: s.Evictions + other.Evictions,
+		Bytes:     s.Bytes + other.Bytes,
+	}
+}
+
+// counters records the statistics of a cache of keys K and values V. They are
+// updated atomically, so that reads holding only a read lock can record themselves.
+type counters[K comparable, V any] struct {
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	inserts   atomic.Uint64
+	evictions atomic.Uint64
+	bytes     atomic.Int64
+}
+
+// read records a read, and whether it was a hit.
+func (c *counters[K, V]) read(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// insert records an entry added to the cache, and whether its key is new to it.
+func (c *counters[K, V]) insert(key K, value V, isNew bool) {
+	if isNew {
+		c.inserts.Add(1)
+	}
+	c.bytes.Add(ByteSize(key, value))
+}
+
+// remove records an entry removed from the cache.
+func (c *counters[K, V]) remove(key K, value V) {
+	c.bytes.Add(-ByteSize(key, value))
+}
+
+// evict records an eviction, and calls fn with it if set. The evicted entry
+// must have been recorded as removed, if it was ever inserted.
+func (c *counters[K, V]) evict(fn EvictFunc[K, V], key K, value V, reason EvictReason) {
+	c.evictions.Add(1)
+	if fn != nil {
+		fn(key, value, reason)
+	}
+}
+
+func (c *counters[K, V]) stats() Stats {
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Inserts:   c.inserts.Load(),
+		Evictions: c.evictions.Load(),
+		Bytes:     c.bytes.Load(),
+	}
+}
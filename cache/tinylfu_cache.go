@@ -0,0 +1,298 @@
+package cache
+
+import (
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+const (
+	// tinyLFUWindowRatio is the share of the capacity given to the admission window.
+	tinyLFUWindowRatio = 0.01
+
+	// tinyLFUProtectedRatio is the share of the main space given to protected entries.
+	tinyLFUProtectedRatio = 0.8
+)
+
+// TinyLFUCache is a Window-TinyLFU cache. New entries are added to a small LRU
+// window. Entries evicted from the window are only admitted to the main space
+// if their estimated use count is higher than the one of the entry they would
+// replace, so that keys used once don't push frequently used ones out.
+//
+// The main space is a segmented LRU: admitted entries start in probation, and
+// move to protected when used again. Use counts are estimated for every key
+// read or written, cached or not, by a frequencySketch.
+type TinyLFUCache[K comparable, V any] struct {
+	window        *orderedList[K, V]
+	probation     *orderedList[K, V]
+	protected     *orderedList[K, V]
+	windowSize    int
+	mainSize      int
+	protectedSize int
+	sketch        *frequencySketch[K]
+	onEvict       EvictFunc[K, V]
+	stats         counters[K, V]
+	mu            sync.Mutex
+}
+
+func NewTinyLFUCache[K comparable, V any](capacity int) *TinyLFUCache[K, V] {
+	windowSize := min(max(int(float64(capacity)*tinyLFUWindowRatio), 1), max(capacity, 0))
+	mainSize := max(capacity-windowSize, 0)
+	return &TinyLFUCache[K, V]{
+		window:        newOrderedList[K, V](),
+		probation:     newOrderedList[K, V](),
+		protected:     newOrderedList[K, V](),
+		windowSize:    windowSize,
+		mainSize:      mainSize,
+		protectedSize: int(float64(mainSize) * tinyLFUProtectedRatio),
+		sketch:        newFrequencySketch[K](capacity),
+		mu:            sync.Mutex{},
+	}
+}
+
+// use records a use of key and promotes it within its segment, or from
+// probation to protected. Returns its entry, if cached.
+func (c *TinyLFUCache[K, V]) use(key K) (*entry[K, V], bool) {
+	c.sketch.increment(key)
+
+	if e, ok := c.window.get(key); ok {
+		c.window.moveToFront(key)
+		return e, true
+	}
+	if e, ok := c.protected.get(key); ok {
+		c.protected.moveToFront(key)
+		return e, true
+	}
+	if e, ok := c.probation.remove(key); ok {
+		c.protected.push(e)
+		if c.protected.len() > c.protectedSize {
+			demoted, _ := c.protected.removeBack()
+			c.probation.push(demoted)
+		}
+		return e, true
+	}
+	return nil, false
+}
+
+// admit decides whether the candidate evicted from the window replaces the
+// next entry to evict from the main space, and evicts the loser.
+func (c *TinyLFUCache[K, V]) admit(candidate *entry[K, V]) {
+	if c.probation.len()+c.protected.len() < c.mainSize {
+		c.probation.push(candidate)
+		return
+	}
+
+	victims := c.probation
+	if victims.len() == 0 {
+		victims = c.protected
+	}
+	victim, ok := victims.back()
+
+	evicted, reason := candidate, EvictRejected
+	if ok && c.sketch.estimate(candidate.key) > c.sketch.estimate(victim.key) {
+		victims.remove(victim.key)
+		c.probation.push(candidate)
+		evicted, reason = victim, victim.evictReason(time.Now())
+	}
+
+	c.stats.remove(evicted.key, evicted.val)
+	c.stats.evict(c.onEvict, evicted.key, evicted.val, reason)
+}
+
+func (c *TinyLFUCache[K, V]) Read(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(key)
+	e, ok := c.use(key)
+	c.stats.read(ok)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return e.val, true
+}
+
+func (c *TinyLFUCache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, l := range []*orderedList[K, V]{c.window, c.probation, c.protected} {
+		if e, ok := l.get(key); ok && !e.expired(now) {
+			return e.val, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+func (c *TinyLFUCache[K, V]) Write(key K, value V) {
+	c.write(key, value, time.Time{})
+}
+
+func (c *TinyLFUCache[K, V]) WriteWithTTL(key K, value V, ttl time.Duration) {
+	c.write(key, value, time.Now().Add(ttl))
+}
+
+// write replaces the value of key, which expires at expires, or never if
+// expires is zero.
+func (c *TinyLFUCache[K, V]) write(key K, value V, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.use(key); ok {
+		c.stats.remove(key, e.val)
+		c.stats.insert(key, value, false)
+		e.val, e.expires = value, expires
+		return
+	}
+	if c.windowSize <= 0 {
+		return
+	}
+
+	c.window.pushFront(key, value, expires)
+	c.stats.insert(key, value, true)
+	if c.window.len() > c.windowSize {
+		candidate, _ := c.window.removeBack()
+		c.admit(candidate)
+	}
+}
+
+// expire evicts the entry of key if it has expired. The caller must hold mu.
+func (c *TinyLFUCache[K, V]) expire(key K) {
+	for _, l := range []*orderedList[K, V]{c.window, c.probation, c.protected} {
+		if e, ok := l.get(key); ok && e.expired(time.Now()) {
+			l.remove(key)
+			c.stats.remove(key, e.val)
+			c.stats.evict(c.onEvict, key, e.val, EvictExpired)
+		}
+	}
+}
+
+func (c *TinyLFUCache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, l := range []*orderedList[K, V]{c.window, c.probation, c.protected} {
+		if e, ok := l.remove(key); ok {
+			c.stats.remove(key, e.val)
+		}
+	}
+}
+
+func (c *TinyLFUCache[K, V]) OnEvict(fn EvictFunc[K, V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onEvict = fn
+}
+
+// Keys returns the protected keys, then those in probation, then those in the
+// window, each from the most to the least recently used.
+func (c *TinyLFUCache[K, V]) Keys() []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := append(c.protected.keys(), c.probation.keys()...)
+	return append(keys, c.window.keys()...)
+}
+
+const (
+	// sketchDepth is the number of counters of a frequencySketch for every key.
+	sketchDepth = 4
+
+	// sketchMaxCount is the value counters saturate at.
+	sketchMaxCount = 15
+
+	// sketchWidthRatio is the minimum number of counters per row, relative to
+	// the capacity, which keeps collisions between keys rare.
+	sketchWidthRatio = 8
+
+	// sketchSampleRatio is the number of increments, relative to the capacity,
+	// after which all counters are halved.
+	sketchSampleRatio = 10
+)
+
+// frequencySketch is a count-min sketch estimating how often keys are used.
+// Counters are halved periodically, so that estimates favour recent uses and
+// keys that were popular a long time ago can be evicted.
+type frequencySketch[K comparable] struct {
+	counters   [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+	seed       maphash.Seed
+}
+
+func newFrequencySketch[K comparable](capacity int) *frequencySketch[K] {
+	width := 16
+	for width < capacity*sketchWidthRatio {
+		width *= 2
+	}
+
+	s := &frequencySketch[K]{
+		mask:       uint64(width - 1),
+		sampleSize: max(capacity*sketchSampleRatio, width),
+		seed:       maphash.MakeSeed(),
+	}
+	for i := range s.counters {
+		s.counters[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// indexes returns the counter of key in every row.
+func (s *frequencySketch[K]) indexes(key K) [sketchDepth]uint64 {
+	h := maphash.Comparable(s.seed, key)
+	h1, h2 := h&0xffffffff, h>>32|1
+
+	var idx [sketchDepth]uint64
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return idx
+}
+
+func (s *frequencySketch[K]) increment(key K) {
+	for i, j := range s.indexes(key) {
+		if s.counters[i][j] < sketchMaxCount {
+			s.counters[i][j]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// estimate returns the estimated use count of key, the lowest of its counters.
+func (s *frequencySketch[K]) estimate(key K) uint8 {
+	count := uint8(sketchMaxCount)
+	for i, j := range s.indexes(key) {
+		count = min(count, s.counters[i][j])
+	}
+	return count
+}
+
+// reset halves all counters.
+func (s *frequencySketch[K]) reset() {
+	for i := range s.counters {
+		for j := range s.counters[i] {
+			s.counters[i][j] /= 2
+		}
+	}
+	s.additions /= 2
+}
+
+func (c *TinyLFUCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.window.len() + c.probation.len() + c.protected.len()
+}
+
+func (c *TinyLFUCache[K, V]) Stats() Stats {
+	return c.stats.stats()
+}
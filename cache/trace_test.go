@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"testing"
+)
+
+const (
+	traceKeys     = 10000
+	traceLength   = 200000
+	traceCapacity = 500
+)
+
+// zipfTrace returns accesses to keys whose popularity follows a Zipfian distribution.
+func zipfTrace() []string {
+	r := rand.New(rand.NewPCG(1, 2))
+	zipf := rand.NewZipf(r, 1.1, 1, traceKeys-1)
+
+	trace := make([]string, traceLength)
+	for i := range trace {
+		trace[i] = strconv.FormatUint(zipf.Uint64(), 10)
+	}
+	return trace
+}
+
+// scanTrace returns a Zipfian trace interrupted by scans of keys that are
+// accessed only once, such as a full table scan.
+func scanTrace() []string {
+	const scanEvery = 5000
+	const scanLength = 2000
+
+	trace := make([]string, 0, traceLength+traceLength/scanEvery*scanLength)
+	scanned := 0
+	for i, key := range zipfTrace() {
+		if i%scanEvery == 0 {
+			for j := 0; j < scanLength; j++ {
+				trace = append(trace, "scan"+strconv.Itoa(scanned))
+				scanned++
+			}
+		}
+		trace = append(trace, key)
+	}
+	return trace
+}
+
+var traces = []struct {
+	name  string
+	trace func() []string
+}{
+	{"zipf", zipfTrace},
+	{"scan", scanTrace},
+}
+
+// replay reads every key of the trace, writing it on a miss like a read-through
+// cache, and returns the ratio of hits.
+func replay(c Cache[string, string], trace []string) float64 {
+	hits := 0
+	for _, key := range trace {
+		if _, ok := c.Read(key); ok {
+			hits++
+		} else {
+			c.Write(key, key)
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+func hitRatios(t testing.TB, trace []string) map[Policy]float64 {
+	ratios := make(map[Policy]float64)
+	for _, policy := range Policies {
+		c, err := New[string, string](policy, traceCapacity)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		ratios[policy] = replay(c, trace)
+	}
+	return ratios
+}
+
+func TestHitRatios(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping trace replay in short mode")
+	}
+
+	zipf := hitRatios(t, zipfTrace())
+	scan := hitRatios(t, scanTrace())
+	for _, policy := range Policies {
+		t.Logf("%-8s zipf %5.2f%%  scan %5.2f%%", policy, zipf[policy]*100, scan[policy]*100)
+	}
+
+	for _, policy := range []Policy{PolicyLFU, PolicyTinyLFU} {
+		if zipf[policy] < zipf[PolicyLRU] {
+			t.Errorf("Expected %s to hit at least as often as lru on a Zipfian trace, got %.4f < %.4f",
+				policy, zipf[policy], zipf[PolicyLRU])
+		}
+	}
+	for _, policy := range []Policy{PolicyARC, Policy2Q, PolicyTinyLFU} {
+		if scan[policy] <= scan[PolicyLRU] {
+			t.Errorf("Expected %s to hit more often than lru on a trace with scans, got %.4f <= %.4f",
+				policy, scan[policy], scan[PolicyLRU])
+		}
+	}
+}
+
+// BenchmarkHitRatio replays the traces against every policy, and reports the
+// ratio of hits along with the time taken:
+//
+//	go test -run xxx -bench HitRatio ./cache
+func BenchmarkHitRatio(b *testing.B) {
+	for _, tr := range traces {
+		trace := tr.trace()
+		for _, policy := range Policies {
+			b.Run(tr.name+"/"+string(policy), func(b *testing.B) {
+				var ratio float64
+				for i := 0; i < b.N; i++ {
+					c, err := New[string, string](policy, traceCapacity)
+					if err != nil {
+						b.Fatalf("Expected no error, got %v", err)
+					}
+					ratio = replay(c, trace)
+				}
+				b.ReportMetric(ratio*100, "hit%")
+			})
+		}
+	}
+}
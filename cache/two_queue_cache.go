@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// twoQueueRecentRatio is the share of the capacity given to recently added entries.
+	twoQueueRecentRatio = 0.25
+
+	// twoQueueGhostRatio is the number of keys evicted from recent that are
+	// remembered, relative to the capacity.
+	twoQueueGhostRatio = 0.5
+)
+
+// TwoQueueCache is a 2Q cache. New entries are added to recent, and moved to
+// frequent when used again. Keys evicted from recent are remembered in
+// recentGhost, so that writing them again adds them straight to frequent. Keys
+// used only once, as in a scan, never push the entries of frequent out.
+type TwoQueueCache[K comparable, V any] struct {
+	recent      *orderedList[K, V]
+	frequent    *orderedList[K, V]
+	recentGhost *orderedList[K, V]
+	capacity    int
+	recentSize  int
+	ghostSize   int
+	onEvict     EvictFunc[K, V]
+	stats       counters[K, V]
+	mu          sync.Mutex
+}
+
+func NewTwoQueueCache[K comparable, V any](capacity int) *TwoQueueCache[K, V] {
+	return &TwoQueueCache[K, V]{
+		recent:      newOrderedList[K, V](),
+		frequent:    newOrderedList[K, V](),
+		recentGhost: newOrderedList[K, V](),
+		capacity:    capacity,
+		recentSize:  max(int(float64(capacity)*twoQueueRecentRatio), 1),
+		ghostSize:   max(int(float64(capacity)*twoQueueGhostRatio), 1),
+		mu:          sync.Mutex{},
+	}
+}
+
+// makeRoom evicts an entry if the cache is full: from recent if it is over its
+// size, or from frequent otherwise. ghostHit is true when making room for a key
+// found in recentGhost, which is added to frequent.
+func (c *TwoQueueCache[K, V]) makeRoom(ghostHit bool) {
+	if c.recent.len()+c.frequent.len() < c.capacity {
+		return
+	}
+
+	var e *entry[K, V]
+	n := c.recent.len()
+	if n > 0 && (n > c.recentSize || (n == c.recentSize && !ghostHit) || c.frequent.len() == 0) {
+		e, _ = c.recent.removeBack()
+		c.recentGhost.push(&entry[K, V]{key: e.key})
+		if c.recentGhost.len() > c.ghostSize {
+			c.recentGhost.removeBack()
+		}
+	} else {
+		e, _ = c.frequent.removeBack()
+	}
+
+	c.stats.remove(e.key, e.val)
+	c.stats.evict(c.onEvict, e.key, e.val, e.evictReason(time.Now()))
+}
+
+// expire evicts the entry of key if it has expired. The caller must hold mu.
+func (c *TwoQueueCache[K, V]) expire(key K) {
+	for _, l := range []*orderedList[K, V]{c.recent, c.frequent} {
+		if e, ok := l.get(key); ok && e.expired(time.Now()) {
+			l.remove(key)
+			c.stats.remove(key, e.val)
+			c.stats.evict(c.onEvict, key, e.val, EvictExpired)
+		}
+	}
+}
+
+func (c *TwoQueueCache[K, V]) Read(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(key)
+	if e, ok := c.frequent.get(key); ok {
+		c.frequent.moveToFront(key)
+		c.stats.read(true)
+		return e.val, true
+	}
+	if e, ok := c.recent.remove(key); ok {
+		c.frequent.push(e)
+		c.stats.read(true)
+		return e.val, true
+	}
+	c.stats.read(false)
+	var zero V
+	return zero, false
+}
+
+func (c *TwoQueueCache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := c.frequent.get(key); ok && !e.expired(now) {
+		return e.val, true
+	}
+	if e, ok := c.recent.get(key); ok && !e.expired(now) {
+		return e.val, true
+	}
+	var zero V
+	return zero, false
+}
+
+func (c *TwoQueueCache[K, V]) Write(key K, value V) {
+	c.write(key, value, time.Time{})
+}
+
+func (c *TwoQueueCache[K, V]) WriteWithTTL(key K, value V, ttl time.Duration) {
+	c.write(key, value, time.Now().Add(ttl))
+}
+
+// write replaces the value of key, which expires at expires, or never if
+// expires is zero.
+func (c *TwoQueueCache[K, V]) write(key K, value V, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capacity <= 0 {
+		return
+	}
+
+	e, ok := c.frequent.get(key)
+	if !ok {
+		e, ok = c.recent.remove(key)
+	}
+	if ok {
+		c.stats.remove(key, e.val)
+		c.stats.insert(key, value, false)
+		c.frequent.pushFront(key, value, expires)
+		return
+	}
+	defer c.stats.insert(key, value, true)
+
+	if _, ok := c.recentGhost.remove(key); ok {
+		c.makeRoom(true)
+		c.frequent.pushFront(key, value, expires)
+		return
+	}
+
+	c.makeRoom(false)
+	c.recent.pushFront(key, value, expires)
+}
+
+func (c *TwoQueueCache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.frequent.remove(key); ok {
+		c.stats.remove(key, e.val)
+	}
+	if e, ok := c.recent.remove(key); ok {
+		c.stats.remove(key, e.val)
+	}
+	c.recentGhost.remove(key)
+}
+
+func (c *TwoQueueCache[K, V]) OnEvict(fn EvictFunc[K, V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onEvict = fn
+}
+
+func (c *TwoQueueCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.recent.len() + c.frequent.len()
+}
+
+func (c *TwoQueueCache[K, V]) Stats() Stats {
+	return c.stats.stats()
+}
+
+// Keys returns the keys used more than once, then the others, each from the
+// most to the least recently used.
+func (c *TwoQueueCache[K, V]) Keys() []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append(c.frequent.keys(), c.recent.keys()...)
+}
@@ -1,6 +1,12 @@
 package config
 
-import "flag"
+import (
+	"errors"
+	"flag"
+	"path/filepath"
+	"strings"
+	"time"
+)
 
 type StoreImpl int
 
@@ -8,30 +14,137 @@ const (
 	InMemory StoreImpl = iota
 	Persistent
 	PersistentCached
+	Tiered
 )
 
 // ServerConfig holds the configuration for the server
 type ServerConfig struct {
-	Port          int
-	Mode          StoreImpl
-	StorePath     string
-	CacheCapacity int
+	Port               int
+	Mode               StoreImpl
+	StorePath          string
+	BucketsPath        string
+	CacheCapacity      int
+	CachePolicy        string
+	CacheMaxBytes      int64
+	CacheMaxEntryBytes int64
+	CacheShards        int
+	CacheMissTTL       time.Duration
+	CacheWarm          bool
+	CacheWarmTimeout   time.Duration
+	CacheWarmSave      time.Duration
+	KeyFilterFPRate    float64
+	WriteBackInterval  time.Duration
+	WriteBackBatch     int
+	HotCapacity        int
+	TieredFlush        time.Duration
+	MVCCRetention      int64
+	HistoryVersions    int
+	MaxKeyLength       int
+	MaxValueSize       int64
+	MaxKeys            int
+	MaxTotalBytes      int64
+	Shards             int
+	MaxMemory          int64
+	EvictionPolicy     string
+	Indexing           bool
+	Indexes            map[string]string
 }
 
 // ParseFlags parses command-line flags and returns a ServerConfig
 func ParseFlags() *ServerConfig {
-	config := &ServerConfig{}
+	config := &ServerConfig{Indexes: make(map[string]string)}
 	var mode int
 
 	flag.IntVar(&config.Port, "port", 8080, "Port to listen on")
 	flag.IntVar(&mode, "mode", 0,
 		"The key-value store implementation to use. 0 = In-Memory map, 1 = Persistent KV store, "+
-			"2 = Persistent KV store with caching")
+			"2 = Persistent KV store with caching, 3 = Tiered KV store with hot keys in memory and cold keys on disk")
 	flag.StringVar(&config.StorePath, "store_path", "", "The path for the persistent storage, if used")
+	flag.StringVar(&config.BucketsPath, "buckets_path", "",
+		"The path for the persistent storage of buckets other than the default one, if used. "+
+			"Defaults to the store path with a \"_buckets\" suffix")
 	flag.IntVar(&config.CacheCapacity, "cache_capacity", 100,
 		"The size of the cache for the persistent cached storage, if used")
+	flag.StringVar(&config.CachePolicy, "cache_policy", "lru",
+		"The eviction policy of the cache for the persistent cached storage, if used: lru, lfu, arc, 2q or tinylfu")
+	flag.Int64Var(&config.CacheMaxBytes, "cache_max_bytes", 0,
+		"Bounds the cache for the persistent cached storage by the total size of its keys and values in bytes, "+
+			"instead of their number. Only supported by the lru policy. 0 means the cache is bounded by -cache_capacity")
+	flag.Int64Var(&config.CacheMaxEntryBytes, "cache_max_entry_bytes", 0,
+		"The size in bytes above which an entry isn't cached, if -cache_max_bytes is set. "+
+			"0 means an eighth of -cache_max_bytes")
+	flag.IntVar(&config.CacheShards, "cache_shards", 1,
+		"The number of shards of the cache for the persistent cached storage, each with its own lock. "+
+			"Must be a power of two. Only supported by the lru policy")
+	flag.DurationVar(&config.CacheMissTTL, "cache_miss_ttl", 0,
+		"Enables caching of missing keys in the persistent cached storage, so that reading them again "+
+			"doesn't read the disk for this long, unless they are written. 0 means misses aren't cached")
+	flag.BoolVar(&config.CacheWarm, "cache_warm", false,
+		"Saves the keys of the cache for the persistent cached storage on shutdown, "+
+			"and loads them into the cache in the background on startup")
+	flag.DurationVar(&config.CacheWarmTimeout, "cache_warm_timeout", 30*time.Second,
+		"How long the cache warm-up reads saved keys from disk, if -cache_warm is set. "+
+			"The most used keys are read first")
+	flag.DurationVar(&config.CacheWarmSave, "cache_warm_save_interval", time.Minute,
+		"How often the keys of the cache are saved, if -cache_warm is set, so that they survive a crash. "+
+			"0 means they are only saved on shutdown")
+	flag.Float64Var(&config.KeyFilterFPRate, "key_filter_fp_rate", 0,
+		"Enables a cuckoo filter of the keys of the persistent storage and the persistent cached storage, "+
+			"so that reads of missing keys mostly don't touch the disk. The share of those reads that still do, "+
+			"below 1. 0 means keys aren't filtered")
+	flag.DurationVar(&config.WriteBackInterval, "write_back_interval", 0,
+		"Enables write-back caching in the persistent cached storage: writes are persisted in the background "+
+			"at this interval instead of before returning. 0 means write-through")
+	flag.IntVar(&config.WriteBackBatch, "write_back_batch", 100,
+		"The maximum number of keys persisted at once in write-back mode. "+
+			"As many dirty keys are persisted without waiting for the interval")
+	flag.IntVar(&config.HotCapacity, "hot_capacity", 1000,
+		"The number of keys kept in memory by the tiered storage, if used. "+
+			"The least frequently used keys are moved to disk")
+	flag.DurationVar(&config.TieredFlush, "tiered_flush_interval", time.Second,
+		"How often the tiered storage writes the keys changed in memory to disk. "+
+			"Writes made since the last flush are lost if the process crashes. "+
+			"0 means they are only written when moved to disk or on shutdown")
+	flag.Int64Var(&config.MVCCRetention, "mvcc_retention", -1,
+		"The number of past revisions kept readable through multi-version concurrency control. "+
+			"A negative value disables versioning. Versioning keeps a copy of every retained version, "+
+			"and of the latest value of every key, in memory")
+	flag.IntVar(&config.HistoryVersions, "history_versions", 0,
+		"The number of past versions kept per key for history and rollback, in memory. "+
+			"Enables versioning if positive")
+	flag.IntVar(&config.MaxKeyLength, "max_key_length", 0,
+		"The maximum length of a key, in bytes. 0 means no limit")
+	flag.Int64Var(&config.MaxValueSize, "max_value_size", 0,
+		"The maximum size of a value and of a request body, in bytes. 0 means no limit")
+	flag.IntVar(&config.MaxKeys, "max_keys", 0,
+		"The maximum number of keys per bucket. 0 means no limit")
+	flag.Int64Var(&config.MaxTotalBytes, "max_total_bytes", 0,
+		"The maximum total size of keys and values per bucket, in bytes. 0 means no limit")
+	flag.IntVar(&config.Shards, "shards", 1,
+		"The number of shards of the in-memory store, each with its own lock. Must be a power of two")
+	flag.Int64Var(&config.MaxMemory, "max_memory", 0,
+		"The memory budget of the in-memory store, in bytes of keys and values. 0 means no limit")
+	flag.StringVar(&config.EvictionPolicy, "eviction_policy", "lru",
+		"The keys evicted when the in-memory store exceeds its memory budget: "+
+			"lru, lfu, random, volatile-ttl or reject to reject writes instead")
+	flag.BoolVar(&config.Indexing, "indexing", false,
+		"Enable secondary indexes on JSON values, which can then be managed through the API")
+	flag.Func("index", "A secondary index on JSON values, as name=path where path is a JSONPath expression. "+
+		"May be repeated. Enables indexing", func(s string) error {
+		name, path, ok := strings.Cut(s, "=")
+		if !ok || name == "" {
+			return errors.New("expected name=path")
+		}
+		config.Indexes[name] = path
+		config.Indexing = true
+		return nil
+	})
 	flag.Parse()
 	config.Mode = StoreImpl(mode)
+	if config.BucketsPath == "" {
+		// Cleaned so that a trailing slash doesn't put the buckets inside the store root
+		config.BucketsPath = filepath.Clean(config.StorePath) + "_buckets"
+	}
 
 	return config
 }
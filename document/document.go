@@ -0,0 +1,125 @@
+// Package document implements operations on JSON document values: path
+// lookups, RFC 6902 JSON Patch and RFC 7386 JSON Merge Patch.
+//
+// Documents are decoded into generic trees of map[string]any, []any,
+// json.Number, string, bool and nil, so numbers keep their original precision.
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+)
+
+var (
+	// ErrInvalidDocument is returned when a stored value is not a valid JSON document.
+	ErrInvalidDocument = errors.New("invalid JSON document")
+
+	// ErrInvalidPatch is returned when a patch is malformed.
+	ErrInvalidPatch = errors.New("invalid patch")
+
+	// ErrInvalidPath is returned when a path expression is malformed.
+	ErrInvalidPath = errors.New("invalid path")
+
+	// ErrPathNotFound is returned when a path does not resolve to a value in the document.
+	ErrPathNotFound = errors.New("path not found")
+
+	// ErrConflict is returned when a patch cannot be applied to the document,
+	// either because a location it references does not exist or a test operation failed.
+	ErrConflict = errors.New("patch conflicts with document")
+)
+
+// decode parses a JSON value, returning err if the data is not exactly one valid JSON value.
+func decode(data []byte, err error) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if dec.Decode(&v) != nil {
+		return nil, err
+	}
+	if _, tokErr := dec.Token(); tokErr != io.EOF {
+		return nil, err
+	}
+	return v, nil
+}
+
+// encode serializes a decoded JSON value.
+func encode(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Parse decodes a JSON document.
+// Returns ErrInvalidDocument if doc is not valid JSON.
+func Parse(doc string) (any, error) {
+	return decode([]byte(doc), ErrInvalidDocument)
+}
+
+// equal reports whether two decoded JSON values are equal. Numbers are
+// compared by value, so 1 and 1.0 are equal.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if a == b {
+			return true
+		}
+		x, errA := strconv.ParseFloat(string(a), 64)
+		y, errB := strconv.ParseFloat(string(b), 64)
+		return errA == nil && errB == nil && x == y
+	default:
+		return a == b
+	}
+}
+
+// clone returns a deep copy of a decoded JSON value.
+func clone(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for k, e := range v {
+			c[k] = clone(e)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, e := range v {
+			c[i] = clone(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
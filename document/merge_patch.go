@@ -0,0 +1,37 @@
+package document
+
+// ApplyMergePatch applies an RFC 7386 JSON Merge Patch to the document doc
+// and returns the patched document.
+// Returns ErrInvalidDocument or ErrInvalidPatch on failure.
+func ApplyMergePatch(doc string, patch []byte) (string, error) {
+	target, err := Parse(doc)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := decode(patch, ErrInvalidPatch)
+	if err != nil {
+		return "", err
+	}
+	return encode(mergePatch(target, p))
+}
+
+func mergePatch(target any, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any, len(p))
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+		} else {
+			t[name] = mergePatch(t[name], value)
+		}
+	}
+	return t
+}
@@ -0,0 +1,57 @@
+package document
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	// Examples from RFC 7386, Appendix A
+	tests := []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.doc+" + "+tt.patch, func(t *testing.T) {
+			got, err := ApplyMergePatch(tt.doc, []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got != tt.expected {
+				t.Fatalf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("invalid document", func(t *testing.T) {
+		_, err := ApplyMergePatch("not json", []byte(`{}`))
+		if !errors.Is(err, ErrInvalidDocument) {
+			t.Fatalf("Expected ErrInvalidDocument, got %v", err)
+		}
+	})
+
+	t.Run("invalid patch", func(t *testing.T) {
+		_, err := ApplyMergePatch(`{}`, []byte(`{"a":`))
+		if !errors.Is(err, ErrInvalidPatch) {
+			t.Fatalf("Expected ErrInvalidPatch, got %v", err)
+		}
+	})
+}
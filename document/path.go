@@ -0,0 +1,124 @@
+package document
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Path is a parsed JSONPath expression selecting a single value in a document.
+// The supported subset is the root "$" followed by any number of member
+// accesses (".name", "['name']" or "[\"name\"]") and array indexes ("[0]").
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+type segment struct {
+	name  string
+	index int
+	array bool
+}
+
+// ParsePath parses a JSONPath expression.
+// Returns ErrInvalidPath if the expression is malformed or unsupported.
+func ParsePath(expr string) (Path, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return Path{}, ErrInvalidPath
+	}
+
+	var segments []segment
+	rest := expr[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return Path{}, ErrInvalidPath
+			}
+			segments = append(segments, segment{name: name})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return Path{}, ErrInvalidPath
+			}
+			seg, err := parseBracket(rest[1:end])
+			if err != nil {
+				return Path{}, err
+			}
+			segments = append(segments, seg)
+			rest = rest[end+1:]
+		default:
+			return Path{}, ErrInvalidPath
+		}
+	}
+
+	return Path{expr: expr, segments: segments}, nil
+}
+
+// parseBracket parses the contents of a bracketed path segment.
+func parseBracket(s string) (segment, error) {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return segment{name: s[1 : len(s)-1]}, nil
+	}
+
+	index, err := strconv.Atoi(s)
+	if err != nil || index < 0 {
+		return segment{}, ErrInvalidPath
+	}
+	return segment{index: index, array: true}, nil
+}
+
+// String returns the expression the path was parsed from.
+func (p Path) String() string {
+	return p.expr
+}
+
+// Eval returns the value selected by the path in a decoded document.
+// Returns ErrPathNotFound if the path does not resolve to a value.
+func (p Path) Eval(doc any) (any, error) {
+	v := doc
+	for _, seg := range p.segments {
+		switch node := v.(type) {
+		case map[string]any:
+			child, ok := node[seg.name]
+			if seg.array || !ok {
+				return nil, ErrPathNotFound
+			}
+			v = child
+		case []any:
+			if !seg.array || seg.index >= len(node) {
+				return nil, ErrPathNotFound
+			}
+			v = node[seg.index]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return v, nil
+}
+
+// Get returns the JSON encoding of the value selected by the JSONPath
+// expression path in the document doc.
+// Returns ErrInvalidDocument, ErrInvalidPath or ErrPathNotFound on failure.
+func Get(doc string, path string) (string, error) {
+	p, err := ParsePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	v, err := Parse(doc)
+	if err != nil {
+		return "", err
+	}
+
+	v, err = p.Eval(v)
+	if err != nil {
+		return "", err
+	}
+	return encode(v)
+}
@@ -0,0 +1,85 @@
+package document
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		segments []segment
+		err      error
+	}{
+		{"root", "$", nil, nil},
+		{"dot members", "$.a.b", []segment{{name: "a"}, {name: "b"}}, nil},
+		{"bracket members", "$['a']" + `["b.c"]`, []segment{{name: "a"}, {name: "b.c"}}, nil},
+		{"array index", "$.items[2].id", []segment{{name: "items"}, {index: 2, array: true}, {name: "id"}}, nil},
+		{"missing root", "a.b", nil, ErrInvalidPath},
+		{"empty member", "$..a", nil, ErrInvalidPath},
+		{"unterminated bracket", "$[0", nil, ErrInvalidPath},
+		{"negative index", "$[-1]", nil, ErrInvalidPath},
+		{"wildcard", "$[*]", nil, ErrInvalidPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePath(tt.expr)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if len(p.segments) != len(tt.segments) {
+				t.Fatalf("Expected %d segments, got %d", len(tt.segments), len(p.segments))
+			}
+			for i := range tt.segments {
+				if p.segments[i] != tt.segments[i] {
+					t.Fatalf("Expected segment %+v, got %+v", tt.segments[i], p.segments[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	doc := `{"user": {"name": "ada", "tags": ["x", "y"], "age": 36.0}, "active": true}`
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+		err      error
+	}{
+		{"root", "$", `{"active":true,"user":{"age":36.0,"name":"ada","tags":["x","y"]}}`, nil},
+		{"nested member", "$.user.name", `"ada"`, nil},
+		{"sub-document", "$.user.tags", `["x","y"]`, nil},
+		{"array element", "$.user.tags[1]", `"y"`, nil},
+		{"number precision", "$.user.age", `36.0`, nil},
+		{"missing member", "$.user.email", "", ErrPathNotFound},
+		{"index out of range", "$.user.tags[2]", "", ErrPathNotFound},
+		{"member of scalar", "$.active.x", "", ErrPathNotFound},
+		{"invalid path", "user", "", ErrInvalidPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Get(doc, tt.path)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if got != tt.expected {
+				t.Fatalf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("invalid document", func(t *testing.T) {
+		_, err := Get("not json", "$")
+		if !errors.Is(err, ErrInvalidDocument) {
+			t.Fatalf("Expected ErrInvalidDocument, got %v", err)
+		}
+	})
+}
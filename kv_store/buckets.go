@@ -0,0 +1,137 @@
+package kv_store
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// DefaultBucket is the name of the bucket that always exists and cannot be deleted.
+const DefaultBucket = "default"
+
+// bucketNamePattern restricts bucket names to characters that are safe to use
+// as path components, since persistent stores keep each bucket in its own directory.
+var bucketNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// StoreFactory creates the store backing a new bucket.
+type StoreFactory func(bucket string) (KeyValueStore, error)
+
+// Dropper is implemented by stores that hold data outside of memory, which
+// must be removed when their bucket is deleted.
+type Dropper interface {
+	// Drop removes all data held by the store. The store must not be used afterwards.
+	Drop() error
+}
+
+// Buckets is a registry of named buckets, each backed by its own store so that
+// their keyspaces are isolated from each other.
+type Buckets struct {
+	stores  map[string]KeyValueStore
+	factory StoreFactory
+	mu      sync.RWMutex
+}
+
+// NewBuckets creates a registry holding defaultStore as the default bucket.
+// New buckets are backed by stores created with factory. If factory is nil,
+// only the default bucket is available.
+func NewBuckets(defaultStore KeyValueStore, factory StoreFactory) *Buckets {
+	return &Buckets{
+		stores:  map[string]KeyValueStore{DefaultBucket: defaultStore},
+		factory: factory,
+		mu:      sync.RWMutex{},
+	}
+}
+
+// Get returns the store backing the named bucket.
+// Returns ErrBucketNotFound if the bucket doesn't exist.
+func (b *Buckets) Get(name string) (KeyValueStore, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	store, ok := b.stores[name]
+	if !ok {
+		return nil, ErrBucketNotFound
+	}
+	return store, nil
+}
+
+// Create creates the named bucket, and returns true if it didn't exist before.
+// Returns ErrInvalidBucketName if the name is invalid, or ErrBucketsUnsupported
+// if the registry cannot create buckets.
+func (b *Buckets) Create(name string) (bool, error) {
+	if !bucketNamePattern.MatchString(name) {
+		return false, ErrInvalidBucketName
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.stores[name]; ok {
+		return false, nil
+	}
+	if b.factory == nil {
+		return false, ErrBucketsUnsupported
+	}
+
+	store, err := b.factory(name)
+	if err != nil {
+		return false, err
+	}
+	b.stores[name] = store
+	return true, nil
+}
+
+// Delete deletes the named bucket along with all its data.
+// Returns ErrBucketNotFound if the bucket doesn't exist, or ErrDefaultBucket
+// for the default bucket.
+func (b *Buckets) Delete(name string) error {
+	if name == DefaultBucket {
+		return ErrDefaultBucket
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	store, ok := b.stores[name]
+	if !ok {
+		return ErrBucketNotFound
+	}
+
+	if d, ok := store.(Dropper); ok {
+		if err := d.Drop(); err != nil {
+			return err
+		}
+	}
+	delete(b.stores, name)
+	return nil
+}
+
+// Names returns the names of all buckets, sorted.
+func (b *Buckets) Names() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	names := make([]string, 0, len(b.stores))
+	for name := range b.stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close closes the stores of all buckets that hold resources, such as unflushed
+// writes, returning the errors of those that failed.
+func (b *Buckets) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var errs []error
+	for _, store := range b.stores {
+		if c, ok := As[io.Closer](store); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
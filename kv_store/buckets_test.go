@@ -0,0 +1,101 @@
+package kv_store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBuckets(t *testing.T) {
+	t.Run("default bucket", func(t *testing.T) {
+		store := NewInMemoryStore()
+		buckets := NewBuckets(store, nil)
+
+		got, err := buckets.Get(DefaultBucket)
+		if err != nil || got != store {
+			t.Fatalf("Expected default store, got %v (err: %v)", got, err)
+		}
+		if _, err := buckets.Create("other"); !errors.Is(err, ErrBucketsUnsupported) {
+			t.Fatalf("Expected ErrBucketsUnsupported, got %v", err)
+		}
+		if err := buckets.Delete(DefaultBucket); !errors.Is(err, ErrDefaultBucket) {
+			t.Fatalf("Expected ErrDefaultBucket, got %v", err)
+		}
+	})
+
+	t.Run("isolated keyspaces", func(t *testing.T) {
+		buckets := NewBuckets(NewInMemoryStore(), func(string) (KeyValueStore, error) {
+			return NewInMemoryStore(), nil
+		})
+
+		created, err := buckets.Create("a")
+		if err != nil || !created {
+			t.Fatalf("Expected bucket to be created, got %v (err: %v)", created, err)
+		}
+		if created, _ := buckets.Create("a"); created {
+			t.Fatalf("Expected existing bucket not to be recreated")
+		}
+
+		a, _ := buckets.Get("a")
+		def, _ := buckets.Get(DefaultBucket)
+		a.Put("key", "a")
+		if _, err := def.Get("key"); err == nil {
+			t.Fatalf("Expected key to be isolated to its bucket")
+		}
+
+		if names := buckets.Names(); !slices.Equal(names, []string{"a", DefaultBucket}) {
+			t.Fatalf("Expected [a default], got %v", names)
+		}
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		buckets := NewBuckets(NewInMemoryStore(), func(string) (KeyValueStore, error) {
+			return NewInMemoryStore(), nil
+		})
+		for _, name := range []string{"", "..", "a/b", "a b"} {
+			if _, err := buckets.Create(name); !errors.Is(err, ErrInvalidBucketName) {
+				t.Fatalf("Expected ErrInvalidBucketName for %q, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("delete drops persistent data", func(t *testing.T) {
+		root := t.TempDir()
+		buckets := NewBuckets(NewInMemoryStore(), func(name string) (KeyValueStore, error) {
+			return NewPersistentStore(filepath.Join(root, name)), nil
+		})
+
+		buckets.Create("p")
+		store, _ := buckets.Get("p")
+		store.Put("key", "value")
+
+		if err := buckets.Delete("p"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(root, "p")); !os.IsNotExist(err) {
+			t.Fatalf("Expected bucket directory to be removed, got %v", err)
+		}
+		if _, err := buckets.Get("p"); !errors.Is(err, ErrBucketNotFound) {
+			t.Fatalf("Expected ErrBucketNotFound, got %v", err)
+		}
+	})
+	t.Run("close flushes wrapped stores", func(t *testing.T) {
+		root := t.TempDir()
+		tiered := NewTieredStore(root, 10)
+		store, err := NewMVCCStore(tiered, 0, 0)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		buckets := NewBuckets(store, nil)
+
+		store.Put("key", "value")
+		if err := buckets.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if value, err := NewPersistentStore(root).Get("key"); err != nil || value != "value" {
+			t.Fatalf("Expected 'value' on disk, got '%s', %v", value, err)
+		}
+	})
+}
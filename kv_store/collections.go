@@ -0,0 +1,213 @@
+package kv_store
+
+import (
+	"cmp"
+	"slices"
+)
+
+// KeyType identifies the type of the value held by a key.
+type KeyType string
+
+const (
+	TypeNone      KeyType = "none"
+	TypeString    KeyType = "string"
+	TypeList      KeyType = "list"
+	TypeSet       KeyType = "set"
+	TypeHash      KeyType = "hash"
+	TypeSortedSet KeyType = "zset"
+)
+
+// CollectionStore is a KeyValueStore whose keys can also hold collections:
+// lists, sets, hashes and sorted sets. Every key holds a single type of value;
+// operations on a key holding another type fail with ErrWrongType. Put always
+// replaces the value of a key, whatever its type, and Delete removes it.
+// Collections that become empty are removed.
+type CollectionStore interface {
+	KeyValueStore
+
+	// Type returns the type of the value held by the given key, or TypeNone if it doesn't exist.
+	Type(key string) KeyType
+
+	// LPush inserts values at the head of the list, in order, and returns the new length.
+	LPush(key string, values ...string) (int, error)
+
+	// RPush inserts values at the tail of the list, in order, and returns the new length.
+	RPush(key string, values ...string) (int, error)
+
+	// LPop removes and returns the head of the list.
+	// Returns ErrKeyNotFound if the list doesn't exist.
+	LPop(key string) (string, error)
+
+	// RPop removes and returns the tail of the list.
+	// Returns ErrKeyNotFound if the list doesn't exist.
+	RPop(key string) (string, error)
+
+	// LRange returns the elements of the list between start and stop, inclusive.
+	// Negative indexes count from the end of the list, -1 being the last element.
+	LRange(key string, start, stop int) ([]string, error)
+
+	// SAdd adds members to the set and returns the number of members that were not already present.
+	SAdd(key string, members ...string) (int, error)
+
+	// SRem removes members from the set and returns the number of members that were present.
+	SRem(key string, members ...string) (int, error)
+
+	// SMembers returns the members of the set, in lexicographical order.
+	SMembers(key string) ([]string, error)
+
+	// HSet sets a field of the hash and returns true if the field is new.
+	HSet(key string, field string, value string) (bool, error)
+
+	// HGet returns the value of a field of the hash.
+	// Returns ErrKeyNotFound if the hash or the field doesn't exist.
+	HGet(key string, field string) (string, error)
+
+	// HDel removes fields from the hash and returns the number of fields that were present.
+	HDel(key string, fields ...string) (int, error)
+
+	// HGetAll returns all fields of the hash and their values.
+	HGetAll(key string) (map[string]string, error)
+
+	// ZAdd sets the scores of members of the sorted set and returns the number of new members.
+	ZAdd(key string, members map[string]float64) (int, error)
+
+	// ZRem removes members from the sorted set and returns the number of members that were present.
+	ZRem(key string, members ...string) (int, error)
+
+	// ZRange returns the members of the sorted set between ranks start and stop, inclusive,
+	// ordered by score and then lexicographically. Negative ranks count from the end.
+	ZRange(key string, start, stop int) ([]ScoredMember, error)
+}
+
+// ScoredMember is a member of a sorted set along with its score.
+type ScoredMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// collection is a value held by a key of a CollectionStore other than a string.
+type collection interface {
+	keyType() KeyType
+	len() int
+
+	// size returns the number of bytes held by the collection's elements.
+	size() int
+}
+
+// scoreSize is the number of bytes accounted for the score of a sorted set member.
+const scoreSize = 8
+
+// listValue holds the elements of a list in two slices growing from its middle,
+// so that pushing to either end is amortized O(1): head holds the elements
+// before the middle in reverse order, and tail the ones after it in order.
+type listValue struct {
+	head  []string
+	tail  []string
+	bytes int
+}
+
+func (l *listValue) keyType() KeyType { return TypeList }
+func (l *listValue) len() int         { return len(l.head) + len(l.tail) }
+func (l *listValue) size() int        { return l.bytes }
+
+// at returns the element at index j.
+func (l *listValue) at(j int) string {
+	if j < len(l.head) {
+		return l.head[len(l.head)-1-j]
+	}
+	return l.tail[j-len(l.head)]
+}
+
+// popFront removes and returns the first element. The list must not be empty.
+func (l *listValue) popFront() string {
+	if len(l.head) > 0 {
+		v := l.head[len(l.head)-1]
+		l.head[len(l.head)-1] = ""
+		l.head = l.head[:len(l.head)-1]
+		return v
+	}
+	v := l.tail[0]
+	l.tail[0] = ""
+	l.tail = l.tail[1:]
+	return v
+}
+
+// popBack removes and returns the last element. The list must not be empty.
+func (l *listValue) popBack() string {
+	if len(l.tail) > 0 {
+		v := l.tail[len(l.tail)-1]
+		l.tail[len(l.tail)-1] = ""
+		l.tail = l.tail[:len(l.tail)-1]
+		return v
+	}
+	v := l.head[0]
+	l.head[0] = ""
+	l.head = l.head[1:]
+	return v
+}
+
+type setValue struct {
+	members map[string]struct{}
+	bytes   int
+}
+
+func (s *setValue) keyType() KeyType { return TypeSet }
+func (s *setValue) len() int         { return len(s.members) }
+func (s *setValue) size() int        { return s.bytes }
+
+type hashValue struct {
+	fields map[string]string
+	bytes  int
+}
+
+func (h *hashValue) keyType() KeyType { return TypeHash }
+func (h *hashValue) len() int         { return len(h.fields) }
+func (h *hashValue) size() int        { return h.bytes }
+
+// sortedSetValue keeps both a score lookup and the members in rank order.
+type sortedSetValue struct {
+	scores map[string]float64
+	ranked []ScoredMember
+	bytes  int
+}
+
+func (z *sortedSetValue) keyType() KeyType { return TypeSortedSet }
+func (z *sortedSetValue) len() int         { return len(z.scores) }
+func (z *sortedSetValue) size() int        { return z.bytes }
+
+func compareScored(a, b ScoredMember) int {
+	if c := cmp.Compare(a.Score, b.Score); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Member, b.Member)
+}
+
+// remove removes member from the rank order. The caller updates scores.
+func (z *sortedSetValue) remove(member string) {
+	m := ScoredMember{Member: member, Score: z.scores[member]}
+	if i, found := slices.BinarySearchFunc(z.ranked, m, compareScored); found {
+		z.ranked = slices.Delete(z.ranked, i, i+1)
+	}
+}
+
+// insert adds member to the rank order. The caller updates scores.
+func (z *sortedSetValue) insert(m ScoredMember) {
+	i, _ := slices.BinarySearchFunc(z.ranked, m, compareScored)
+	z.ranked = slices.Insert(z.ranked, i, m)
+}
+
+// rangeBounds resolves inclusive start and stop indexes, which may be negative,
+// against a sequence of length n. Returns ok == false if the range is empty.
+func rangeBounds(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+	if start > stop {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
@@ -0,0 +1,274 @@
+package kv_store
+
+import (
+	"hash/maphash"
+	"math"
+	"math/rand/v2"
+	"sync"
+)
+
+const (
+	// cuckooBucketSize is the number of fingerprints in a bucket of a cuckooTable.
+	cuckooBucketSize = 4
+
+	// cuckooMaxKicks is the number of fingerprints moved to make room for
+	// another before a table is considered full.
+	cuckooMaxKicks = 500
+
+	// cuckooMaxLoad is the share of the slots of a table filled before a larger
+	// table is added, above which insertions start to fail.
+	cuckooMaxLoad = 0.9
+
+	// cuckooMinCapacity is the number of keys the first table of a filter is sized for, at least.
+	cuckooMinCapacity = 1024
+
+	cuckooMinFingerprintBits = 4
+	cuckooMaxFingerprintBits = 32
+
+	// cuckooAltMultiplier scatters fingerprints to derive the second bucket of a key.
+	cuckooAltMultiplier = 0x5bd1e995
+)
+
+// cuckooFilter tells whether a key may be in a set, with a bounded rate of false
+// positives and no false negatives, and supports removing keys. Keys are
+// recorded as short fingerprints in one of two buckets of a cuckooTable: the
+// second bucket is derived from the first and the fingerprint, so that
+// fingerprints can be moved between their buckets to make room for others
+// without knowing their keys.
+//
+// A table can't grow without its keys, so a full filter adds a table twice as
+// large, with fingerprints one bit longer: the false positive rates of all the
+// tables add up to at most twice the rate of the first one, which is set to
+// half of the rate asked for. A key is only removed if a single table may hold
+// it, since the fingerprint matching it in another table may be another key's.
+type cuckooFilter struct {
+	tables []*cuckooTable
+	bits   uint
+	seed   maphash.Seed
+	mu     sync.RWMutex
+}
+
+// newCuckooFilter creates a filter sized for capacity keys, growing as needed,
+// whose false positives are at most falsePositiveRate of the lookups of missing keys.
+func newCuckooFilter(capacity int, falsePositiveRate float64) *cuckooFilter {
+	// A lookup compares 2 buckets of fingerprints, each matching with a
+	// probability of 1/2^bits
+	bits := math.Ceil(math.Log2(2 * cuckooBucketSize / (falsePositiveRate / 2)))
+	f := &cuckooFilter{
+		bits: uint(min(max(bits, cuckooMinFingerprintBits), cuckooMaxFingerprintBits)),
+		seed: maphash.MakeSeed(),
+	}
+	f.tables = []*cuckooTable{newCuckooTable(max(capacity, cuckooMinCapacity), f.bits)}
+	return f
+}
+
+// add records key. Keys must be added once, however many times they are written.
+func (f *cuckooFilter) add(key string) {
+	h := maphash.String(f.seed, key)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for {
+		t := f.tables[len(f.tables)-1]
+		if !t.loaded() && t.insert(h) {
+			return
+		}
+		f.tables = append(f.tables, newCuckooTable(2*t.capacity(), min(t.bits+1, cuckooMaxFingerprintBits)))
+	}
+}
+
+// contains reports whether key may have been added and not removed since.
+func (f *cuckooFilter) contains(key string) bool {
+	h := maphash.String(f.seed, key)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, t := range f.tables {
+		if t.contains(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// remove removes key, which must have been added, unless more than one table
+// may hold it: key is then left in the filter, as a false positive.
+func (f *cuckooFilter) remove(key string) {
+	h := maphash.String(f.seed, key)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var holder *cuckooTable
+	for _, t := range f.tables {
+		if !t.contains(h) {
+			continue
+		}
+		if holder != nil {
+			return
+		}
+		holder = t
+	}
+	if holder != nil {
+		holder.remove(h)
+	}
+}
+
+// reset removes all keys, and the tables added as the filter grew.
+func (f *cuckooFilter) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.tables = []*cuckooTable{newCuckooTable(cuckooMinCapacity, f.bits)}
+}
+
+// len returns the number of fingerprints in the filter.
+func (f *cuckooFilter) len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	n := 0
+	for _, t := range f.tables {
+		n += t.count
+	}
+	return n
+}
+
+// bytes returns the memory taken by the fingerprints of the filter.
+func (f *cuckooFilter) bytes() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	n := 0
+	for _, t := range f.tables {
+		n += 4 * len(t.slots)
+	}
+	return n
+}
+
+// cuckooTable holds fingerprints of bits bits in buckets of cuckooBucketSize
+// slots. Empty slots hold 0, which is never a fingerprint.
+type cuckooTable struct {
+	slots []uint32
+	mask  uint64
+	bits  uint
+	count int
+}
+
+// newCuckooTable creates a table holding capacity fingerprints below its maximum load.
+func newCuckooTable(capacity int, bits uint) *cuckooTable {
+	buckets := 1
+	for float64(buckets*cuckooBucketSize)*cuckooMaxLoad < float64(capacity) {
+		buckets *= 2
+	}
+	return &cuckooTable{
+		slots: make([]uint32, buckets*cuckooBucketSize),
+		mask:  uint64(buckets - 1),
+		bits:  bits,
+	}
+}
+
+// capacity returns the number of fingerprints the table holds below its maximum load.
+func (t *cuckooTable) capacity() int {
+	return int(float64(len(t.slots)) * cuckooMaxLoad)
+}
+
+// loaded reports whether the table holds as many fingerprints as it should.
+func (t *cuckooTable) loaded() bool {
+	return t.count >= t.capacity()
+}
+
+// locate returns the first bucket and the fingerprint of the key hashed to h.
+func (t *cuckooTable) locate(h uint64) (uint64, uint32) {
+	fp := uint32(h>>32) >> (32 - t.bits)
+	if fp == 0 {
+		fp = 1
+	}
+	return h & t.mask, fp
+}
+
+// alt returns the other bucket of the fingerprint fp in bucket i.
+func (t *cuckooTable) alt(i uint64, fp uint32) uint64 {
+	return (i ^ uint64(fp)*cuckooAltMultiplier) & t.mask
+}
+
+// bucket returns the slots of bucket i.
+func (t *cuckooTable) bucket(i uint64) []uint32 {
+	return t.slots[i*cuckooBucketSize : (i+1)*cuckooBucketSize]
+}
+
+func (t *cuckooTable) contains(h uint64) bool {
+	i, fp := t.locate(h)
+	for _, b := range [][]uint32{t.bucket(i), t.bucket(t.alt(i, fp))} {
+		for _, slot := range b {
+			if slot == fp {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// place puts fp in an empty slot of bucket i, if any.
+func (t *cuckooTable) place(i uint64, fp uint32) bool {
+	b := t.bucket(i)
+	for j := range b {
+		if b[j] == 0 {
+			b[j] = fp
+			t.count++
+			return true
+		}
+	}
+	return false
+}
+
+// insert adds the key hashed to h, moving fingerprints to their other bucket
+// to make room if needed. Returns false if the table is full: the moves are
+// then undone, so that no fingerprint is lost.
+func (t *cuckooTable) insert(h uint64) bool {
+	i, fp := t.locate(h)
+	if t.place(i, fp) || t.place(t.alt(i, fp), fp) {
+		return true
+	}
+
+	// kicked records the slots overwritten, and the fingerprints they held
+	type kick struct {
+		slot int
+		fp   uint32
+	}
+	var kicked []kick
+
+	if rand.IntN(2) == 0 {
+		i = t.alt(i, fp)
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		slot := int(i)*cuckooBucketSize + rand.IntN(cuckooBucketSize)
+		kicked = append(kicked, kick{slot: slot, fp: t.slots[slot]})
+		fp, t.slots[slot] = t.slots[slot], fp
+
+		i = t.alt(i, fp)
+		if t.place(i, fp) {
+			return true
+		}
+	}
+
+	for n := len(kicked) - 1; n >= 0; n-- {
+		t.slots[kicked[n].slot] = kicked[n].fp
+	}
+	return false
+}
+
+func (t *cuckooTable) remove(h uint64) {
+	i, fp := t.locate(h)
+	for _, b := range [][]uint32{t.bucket(i), t.bucket(t.alt(i, fp))} {
+		for j := range b {
+			if b[j] == fp {
+				b[j] = 0
+				t.count--
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package kv_store
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"testing"
+)
+
+func TestCuckooFilter(t *testing.T) {
+	t.Run("added keys are found as the filter grows", func(t *testing.T) {
+		f := newCuckooFilter(0, 0.01)
+		for i := 0; i < 10000; i++ {
+			f.add(strconv.Itoa(i))
+		}
+
+		if len(f.tables) < 2 {
+			t.Fatalf("Expected the filter to grow, got %d tables", len(f.tables))
+		}
+		for i := 0; i < 10000; i++ {
+			if !f.contains(strconv.Itoa(i)) {
+				t.Fatalf("Expected %d to be found", i)
+			}
+		}
+		if f.len() != 10000 {
+			t.Fatalf("Expected 10000 keys, got %d", f.len())
+		}
+	})
+
+	t.Run("false positives stay below the rate", func(t *testing.T) {
+		for _, rate := range []float64{0.1, 0.01} {
+			f := newCuckooFilter(0, rate)
+			for i := 0; i < 10000; i++ {
+				f.add(strconv.Itoa(i))
+			}
+
+			falsePositives := 0
+			for i := 10000; i < 110000; i++ {
+				if f.contains(strconv.Itoa(i)) {
+					falsePositives++
+				}
+			}
+			if got := float64(falsePositives) / 100000; got > rate {
+				t.Fatalf("Expected a false positive rate below %v, got %v", rate, got)
+			}
+		}
+	})
+
+	t.Run("removed keys are not found", func(t *testing.T) {
+		f := newCuckooFilter(1000, 0.001)
+		for i := 0; i < 1000; i++ {
+			f.add(strconv.Itoa(i))
+		}
+		for i := 0; i < 1000; i += 2 {
+			f.remove(strconv.Itoa(i))
+		}
+
+		found := 0
+		for i := 0; i < 1000; i++ {
+			ok := f.contains(strconv.Itoa(i))
+			if i%2 == 1 && !ok {
+				t.Fatalf("Expected %d to be found", i)
+			}
+			if i%2 == 0 && ok {
+				found++
+			}
+		}
+		if found > 5 {
+			t.Fatalf("Expected the removed keys to be missing, got %d found", found)
+		}
+		if f.len() != 500 {
+			t.Fatalf("Expected 500 keys, got %d", f.len())
+		}
+	})
+
+	t.Run("a full table loses no fingerprint", func(t *testing.T) {
+		table := newCuckooTable(16, 8)
+
+		var added []uint64
+		for {
+			h := rand.Uint64()
+			if !table.insert(h) {
+				break
+			}
+			added = append(added, h)
+		}
+
+		if table.count != len(added) {
+			t.Fatalf("Expected %d fingerprints, got %d", len(added), table.count)
+		}
+		for _, h := range added {
+			if !table.contains(h) {
+				t.Fatalf("Expected every fingerprint added to be found")
+			}
+		}
+	})
+
+	t.Run("reset removes all keys", func(t *testing.T) {
+		f := newCuckooFilter(0, 0.01)
+		for i := 0; i < 5000; i++ {
+			f.add(strconv.Itoa(i))
+		}
+		f.reset()
+
+		if f.len() != 0 || len(f.tables) != 1 {
+			t.Fatalf("Expected an empty filter with one table, got %d keys in %d tables", f.len(), len(f.tables))
+		}
+	})
+}
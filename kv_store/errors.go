@@ -0,0 +1,71 @@
+package kv_store
+
+import "errors"
+
+var (
+	// ErrKeyNotFound is returned when a key does not exist in the store.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrCompacted is returned when reading at a revision whose versions have
+	// already been garbage-collected.
+	ErrCompacted = errors.New("revision has been compacted")
+
+	// ErrFutureRevision is returned when reading at a revision newer than the
+	// latest revision of the store.
+	ErrFutureRevision = errors.New("revision is in the future")
+
+	// ErrVersionNotFound is returned when a key has no retained version at the
+	// requested revision.
+	ErrVersionNotFound = errors.New("version not found")
+
+	// ErrNotInteger is returned by numeric operations on values that are not
+	// base-10 64-bit integers.
+	ErrNotInteger = errors.New("value is not an integer")
+
+	// ErrOverflow is returned by numeric operations whose result does not fit
+	// in a 64-bit integer.
+	ErrOverflow = errors.New("integer overflow")
+
+	// ErrInvalidOffset is returned by range writes at a negative offset or past
+	// the maximum value length.
+	ErrInvalidOffset = errors.New("offset out of range")
+
+	// ErrWrongType is returned by operations on a key holding a value of another type.
+	ErrWrongType = errors.New("operation against a key holding the wrong kind of value")
+
+	// ErrKeyTooLong is returned when a key is longer than the store's limit.
+	ErrKeyTooLong = errors.New("key too long")
+
+	// ErrValueTooLarge is returned when a value is larger than the store's limit.
+	ErrValueTooLarge = errors.New("value too large")
+
+	// ErrQuotaExceeded is returned when a write would exceed the store's key count or size quota.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+
+	// ErrCollectionsUnsupported is returned by collection operations on a
+	// wrapper whose backend doesn't support collection values.
+	ErrCollectionsUnsupported = errors.New("collections are not supported")
+
+	// ErrTTLUnsupported is returned when writing a key with a time to live to
+	// a wrapper whose backend doesn't support expiring keys.
+	ErrTTLUnsupported = errors.New("expiring keys are not supported")
+
+	// ErrOutOfMemory is returned when a write doesn't fit in a bounded store's memory budget.
+	ErrOutOfMemory = errors.New("out of memory")
+
+	// ErrIndexNotFound is returned when an index does not exist.
+	ErrIndexNotFound = errors.New("index not found")
+
+	// ErrBucketNotFound is returned when a bucket does not exist.
+	ErrBucketNotFound = errors.New("bucket not found")
+
+	// ErrInvalidBucketName is returned when creating a bucket with an invalid name.
+	ErrInvalidBucketName = errors.New("invalid bucket name")
+
+	// ErrDefaultBucket is returned when deleting the default bucket.
+	ErrDefaultBucket = errors.New("the default bucket cannot be deleted")
+
+	// ErrBucketsUnsupported is returned when creating a bucket in a registry
+	// without a store factory.
+	ErrBucketsUnsupported = errors.New("buckets are not supported")
+)
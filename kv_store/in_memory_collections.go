@@ -0,0 +1,404 @@
+package kv_store
+
+import (
+	"slices"
+	"sort"
+)
+
+// lookupCollection returns the collection of type T held by key, and whether it
+// exists. Returns ErrWrongType if the key holds another type of value.
+// The caller must hold mu.
+func lookupCollection[T collection](i *InMemoryStore, key string) (T, bool, error) {
+	var zero T
+	if i.expired(key) {
+		return zero, false, nil
+	}
+	if _, ok := i.mapStore[key]; ok {
+		return zero, false, ErrWrongType
+	}
+
+	c, ok := i.collections[key]
+	if !ok {
+		return zero, false, nil
+	}
+	t, ok := c.(T)
+	if !ok {
+		return zero, false, ErrWrongType
+	}
+	return t, true, nil
+}
+
+// createCollection returns the collection of type T held by key, creating it
+// with newFn if the key doesn't exist, and reserves memory for it to grow by
+// up to growth bytes. The caller must hold mu for writing, and expire key first.
+func createCollection[T collection](i *InMemoryStore, key string, growth int, newFn func() T) (T, error) {
+	c, ok, err := lookupCollection[T](i, key)
+	if err != nil {
+		return c, err
+	}
+
+	before := i.sizeOf(key)
+	if err := i.reserve(key, before, max(before, len(key))+growth); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	if !ok {
+		c = newFn()
+		i.collections[key] = c
+	}
+	return c, nil
+}
+
+// collectionWritten removes the collection held by key once it has no elements
+// left, and records that its size changed from before bytes.
+// The caller must hold mu for writing.
+func (i *InMemoryStore) collectionWritten(key string, c collection, before int) {
+	if c.len() == 0 {
+		delete(i.collections, key)
+		delete(i.expiries, key)
+	}
+	i.written(key, before)
+}
+
+// byteLen returns the total length of values.
+func byteLen(values []string) int {
+	n := 0
+	for _, v := range values {
+		n += len(v)
+	}
+	return n
+}
+
+func (i *InMemoryStore) Type(key string) KeyType {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.expired(key) {
+		return TypeNone
+	}
+	if _, ok := i.mapStore[key]; ok {
+		return TypeString
+	}
+	if c, ok := i.collections[key]; ok {
+		return c.keyType()
+	}
+	return TypeNone
+}
+
+func newList() *listValue {
+	return &listValue{}
+}
+
+func (i *InMemoryStore) LPush(key string, values ...string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire(key)
+	before := i.sizeOf(key)
+	l, err := createCollection(i, key, byteLen(values), newList)
+	if err != nil {
+		return 0, err
+	}
+
+	// Pushing each value to the head leaves the last one first
+	l.head = append(l.head, values...)
+	l.bytes += byteLen(values)
+	i.collectionWritten(key, l, before)
+	return l.len(), nil
+}
+
+func (i *InMemoryStore) RPush(key string, values ...string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire(key)
+	before := i.sizeOf(key)
+	l, err := createCollection(i, key, byteLen(values), newList)
+	if err != nil {
+		return 0, err
+	}
+
+	l.tail = append(l.tail, values...)
+	l.bytes += byteLen(values)
+	i.collectionWritten(key, l, before)
+	return l.len(), nil
+}
+
+func (i *InMemoryStore) LPop(key string) (string, error) {
+	return i.pop(key, (*listValue).popFront)
+}
+
+func (i *InMemoryStore) RPop(key string) (string, error) {
+	return i.pop(key, (*listValue).popBack)
+}
+
+func (i *InMemoryStore) pop(key string, popFn func(l *listValue) string) (string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire(key)
+	l, ok, err := lookupCollection[*listValue](i, key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+
+	before := i.sizeOf(key)
+	value := popFn(l)
+	l.bytes -= len(value)
+	i.collectionWritten(key, l, before)
+	return value, nil
+}
+
+func (i *InMemoryStore) LRange(key string, start, stop int) ([]string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	l, ok, err := lookupCollection[*listValue](i, key)
+	if err != nil || !ok {
+		return []string{}, err
+	}
+	i.touched(key)
+
+	start, stop, ok = rangeBounds(start, stop, l.len())
+	if !ok {
+		return []string{}, nil
+	}
+	values := make([]string, 0, stop-start+1)
+	for j := start; j <= stop; j++ {
+		values = append(values, l.at(j))
+	}
+	return values, nil
+}
+
+func newSet() *setValue {
+	return &setValue{members: make(map[string]struct{})}
+}
+
+func (i *InMemoryStore) SAdd(key string, members ...string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire(key)
+	before := i.sizeOf(key)
+	s, err := createCollection(i, key, byteLen(members), newSet)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, m := range members {
+		if _, ok := s.members[m]; !ok {
+			s.members[m] = struct{}{}
+			s.bytes += len(m)
+			added++
+		}
+	}
+	i.collectionWritten(key, s, before)
+	return added, nil
+}
+
+func (i *InMemoryStore) SRem(key string, members ...string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire(key)
+	s, ok, err := lookupCollection[*setValue](i, key)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	before := i.sizeOf(key)
+	removed := 0
+	for _, m := range members {
+		if _, ok := s.members[m]; ok {
+			delete(s.members, m)
+			s.bytes -= len(m)
+			removed++
+		}
+	}
+	i.collectionWritten(key, s, before)
+	return removed, nil
+}
+
+func (i *InMemoryStore) SMembers(key string) ([]string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	s, ok, err := lookupCollection[*setValue](i, key)
+	if err != nil || !ok {
+		return []string{}, err
+	}
+	i.touched(key)
+
+	members := make([]string, 0, len(s.members))
+	for m := range s.members {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+func newHash() *hashValue {
+	return &hashValue{fields: make(map[string]string)}
+}
+
+func (i *InMemoryStore) HSet(key string, field string, value string) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire(key)
+	before := i.sizeOf(key)
+	h, err := createCollection(i, key, len(field)+len(value), newHash)
+	if err != nil {
+		return false, err
+	}
+
+	old, exists := h.fields[field]
+	if exists {
+		h.bytes -= len(field) + len(old)
+	}
+	h.fields[field] = value
+	h.bytes += len(field) + len(value)
+	i.collectionWritten(key, h, before)
+	return !exists, nil
+}
+
+func (i *InMemoryStore) HGet(key string, field string) (string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	h, ok, err := lookupCollection[*hashValue](i, key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+
+	value, ok := h.fields[field]
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	i.touched(key)
+	return value, nil
+}
+
+func (i *InMemoryStore) HDel(key string, fields ...string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire(key)
+	h, ok, err := lookupCollection[*hashValue](i, key)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	before := i.sizeOf(key)
+	removed := 0
+	for _, f := range fields {
+		if v, ok := h.fields[f]; ok {
+			delete(h.fields, f)
+			h.bytes -= len(f) + len(v)
+			removed++
+		}
+	}
+	i.collectionWritten(key, h, before)
+	return removed, nil
+}
+
+func (i *InMemoryStore) HGetAll(key string) (map[string]string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	h, ok, err := lookupCollection[*hashValue](i, key)
+	if err != nil || !ok {
+		return map[string]string{}, err
+	}
+	i.touched(key)
+
+	fields := make(map[string]string, len(h.fields))
+	for f, v := range h.fields {
+		fields[f] = v
+	}
+	return fields, nil
+}
+
+func newSortedSet() *sortedSetValue {
+	return &sortedSetValue{scores: make(map[string]float64)}
+}
+
+func (i *InMemoryStore) ZAdd(key string, members map[string]float64) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	growth := 0
+	for m := range members {
+		growth += len(m) + scoreSize
+	}
+
+	i.expire(key)
+	before := i.sizeOf(key)
+	z, err := createCollection(i, key, growth, newSortedSet)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for m, score := range members {
+		if _, ok := z.scores[m]; ok {
+			z.remove(m)
+		} else {
+			z.bytes += len(m) + scoreSize
+			added++
+		}
+		z.scores[m] = score
+		z.insert(ScoredMember{Member: m, Score: score})
+	}
+	i.collectionWritten(key, z, before)
+	return added, nil
+}
+
+func (i *InMemoryStore) ZRem(key string, members ...string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire(key)
+	z, ok, err := lookupCollection[*sortedSetValue](i, key)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	before := i.sizeOf(key)
+	removed := 0
+	for _, m := range members {
+		if _, ok := z.scores[m]; ok {
+			z.remove(m)
+			delete(z.scores, m)
+			z.bytes -= len(m) + scoreSize
+			removed++
+		}
+	}
+	i.collectionWritten(key, z, before)
+	return removed, nil
+}
+
+func (i *InMemoryStore) ZRange(key string, start, stop int) ([]ScoredMember, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	z, ok, err := lookupCollection[*sortedSetValue](i, key)
+	if err != nil || !ok {
+		return []ScoredMember{}, err
+	}
+	i.touched(key)
+
+	start, stop, ok = rangeBounds(start, stop, len(z.ranked))
+	if !ok {
+		return []ScoredMember{}, nil
+	}
+	return slices.Clone(z.ranked[start : stop+1]), nil
+}
@@ -0,0 +1,250 @@
+package kv_store
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCollectionTypes(t *testing.T) {
+	store := NewInMemoryStore()
+	store.Put("string", "value")
+	store.RPush("list", "a")
+	store.SAdd("set", "a")
+	store.HSet("hash", "field", "value")
+	store.ZAdd("zset", map[string]float64{"a": 1})
+
+	tests := []struct {
+		key      string
+		expected KeyType
+	}{
+		{"string", TypeString},
+		{"list", TypeList},
+		{"set", TypeSet},
+		{"hash", TypeHash},
+		{"zset", TypeSortedSet},
+		{"missing", TypeNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := store.Type(tt.key); got != tt.expected {
+				t.Fatalf("Expected type %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("wrong type errors", func(t *testing.T) {
+		if _, err := store.Get("list"); !errors.Is(err, ErrWrongType) {
+			t.Fatalf("Expected ErrWrongType from Get, got %v", err)
+		}
+		if _, err := store.Append("set", "x"); !errors.Is(err, ErrWrongType) {
+			t.Fatalf("Expected ErrWrongType from Append, got %v", err)
+		}
+		if _, err := store.SAdd("list", "x"); !errors.Is(err, ErrWrongType) {
+			t.Fatalf("Expected ErrWrongType from SAdd, got %v", err)
+		}
+		if _, err := store.LPush("string", "x"); !errors.Is(err, ErrWrongType) {
+			t.Fatalf("Expected ErrWrongType from LPush, got %v", err)
+		}
+		if _, err := store.HGet("zset", "a"); !errors.Is(err, ErrWrongType) {
+			t.Fatalf("Expected ErrWrongType from HGet, got %v", err)
+		}
+	})
+
+	t.Run("put replaces collections", func(t *testing.T) {
+		store.Put("hash", "value")
+
+		if got := store.Type("hash"); got != TypeString {
+			t.Fatalf("Expected type string, got %s", got)
+		}
+	})
+
+	t.Run("delete removes collections", func(t *testing.T) {
+		store.Delete("zset")
+
+		if got := store.Type("zset"); got != TypeNone {
+			t.Fatalf("Expected type none, got %s", got)
+		}
+	})
+
+	t.Run("entries only list strings", func(t *testing.T) {
+		entries, _ := store.Entries()
+
+		for _, entry := range entries {
+			if entry.Key == "list" || entry.Key == "set" {
+				t.Fatalf("Expected collections to be excluded from entries, got %s", entry.Key)
+			}
+		}
+	})
+}
+
+func TestLists(t *testing.T) {
+	store := NewInMemoryStore()
+
+	store.RPush("list", "c", "d")
+	n, err := store.LPush("list", "b", "a")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if n != 4 {
+		t.Fatalf("Expected length 4, got %d", n)
+	}
+
+	tests := []struct {
+		start, stop int
+		expected    []string
+	}{
+		{0, -1, []string{"a", "b", "c", "d"}},
+		{1, 2, []string{"b", "c"}},
+		{-2, -1, []string{"c", "d"}},
+		{2, 100, []string{"c", "d"}},
+		{3, 1, []string{}},
+	}
+	for _, tt := range tests {
+		got, err := store.LRange("list", tt.start, tt.stop)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !slices.Equal(got, tt.expected) {
+			t.Fatalf("LRange(%d, %d): expected %v, got %v", tt.start, tt.stop, tt.expected, got)
+		}
+	}
+
+	head, _ := store.LPop("list")
+	tail, _ := store.RPop("list")
+	if head != "a" || tail != "d" {
+		t.Fatalf("Expected to pop 'a' and 'd', got '%s' and '%s'", head, tail)
+	}
+
+	store.LPop("list")
+	store.LPop("list")
+	if _, err := store.LPop("list"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Expected ErrKeyNotFound from empty list, got %v", err)
+	}
+	if got := store.Type("list"); got != TypeNone {
+		t.Fatalf("Expected empty list to be removed, got type %s", got)
+	}
+}
+
+func TestListsPopAcrossEnds(t *testing.T) {
+	store := NewInMemoryStore()
+
+	// Elements pushed to one end are popped from the other in order
+	store.LPush("list", "c", "b", "a")
+	for _, expected := range []string{"c", "b"} {
+		if value, _ := store.RPop("list"); value != expected {
+			t.Fatalf("Expected to pop '%s', got '%s'", expected, value)
+		}
+	}
+	store.RPush("list", "b", "c")
+	store.LPush("list", "z")
+	for _, expected := range []string{"z", "a", "b"} {
+		if value, _ := store.LPop("list"); value != expected {
+			t.Fatalf("Expected to pop '%s', got '%s'", expected, value)
+		}
+	}
+
+	got, _ := store.LRange("list", 0, -1)
+	if !slices.Equal(got, []string{"c"}) {
+		t.Fatalf("Expected [c], got %v", got)
+	}
+}
+
+func TestSets(t *testing.T) {
+	store := NewInMemoryStore()
+
+	added, _ := store.SAdd("set", "b", "a", "b")
+	if added != 2 {
+		t.Fatalf("Expected 2 members added, got %d", added)
+	}
+	added, _ = store.SAdd("set", "a", "c")
+	if added != 1 {
+		t.Fatalf("Expected 1 member added, got %d", added)
+	}
+
+	members, _ := store.SMembers("set")
+	if !slices.Equal(members, []string{"a", "b", "c"}) {
+		t.Fatalf("Expected members [a b c], got %v", members)
+	}
+
+	removed, _ := store.SRem("set", "a", "x")
+	if removed != 1 {
+		t.Fatalf("Expected 1 member removed, got %d", removed)
+	}
+
+	store.SRem("set", "b", "c")
+	if got := store.Type("set"); got != TypeNone {
+		t.Fatalf("Expected empty set to be removed, got type %s", got)
+	}
+}
+
+func TestHashes(t *testing.T) {
+	store := NewInMemoryStore()
+
+	created, _ := store.HSet("hash", "name", "ada")
+	if !created {
+		t.Fatal("Expected field to be created")
+	}
+	created, _ = store.HSet("hash", "name", "grace")
+	if created {
+		t.Fatal("Expected field to be updated")
+	}
+	store.HSet("hash", "role", "admin")
+
+	value, err := store.HGet("hash", "name")
+	if err != nil || value != "grace" {
+		t.Fatalf("Expected 'grace', got '%s' (err: %v)", value, err)
+	}
+	if _, err := store.HGet("hash", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Expected ErrKeyNotFound for missing field, got %v", err)
+	}
+
+	fields, _ := store.HGetAll("hash")
+	if len(fields) != 2 || fields["role"] != "admin" {
+		t.Fatalf("Expected {name: grace, role: admin}, got %v", fields)
+	}
+
+	removed, _ := store.HDel("hash", "name", "role", "missing")
+	if removed != 2 {
+		t.Fatalf("Expected 2 fields removed, got %d", removed)
+	}
+	if got := store.Type("hash"); got != TypeNone {
+		t.Fatalf("Expected empty hash to be removed, got type %s", got)
+	}
+}
+
+func TestSortedSets(t *testing.T) {
+	store := NewInMemoryStore()
+
+	added, _ := store.ZAdd("zset", map[string]float64{"c": 3, "a": 1, "b": 2, "b2": 2})
+	if added != 4 {
+		t.Fatalf("Expected 4 members added, got %d", added)
+	}
+
+	// Updating a score moves the member
+	added, _ = store.ZAdd("zset", map[string]float64{"a": 10})
+	if added != 0 {
+		t.Fatalf("Expected 0 members added, got %d", added)
+	}
+
+	members, _ := store.ZRange("zset", 0, -1)
+	expected := []ScoredMember{{"b", 2}, {"b2", 2}, {"c", 3}, {"a", 10}}
+	if !slices.Equal(members, expected) {
+		t.Fatalf("Expected %v, got %v", expected, members)
+	}
+
+	members, _ = store.ZRange("zset", -2, -1)
+	if !slices.Equal(members, expected[2:]) {
+		t.Fatalf("Expected %v, got %v", expected[2:], members)
+	}
+
+	removed, _ := store.ZRem("zset", "b", "missing")
+	if removed != 1 {
+		t.Fatalf("Expected 1 member removed, got %d", removed)
+	}
+	members, _ = store.ZRange("zset", 0, 0)
+	if len(members) != 1 || members[0].Member != "b2" {
+		t.Fatalf("Expected lowest member b2, got %v", members)
+	}
+}
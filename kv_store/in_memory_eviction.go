@@ -0,0 +1,486 @@
+package kv_store
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// EvictionPolicy selects the keys a bounded InMemoryStore evicts to stay within its memory budget.
+type EvictionPolicy string
+
+const (
+	// EvictLRU evicts the least recently used key.
+	EvictLRU EvictionPolicy = "lru"
+
+	// EvictLFU evicts the least frequently used key, and the least recently used one among those.
+	EvictLFU EvictionPolicy = "lfu"
+
+	// EvictRandom evicts a random key.
+	EvictRandom EvictionPolicy = "random"
+
+	// EvictVolatileTTL evicts the key with a time to live that expires the soonest.
+	// Keys without a time to live are never evicted.
+	EvictVolatileTTL EvictionPolicy = "volatile-ttl"
+
+	// EvictReject never evicts keys, and rejects writes instead.
+	EvictReject EvictionPolicy = "reject"
+)
+
+// evictionPolicy tracks the keys of a store to choose which one to evict.
+type evictionPolicy interface {
+	// touch records a read of key.
+	touch(key string)
+
+	// track records a write of key, which expires at expiry, or never if expiry is zero.
+	track(key string, expiry time.Time)
+
+	// remove stops tracking key.
+	remove(key string)
+
+	// victim returns the key to evict other than exclude, and false if there is none.
+	victim(exclude string) (string, bool)
+}
+
+func newEvictionPolicy(policy EvictionPolicy) (evictionPolicy, error) {
+	switch policy {
+	case EvictLRU:
+		return &lruPolicy{order: list.New(), elements: make(map[string]*list.Element)}, nil
+	case EvictLFU:
+		return &lfuPolicy{heap: newKeyHeap()}, nil
+	case EvictRandom:
+		return &randomPolicy{indexes: make(map[string]int)}, nil
+	case EvictVolatileTTL:
+		return &ttlPolicy{heap: newKeyHeap()}, nil
+	case EvictReject:
+		return rejectPolicy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown eviction policy %q", policy)
+	}
+}
+
+// lruPolicy keeps keys in a list ordered from most to least recently used, like cache.LRUCache.
+type lruPolicy struct {
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+func (p *lruPolicy) touch(key string) {
+	if e, ok := p.elements[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy) track(key string, _ time.Time) {
+	if e, ok := p.elements[key]; ok {
+		p.order.MoveToFront(e)
+		return
+	}
+	p.elements[key] = p.order.PushFront(key)
+}
+
+func (p *lruPolicy) remove(key string) {
+	if e, ok := p.elements[key]; ok {
+		p.order.Remove(e)
+		delete(p.elements, key)
+	}
+}
+
+func (p *lruPolicy) victim(exclude string) (string, bool) {
+	for e := p.order.Back(); e != nil; e = e.Prev() {
+		if key := e.Value.(string); key != exclude {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// lfuSampleRatio is the number of accesses, relative to the number of keys
+// tracked by an lfuPolicy, after which all access counts are halved.
+const lfuSampleRatio = 10
+
+// lfuPolicy ranks keys by access count, then by the time of their last access.
+// Counts are halved periodically, like the counters of cache.TinyLFUCache, so
+// that counts favour recent accesses and keys that were popular a long time
+// ago can be evicted once the access pattern shifts.
+type lfuPolicy struct {
+	heap     keyHeap
+	seq      int64
+	accesses int
+}
+
+func (p *lfuPolicy) touch(key string) {
+	if rank, ok := p.heap.rank(key); ok {
+		p.seq++
+		p.heap.set(key, [2]int64{rank[0] + 1, p.seq})
+		p.accessed()
+	}
+}
+
+func (p *lfuPolicy) track(key string, _ time.Time) {
+	if _, ok := p.heap.rank(key); ok {
+		p.touch(key)
+		return
+	}
+	p.seq++
+	p.heap.set(key, [2]int64{1, p.seq})
+	p.accessed()
+}
+
+// accessed counts an access, and halves all access counts once the sample of
+// accesses is full.
+func (p *lfuPolicy) accessed() {
+	p.accesses++
+	if p.accesses < lfuSampleRatio*len(p.heap.entries) {
+		return
+	}
+
+	for i := range p.heap.entries {
+		p.heap.entries[i].rank[0] /= 2
+	}
+	// Halving can break ties in favour of keys accessed less recently
+	heap.Init(&p.heap)
+	p.accesses /= 2
+}
+
+func (p *lfuPolicy) remove(key string) {
+	p.heap.remove(key)
+}
+
+func (p *lfuPolicy) victim(exclude string) (string, bool) {
+	return p.heap.min(exclude)
+}
+
+// randomPolicy keeps keys in a slice to pick a random one in constant time.
+type randomPolicy struct {
+	keys    []string
+	indexes map[string]int
+}
+
+func (p *randomPolicy) touch(string) {}
+
+func (p *randomPolicy) track(key string, _ time.Time) {
+	if _, ok := p.indexes[key]; ok {
+		return
+	}
+	p.indexes[key] = len(p.keys)
+	p.keys = append(p.keys, key)
+}
+
+func (p *randomPolicy) remove(key string) {
+	i, ok := p.indexes[key]
+	if !ok {
+		return
+	}
+
+	last := len(p.keys) - 1
+	p.keys[i] = p.keys[last]
+	p.indexes[p.keys[i]] = i
+	p.keys = p.keys[:last]
+	delete(p.indexes, key)
+}
+
+func (p *randomPolicy) victim(exclude string) (string, bool) {
+	switch n := len(p.keys); {
+	case n == 0:
+		return "", false
+	case n == 1 && p.keys[0] == exclude:
+		return "", false
+	default:
+		i := rand.IntN(n)
+		if p.keys[i] == exclude {
+			i = (i + 1) % n
+		}
+		return p.keys[i], true
+	}
+}
+
+// ttlPolicy ranks the keys that have a time to live by expiry time.
+type ttlPolicy struct {
+	heap keyHeap
+}
+
+func (p *ttlPolicy) touch(string) {}
+
+func (p *ttlPolicy) track(key string, expiry time.Time) {
+	if expiry.IsZero() {
+		p.heap.remove(key)
+		return
+	}
+	p.heap.set(key, [2]int64{expiry.UnixNano(), 0})
+}
+
+func (p *ttlPolicy) remove(key string) {
+	p.heap.remove(key)
+}
+
+func (p *ttlPolicy) victim(exclude string) (string, bool) {
+	return p.heap.min(exclude)
+}
+
+// keyHeap is a min-heap of keys ordered by rank, indexed by key so that ranks
+// can be updated and keys removed in logarithmic time.
+type keyHeap struct {
+	entries []rankedKey
+	indexes map[string]int
+}
+
+type rankedKey struct {
+	key  string
+	rank [2]int64
+}
+
+func newKeyHeap() keyHeap {
+	return keyHeap{indexes: make(map[string]int)}
+}
+
+func (h *keyHeap) Len() int { return len(h.entries) }
+
+func (h *keyHeap) Less(i, j int) bool {
+	a, b := h.entries[i].rank, h.entries[j].rank
+	return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
+}
+
+func (h *keyHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.indexes[h.entries[i].key] = i
+	h.indexes[h.entries[j].key] = j
+}
+
+func (h *keyHeap) Push(x any) {
+	e := x.(rankedKey)
+	h.indexes[e.key] = len(h.entries)
+	h.entries = append(h.entries, e)
+}
+
+func (h *keyHeap) Pop() any {
+	last := len(h.entries) - 1
+	e := h.entries[last]
+	h.entries = h.entries[:last]
+	delete(h.indexes, e.key)
+	return e
+}
+
+// rank returns the rank of key, and whether it is in the heap.
+func (h *keyHeap) rank(key string) ([2]int64, bool) {
+	i, ok := h.indexes[key]
+	if !ok {
+		return [2]int64{}, false
+	}
+	return h.entries[i].rank, true
+}
+
+// set inserts key with the given rank, or updates its rank.
+func (h *keyHeap) set(key string, rank [2]int64) {
+	if i, ok := h.indexes[key]; ok {
+		h.entries[i].rank = rank
+		heap.Fix(h, i)
+		return
+	}
+	heap.Push(h, rankedKey{key: key, rank: rank})
+}
+
+// remove removes key from the heap, if present.
+func (h *keyHeap) remove(key string) {
+	if i, ok := h.indexes[key]; ok {
+		heap.Remove(h, i)
+	}
+}
+
+// min returns the key with the lowest rank other than exclude.
+func (h *keyHeap) min(exclude string) (string, bool) {
+	switch {
+	case len(h.entries) == 0:
+		return "", false
+	case h.entries[0].key != exclude:
+		return h.entries[0].key, true
+	case len(h.entries) == 1:
+		return "", false
+	case len(h.entries) == 2 || h.Less(1, 2):
+		// The next lowest rank is one of the root's children
+		return h.entries[1].key, true
+	default:
+		return h.entries[2].key, true
+	}
+}
+
+// rejectPolicy never chooses a key to evict.
+type rejectPolicy struct{}
+
+func (rejectPolicy) touch(string)                 {}
+func (rejectPolicy) track(string, time.Time)      {}
+func (rejectPolicy) remove(string)                {}
+func (rejectPolicy) victim(string) (string, bool) { return "", false }
+
+// memoryBudget bounds the memory used by an InMemoryStore. used is guarded by
+// the store's lock; policy is guarded by mu, so that reads holding the store's
+// read lock can still record accesses.
+type memoryBudget struct {
+	maxBytes int64
+	used     int64
+	policy   evictionPolicy
+	mu       sync.Mutex
+}
+
+// NewBoundedInMemoryStore creates an InMemoryStore that holds at most maxBytes
+// of keys and values, evicting keys according to policy to make room for writes.
+// Writes that cannot fit are rejected with ErrOutOfMemory.
+func NewBoundedInMemoryStore(maxBytes int64, policy EvictionPolicy) (*InMemoryStore, error) {
+	p, err := newEvictionPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	i := NewInMemoryStore()
+	i.budget = &memoryBudget{maxBytes: maxBytes, policy: p, mu: sync.Mutex{}}
+	return i, nil
+}
+
+// MemoryUsage returns the number of bytes of keys and values held by the store,
+// and its budget, which is 0 if the store is unbounded.
+func (i *InMemoryStore) MemoryUsage() (int64, int64) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.budget == nil {
+		var used int64
+		for key := range i.mapStore {
+			used += int64(i.sizeOf(key))
+		}
+		for key := range i.collections {
+			used += int64(i.sizeOf(key))
+		}
+		return used, 0
+	}
+	return i.budget.used, i.budget.maxBytes
+}
+
+// sizeOf returns the number of bytes held by key and its value, or 0 if it
+// doesn't exist. The caller must hold mu.
+func (i *InMemoryStore) sizeOf(key string) int {
+	if value, ok := i.mapStore[key]; ok {
+		return len(key) + len(value)
+	}
+	if c, ok := i.collections[key]; ok {
+		return len(key) + c.size()
+	}
+	return 0
+}
+
+// valueSize returns the number of bytes held by the value of key, collection
+// elements included, and whether key exists.
+func (i *InMemoryStore) valueSize(key string) (int, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.expired(key) || !i.exists(key) {
+		return 0, false
+	}
+	return i.sizeOf(key) - len(key), true
+}
+
+// exists reports whether key holds a value. The caller must hold mu.
+func (i *InMemoryStore) exists(key string) bool {
+	_, isString := i.mapStore[key]
+	_, isCollection := i.collections[key]
+	return isString || isCollection
+}
+
+// expired reports whether key has a time to live that has passed.
+// Expired keys are treated as missing. The caller must hold mu.
+func (i *InMemoryStore) expired(key string) bool {
+	expiry, ok := i.expiries[key]
+	return ok && !time.Now().Before(expiry)
+}
+
+// expire removes key if it has expired, before it is written.
+// The caller must hold mu for writing.
+func (i *InMemoryStore) expire(key string) {
+	if i.expired(key) {
+		i.removeKey(key)
+	}
+}
+
+// removeKey removes key and its value. The caller must hold mu for writing.
+func (i *InMemoryStore) removeKey(key string) {
+	if i.budget != nil && i.exists(key) {
+		i.budget.used -= int64(i.sizeOf(key))
+		i.budget.mu.Lock()
+		i.budget.policy.remove(key)
+		i.budget.mu.Unlock()
+	}
+
+	delete(i.mapStore, key)
+	delete(i.collections, key)
+	delete(i.expiries, key)
+}
+
+// reserve makes room for key to grow from before to size bytes, evicting other
+// keys if needed. Returns ErrOutOfMemory if there isn't enough room, without
+// evicting any key. The caller must hold mu for writing.
+func (i *InMemoryStore) reserve(key string, before int, size int) error {
+	if i.budget == nil {
+		return nil
+	}
+	if int64(size) > i.budget.maxBytes {
+		return ErrOutOfMemory
+	}
+
+	// Choose every victim before evicting any, so that a write failing for lack
+	// of room doesn't drop other keys
+	i.budget.mu.Lock()
+	var victims []string
+	var freed int64
+	for i.budget.used-freed-int64(before)+int64(size) > i.budget.maxBytes {
+		victim, ok := i.budget.policy.victim(key)
+		if !ok {
+			// Only volatile-ttl can run out of victims here, and tracking the
+			// victims again with their expiry restores its order
+			for _, v := range victims {
+				i.budget.policy.track(v, i.expiries[v])
+			}
+			i.budget.mu.Unlock()
+			return ErrOutOfMemory
+		}
+		i.budget.policy.remove(victim)
+		victims = append(victims, victim)
+		freed += int64(i.sizeOf(victim))
+	}
+	i.budget.mu.Unlock()
+
+	for _, victim := range victims {
+		i.removeKey(victim)
+	}
+	return nil
+}
+
+// written records that key changed from before bytes to its current size.
+// The caller must hold mu for writing.
+func (i *InMemoryStore) written(key string, before int) {
+	if i.budget == nil {
+		return
+	}
+
+	i.budget.used += int64(i.sizeOf(key) - before)
+	i.budget.mu.Lock()
+	defer i.budget.mu.Unlock()
+	if i.exists(key) {
+		i.budget.policy.track(key, i.expiries[key])
+	} else {
+		i.budget.policy.remove(key)
+	}
+}
+
+// touched records a read of key. The caller must hold mu.
+func (i *InMemoryStore) touched(key string) {
+	if i.budget == nil {
+		return
+	}
+
+	i.budget.mu.Lock()
+	i.budget.policy.touch(key)
+	i.budget.mu.Unlock()
+}
@@ -0,0 +1,232 @@
+package kv_store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestBoundedStore(t *testing.T, maxBytes int64, policy EvictionPolicy) *InMemoryStore {
+	store, err := NewBoundedInMemoryStore(maxBytes, policy)
+	if err != nil {
+		t.Fatalf("Failed to create bounded store: %v", err)
+	}
+	return store
+}
+
+// readable reports whether key can be read from store
+func readable(store *InMemoryStore, key string) bool {
+	_, err := store.Get(key)
+	return err == nil
+}
+
+func TestNewBoundedInMemoryStore(t *testing.T) {
+	if _, err := NewBoundedInMemoryStore(100, "fifo"); err == nil {
+		t.Fatalf("Expected error for unknown policy")
+	}
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	// Every key takes 2 bytes ("k" + "v"), so the store holds 3 keys
+	t.Run("lru", func(t *testing.T) {
+		store := newTestBoundedStore(t, 6, EvictLRU)
+		store.Put("a", "1")
+		store.Put("b", "2")
+		store.Put("c", "3")
+		store.Get("a")
+		store.Put("d", "4")
+
+		if readable(store, "b") {
+			t.Fatalf("Expected least recently used key b to be evicted")
+		}
+		for _, key := range []string{"a", "c", "d"} {
+			if !readable(store, key) {
+				t.Fatalf("Expected key %s to be kept", key)
+			}
+		}
+	})
+
+	t.Run("lfu", func(t *testing.T) {
+		store := newTestBoundedStore(t, 6, EvictLFU)
+		store.Put("a", "1")
+		store.Put("b", "2")
+		store.Put("c", "3")
+		store.Get("a")
+		store.Get("a")
+		store.Get("b")
+		store.Put("d", "4")
+
+		if readable(store, "c") {
+			t.Fatalf("Expected least frequently used key c to be evicted")
+		}
+		if used, _ := store.MemoryUsage(); used != 6 {
+			t.Fatalf("Expected 6 bytes used, got %d", used)
+		}
+	})
+
+	t.Run("random", func(t *testing.T) {
+		store := newTestBoundedStore(t, 6, EvictRandom)
+		for _, key := range []string{"a", "b", "c", "d", "e"} {
+			if err := store.Put(key, "v"); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+
+		entries, _ := store.Entries()
+		if len(entries) != 3 || !readable(store, "e") {
+			t.Fatalf("Expected 3 keys including the last written, got %v", entries)
+		}
+	})
+
+	t.Run("volatile-ttl", func(t *testing.T) {
+		store := newTestBoundedStore(t, 6, EvictVolatileTTL)
+		store.Put("a", "1")
+		store.PutWithTTL("b", "2", time.Hour)
+		store.PutWithTTL("c", "3", time.Minute)
+		store.Put("d", "4")
+
+		if readable(store, "c") {
+			t.Fatalf("Expected soonest expiring key c to be evicted")
+		}
+
+		// Only b can still be evicted
+		store.Put("e", "5")
+		if readable(store, "b") || !readable(store, "a") {
+			t.Fatalf("Expected b to be evicted and a to be kept")
+		}
+		if err := store.Put("f", "6"); !errors.Is(err, ErrOutOfMemory) {
+			t.Fatalf("Expected ErrOutOfMemory without volatile keys, got %v", err)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		store := newTestBoundedStore(t, 6, EvictReject)
+		store.Put("a", "1")
+		store.Put("b", "2")
+		store.Put("c", "3")
+
+		if err := store.Put("d", "4"); !errors.Is(err, ErrOutOfMemory) {
+			t.Fatalf("Expected ErrOutOfMemory, got %v", err)
+		}
+		if _, err := store.Append("a", "1"); !errors.Is(err, ErrOutOfMemory) {
+			t.Fatalf("Expected ErrOutOfMemory on append, got %v", err)
+		}
+		if _, err := store.RPush("list", "x"); !errors.Is(err, ErrOutOfMemory) {
+			t.Fatalf("Expected ErrOutOfMemory on push, got %v", err)
+		}
+		if store.Type("list") != TypeNone {
+			t.Fatalf("Expected rejected push not to create the list")
+		}
+
+		// Overwriting a key with a value of the same size fits
+		if err := store.Put("a", "9"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		store.Delete("b")
+		if err := store.Put("d", "4"); err != nil {
+			t.Fatalf("Expected no error after delete, got %v", err)
+		}
+	})
+
+	t.Run("value larger than budget", func(t *testing.T) {
+		store := newTestBoundedStore(t, 6, EvictLRU)
+		store.Put("a", "1")
+
+		if err := store.Put("big", "value"); !errors.Is(err, ErrOutOfMemory) {
+			t.Fatalf("Expected ErrOutOfMemory, got %v", err)
+		}
+	})
+
+	t.Run("rejected writes evict no key", func(t *testing.T) {
+		store := newTestBoundedStore(t, 100, EvictLRU)
+		keys := []string{"a", "b", "c", "d", "e"}
+		for _, key := range keys {
+			store.Put(key, "value")
+		}
+
+		if err := store.Put("big", strings.Repeat("v", 200)); !errors.Is(err, ErrOutOfMemory) {
+			t.Fatalf("Expected ErrOutOfMemory, got %v", err)
+		}
+		for _, key := range keys {
+			if !readable(store, key) {
+				t.Fatalf("Expected key %s to survive the rejected write", key)
+			}
+		}
+	})
+
+	t.Run("volatile keys survive a write they can't make room for", func(t *testing.T) {
+		store := newTestBoundedStore(t, 6, EvictVolatileTTL)
+		store.Put("a", "1")
+		store.PutWithTTL("b", "2", time.Hour)
+
+		// Evicting b isn't enough to fit 5 more bytes
+		if err := store.Put("c", "1234"); !errors.Is(err, ErrOutOfMemory) {
+			t.Fatalf("Expected ErrOutOfMemory, got %v", err)
+		}
+		if !readable(store, "b") {
+			t.Fatalf("Expected b to survive the rejected write")
+		}
+
+		// b is still the first to be evicted
+		store.Put("c", "3")
+		store.Put("d", "4")
+		if readable(store, "b") || !readable(store, "a") {
+			t.Fatalf("Expected b to be evicted and a to be kept")
+		}
+	})
+}
+
+func TestMemoryUsageWithCollections(t *testing.T) {
+	store := newTestBoundedStore(t, 100, EvictLRU)
+
+	store.RPush("list", "ab", "cd")
+	store.SAdd("set", "x", "x", "y")
+	store.HSet("hash", "f", "value")
+	store.HSet("hash", "f", "v")
+	store.ZAdd("zset", map[string]float64{"m": 1})
+
+	// list: 4 + 4, set: 3 + 2, hash: 4 + 2, zset: 4 + 1 + 8
+	if used, _ := store.MemoryUsage(); used != 32 {
+		t.Fatalf("Expected 32 bytes used, got %d", used)
+	}
+
+	store.LPop("list")
+	store.SRem("set", "x")
+	store.HDel("hash", "f")
+	store.ZRem("zset", "m")
+	store.Delete("list")
+	store.Delete("set")
+
+	if used, _ := store.MemoryUsage(); used != 0 {
+		t.Fatalf("Expected 0 bytes used, got %d", used)
+	}
+}
+
+func TestPutWithTTL(t *testing.T) {
+	store := NewInMemoryStore()
+
+	store.PutWithTTL("short", "value", time.Millisecond)
+	store.PutWithTTL("long", "value", time.Hour)
+	store.PutWithTTL("cleared", "value", time.Millisecond)
+	store.Put("cleared", "value")
+	time.Sleep(5 * time.Millisecond)
+
+	if readable(store, "short") {
+		t.Fatalf("Expected expired key to be missing")
+	}
+	if !readable(store, "long") || !readable(store, "cleared") {
+		t.Fatalf("Expected unexpired keys to be present")
+	}
+	if entries, _ := store.Entries(); len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %v", entries)
+	}
+
+	// An expired key is written as if it were missing
+	if n, err := store.Increment("short", 1); err != nil || n != 1 {
+		t.Fatalf("Expected 1, got %d (err: %v)", n, err)
+	}
+	if n, err := store.RPush("long2", "a"); err != nil || n != 1 {
+		t.Fatalf("Expected 1, got %d (err: %v)", n, err)
+	}
+}
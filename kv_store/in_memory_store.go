@@ -1,19 +1,28 @@
 package kv_store
 
 import (
-	"fmt"
+	"strconv"
 	"sync"
+	"time"
 )
 
+// InMemoryStore keeps string values in mapStore and collection values in
+// collections. A key is present in at most one of the two maps. Keys with a
+// time to live have an entry in expiries.
 type InMemoryStore struct {
-	mapStore map[string]string
-	mu       sync.RWMutex
+	mapStore    map[string]string
+	collections map[string]collection
+	expiries    map[string]time.Time
+	budget      *memoryBudget
+	mu          sync.RWMutex
 }
 
 func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{
-		mapStore: make(map[string]string),
-		mu:       sync.RWMutex{},
+		mapStore:    make(map[string]string),
+		collections: make(map[string]collection),
+		expiries:    make(map[string]time.Time),
+		mu:          sync.RWMutex{},
 	}
 }
 
@@ -21,8 +30,35 @@ func (i *InMemoryStore) Put(key string, value string) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
+	return i.put(key, value, time.Time{})
+}
+
+// PutWithTTL stores the given value associated with the given key, which
+// expires after ttl.
+func (i *InMemoryStore) PutWithTTL(key string, value string, ttl time.Duration) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.put(key, value, time.Now().Add(ttl))
+}
+
+// put replaces the value of key, which expires at expiry, or never if expiry
+// is zero. The caller must hold mu for writing.
+func (i *InMemoryStore) put(key string, value string, expiry time.Time) error {
+	before := i.sizeOf(key)
+	if err := i.reserve(key, before, len(key)+len(value)); err != nil {
+		return err
+	}
+
+	delete(i.collections, key)
 	i.mapStore[key] = value
+	if expiry.IsZero() {
+		delete(i.expiries, key)
+	} else {
+		i.expiries[key] = expiry
+	}
 
+	i.written(key, before)
 	return nil
 }
 
@@ -30,11 +66,19 @@ func (i *InMemoryStore) Get(key string) (string, error) {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
 
+	if i.expired(key) {
+		return "", ErrKeyNotFound
+	}
+
 	value, ok := i.mapStore[key]
 
 	if !ok {
-		return "", fmt.Errorf("key not found")
+		if _, isCollection := i.collections[key]; isCollection {
+			return "", ErrWrongType
+		}
+		return "", ErrKeyNotFound
 	}
+	i.touched(key)
 	return value, nil
 }
 
@@ -42,19 +86,133 @@ func (i *InMemoryStore) Delete(key string) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	delete(i.mapStore, key)
+	i.removeKey(key)
 
 	return nil
 }
 
+// checkString returns ErrWrongType if key holds a collection. The caller must hold mu.
+func (i *InMemoryStore) checkString(key string) error {
+	if _, ok := i.collections[key]; ok {
+		return ErrWrongType
+	}
+	return nil
+}
+
+// setString replaces the string value of key after checking that it fits in
+// the memory budget. The caller must hold mu for writing.
+func (i *InMemoryStore) setString(key string, value string) error {
+	before := i.sizeOf(key)
+	if err := i.reserve(key, before, len(key)+len(value)); err != nil {
+		return err
+	}
+
+	i.mapStore[key] = value
+	i.written(key, before)
+	return nil
+}
+
 func (i *InMemoryStore) Entries() ([]Entry, error) {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
 
-	entries := make([]Entry, 0, len(i.mapStore))
+	return i.appendEntries(make([]Entry, 0, len(i.mapStore))), nil
+}
+
+// appendEntries appends all string entries to entries. The caller must hold mu.
+func (i *InMemoryStore) appendEntries(entries []Entry) []Entry {
 	for k, v := range i.mapStore {
+		if i.expired(k) {
+			continue
+		}
 		entries = append(entries, Entry{Key: k, Value: v})
 	}
+	return entries
+}
 
-	return entries, nil
+func (i *InMemoryStore) Increment(key string, delta int64) (int64, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire(key)
+	if err := i.checkString(key); err != nil {
+		return 0, err
+	}
+
+	value, ok := i.mapStore[key]
+	n, err := addInt(value, ok, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := i.setString(key, strconv.FormatInt(n, 10)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (i *InMemoryStore) Decrement(key string, delta int64) (int64, error) {
+	return decrement(i, key, delta)
+}
+
+func (i *InMemoryStore) Append(key string, suffix string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire(key)
+	if err := i.checkString(key); err != nil {
+		return 0, err
+	}
+
+	value := i.mapStore[key] + suffix
+	if err := i.setString(key, value); err != nil {
+		return 0, err
+	}
+	return len(value), nil
+}
+
+func (i *InMemoryStore) SetRange(key string, offset int64, data string) (int, error) {
+	if err := checkRange(offset, len(data)); err != nil {
+		return 0, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire(key)
+	if err := i.checkString(key); err != nil {
+		return 0, err
+	}
+
+	value, ok := i.mapStore[key]
+	if !ok && data == "" {
+		return 0, nil
+	}
+
+	value = setRange(value, offset, data)
+	if err := i.setString(key, value); err != nil {
+		return 0, err
+	}
+	return len(value), nil
+}
+
+func (i *InMemoryStore) Update(key string, fn UpdateFunc) (string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire(key)
+	if err := i.checkString(key); err != nil {
+		return "", err
+	}
+
+	value, ok := i.mapStore[key]
+	value, err := fn(value, ok)
+	if err != nil {
+		return "", err
+	}
+
+	if err := i.setString(key, value); err != nil {
+		return "", err
+	}
+	return value, nil
 }
@@ -1,7 +1,10 @@
 package kv_store
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"sync"
 	"testing"
 )
@@ -181,3 +184,254 @@ func TestEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestIncrement(t *testing.T) {
+	t.Run("missing key starts from zero", func(t *testing.T) {
+		store := NewInMemoryStore()
+
+		n, err := store.Increment("counter", 5)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if n != 5 {
+			t.Fatalf("Expected 5, got %d", n)
+		}
+	})
+
+	t.Run("increment and decrement existing value", func(t *testing.T) {
+		store := NewInMemoryStore()
+		store.Put("counter", "10")
+
+		store.Increment("counter", 3)
+		n, err := store.Decrement("counter", 20)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if n != -7 {
+			t.Fatalf("Expected -7, got %d", n)
+		}
+
+		value, _ := store.Get("counter")
+		if value != "-7" {
+			t.Fatalf("Expected stored value '-7', got '%s'", value)
+		}
+	})
+
+	t.Run("non-numeric value", func(t *testing.T) {
+		store := NewInMemoryStore()
+		store.Put("counter", "abc")
+
+		_, err := store.Increment("counter", 1)
+		if !errors.Is(err, ErrNotInteger) {
+			t.Fatalf("Expected ErrNotInteger, got %v", err)
+		}
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		store := NewInMemoryStore()
+		store.Put("counter", strconv.FormatInt(math.MaxInt64, 10))
+
+		_, err := store.Increment("counter", 1)
+		if !errors.Is(err, ErrOverflow) {
+			t.Fatalf("Expected ErrOverflow, got %v", err)
+		}
+		_, err = store.Decrement("counter", math.MinInt64)
+		if !errors.Is(err, ErrOverflow) {
+			t.Fatalf("Expected ErrOverflow, got %v", err)
+		}
+	})
+
+	t.Run("concurrent increments", func(t *testing.T) {
+		store := NewInMemoryStore()
+		const goroutines = 10
+		const operationsPerGoroutine = 100
+
+		var wg sync.WaitGroup
+		wg.Add(goroutines)
+		for i := 0; i < goroutines; i++ {
+			go func() {
+				defer wg.Done()
+				for j := 0; j < operationsPerGoroutine; j++ {
+					store.Increment("counter", 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		value, _ := store.Get("counter")
+		if value != strconv.Itoa(goroutines*operationsPerGoroutine) {
+			t.Fatalf("Expected %d, got %s", goroutines*operationsPerGoroutine, value)
+		}
+	})
+}
+
+func TestAppendAndSetRange(t *testing.T) {
+	t.Run("append to missing and existing keys", func(t *testing.T) {
+		store := NewInMemoryStore()
+
+		store.Append("log", "hello")
+		n, err := store.Append("log", " world")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if n != 11 {
+			t.Fatalf("Expected length 11, got %d", n)
+		}
+
+		value, _ := store.Get("log")
+		if value != "hello world" {
+			t.Fatalf("Expected 'hello world', got '%s'", value)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		initial  string
+		offset   int64
+		data     string
+		expected string
+	}{
+		{"overwrite inside value", "hello world", 6, "there", "hello there"},
+		{"overwrite past end of value", "hello", 3, "p me", "help me"},
+		{"pad with zero bytes", "ab", 4, "cd", "ab\x00\x00cd"},
+		{"empty data", "hello", 10, "", "hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewInMemoryStore()
+			store.Put("key", tt.initial)
+
+			n, err := store.SetRange("key", tt.offset, tt.data)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if n != len(tt.expected) {
+				t.Fatalf("Expected length %d, got %d", len(tt.expected), n)
+			}
+
+			value, _ := store.Get("key")
+			if value != tt.expected {
+				t.Fatalf("Expected %q, got %q", tt.expected, value)
+			}
+		})
+	}
+
+	t.Run("invalid offset", func(t *testing.T) {
+		store := NewInMemoryStore()
+
+		_, err := store.SetRange("key", -1, "data")
+		if !errors.Is(err, ErrInvalidOffset) {
+			t.Fatalf("Expected ErrInvalidOffset, got %v", err)
+		}
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	t.Run("updates existing and missing keys", func(t *testing.T) {
+		store := NewInMemoryStore()
+		store.Put("key", "a")
+
+		value, err := store.Update("key", func(value string, exists bool) (string, error) {
+			if !exists {
+				t.Fatal("Expected key to exist")
+			}
+			return value + "b", nil
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if value != "ab" {
+			t.Fatalf("Expected 'ab', got '%s'", value)
+		}
+
+		store.Update("new", func(value string, exists bool) (string, error) {
+			if exists {
+				t.Fatal("Expected key not to exist")
+			}
+			return "created", nil
+		})
+		if value, _ := store.Get("new"); value != "created" {
+			t.Fatalf("Expected 'created', got '%s'", value)
+		}
+	})
+
+	t.Run("failed update leaves store unchanged", func(t *testing.T) {
+		store := NewInMemoryStore()
+		store.Put("key", "a")
+		updateErr := errors.New("update failed")
+
+		_, err := store.Update("key", func(string, bool) (string, error) {
+			return "b", updateErr
+		})
+		if !errors.Is(err, updateErr) {
+			t.Fatalf("Expected update error, got %v", err)
+		}
+		if value, _ := store.Get("key"); value != "a" {
+			t.Fatalf("Expected 'a', got '%s'", value)
+		}
+	})
+}
+
+// benchmarkParallelWrites measures Put throughput from parallel goroutines
+// writing to distinct keys
+func benchmarkParallelWrites(b *testing.B, store KeyValueStore) {
+	var id sync.Mutex
+	next := 0
+
+	b.RunParallel(func(pb *testing.PB) {
+		id.Lock()
+		prefix := strconv.Itoa(next)
+		next++
+		id.Unlock()
+
+		j := 0
+		for pb.Next() {
+			store.Put(prefix+"-"+strconv.Itoa(j%1024), "value")
+			j++
+		}
+	})
+}
+
+// benchmarkParallelMixed measures throughput of a 90% read, 10% write workload
+// from parallel goroutines
+func benchmarkParallelMixed(b *testing.B, store KeyValueStore) {
+	for j := 0; j < 1024; j++ {
+		store.Put(strconv.Itoa(j), "value")
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		j := 0
+		for pb.Next() {
+			key := strconv.Itoa(j % 1024)
+			if j%10 == 0 {
+				store.Put(key, "value")
+			} else {
+				store.Get(key)
+			}
+			j++
+		}
+	})
+}
+
+func BenchmarkInMemoryStore(b *testing.B) {
+	b.Run("writes", func(b *testing.B) {
+		benchmarkParallelWrites(b, NewInMemoryStore())
+	})
+	b.Run("mixed", func(b *testing.B) {
+		benchmarkParallelMixed(b, NewInMemoryStore())
+	})
+}
+
+func BenchmarkShardedInMemoryStore(b *testing.B) {
+	for _, shards := range []int{4, 16, 64} {
+		b.Run(fmt.Sprintf("writes/%d shards", shards), func(b *testing.B) {
+			store, _ := NewShardedInMemoryStore(shards)
+			benchmarkParallelWrites(b, store)
+		})
+		b.Run(fmt.Sprintf("mixed/%d shards", shards), func(b *testing.B) {
+			store, _ := NewShardedInMemoryStore(shards)
+			benchmarkParallelMixed(b, store)
+		})
+	}
+}
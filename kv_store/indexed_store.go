@@ -0,0 +1,410 @@
+package kv_store
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/bonearadu/kvstore/document"
+)
+
+// IndexStore is a KeyValueStore maintaining secondary indexes on fields of
+// JSON document values. An index maps the scalar value selected by a JSONPath
+// expression in each document to the keys holding it; values that are not JSON
+// documents, or in which the path selects nothing or a non-scalar value, are
+// not indexed.
+//
+// Indexed values are ordered by type, null < false < true < numbers < strings,
+// then numerically or lexicographically.
+type IndexStore interface {
+	KeyValueStore
+
+	// CreateIndex creates or replaces the named index on the JSONPath expression
+	// path, building it from the current contents of the store. Returns true if
+	// the index is new, or document.ErrInvalidPath if the path is malformed.
+	CreateIndex(name string, path string) (bool, error)
+
+	// DropIndex removes the named index.
+	// Returns ErrIndexNotFound if the index doesn't exist.
+	DropIndex(name string) error
+
+	// Indexes returns the path of every index, by name.
+	Indexes() map[string]string
+
+	// Lookup returns the entries whose indexed value equals value, ordered by key.
+	// value is parsed as a JSON scalar, or taken as a string if it isn't one.
+	// Returns ErrIndexNotFound if the index doesn't exist.
+	Lookup(name string, value string) ([]Entry, error)
+
+	// Range returns the entries whose indexed value is between from and to,
+	// inclusive, ordered by value and then key. Bounds are parsed like in Lookup;
+	// an empty bound leaves that side of the range open.
+	// Returns ErrIndexNotFound if the index doesn't exist.
+	Range(name string, from string, to string) ([]Entry, error)
+}
+
+// indexValue is a scalar JSON value in index order.
+type indexValue struct {
+	rank int // 0 = null, 1 = false, 2 = true, 3 = number, 4 = string
+	num  float64
+	str  string
+}
+
+func compareIndexValues(a, b indexValue) int {
+	if c := cmp.Compare(a.rank, b.rank); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.num, b.num); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.str, b.str)
+}
+
+// toIndexValue converts a decoded JSON value to an index value, if it is a scalar.
+func toIndexValue(v any) (indexValue, bool) {
+	switch v := v.(type) {
+	case nil:
+		return indexValue{rank: 0}, true
+	case bool:
+		if v {
+			return indexValue{rank: 2}, true
+		}
+		return indexValue{rank: 1}, true
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return indexValue{}, false
+		}
+		return indexValue{rank: 3, num: f}, true
+	case string:
+		return indexValue{rank: 4, str: v}, true
+	default:
+		return indexValue{}, false
+	}
+}
+
+// parseIndexValue parses a query value as a JSON scalar, falling back to a string.
+func parseIndexValue(s string) indexValue {
+	if v, err := document.Parse(s); err == nil {
+		if iv, ok := toIndexValue(v); ok {
+			return iv
+		}
+	}
+	return indexValue{rank: 4, str: s}
+}
+
+type indexEntry struct {
+	value indexValue
+	key   string
+}
+
+func compareIndexEntries(a, b indexEntry) int {
+	if c := compareIndexValues(a.value, b.value); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.key, b.key)
+}
+
+// index keeps both the indexed value of every key and the entries in index order.
+type index struct {
+	path   document.Path
+	values map[string]indexValue
+	sorted []indexEntry
+}
+
+// set indexes value as the value held by key, replacing its previous value.
+func (x *index) set(key string, value string) {
+	x.remove(key)
+
+	doc, err := document.Parse(value)
+	if err != nil {
+		return
+	}
+	v, err := x.path.Eval(doc)
+	if err != nil {
+		return
+	}
+	iv, ok := toIndexValue(v)
+	if !ok {
+		return
+	}
+
+	e := indexEntry{value: iv, key: key}
+	i, _ := slices.BinarySearchFunc(x.sorted, e, compareIndexEntries)
+	x.sorted = slices.Insert(x.sorted, i, e)
+	x.values[key] = iv
+}
+
+// remove removes key from the index.
+func (x *index) remove(key string) {
+	iv, ok := x.values[key]
+	if !ok {
+		return
+	}
+
+	e := indexEntry{value: iv, key: key}
+	if i, found := slices.BinarySearchFunc(x.sorted, e, compareIndexEntries); found {
+		x.sorted = slices.Delete(x.sorted, i, i+1)
+	}
+	delete(x.values, key)
+}
+
+// IndexedStore wraps a KeyValueStore and maintains secondary indexes on its values.
+// Writes are serialized and indexed while the index lock is held, so queries
+// always observe indexes consistent with the store.
+type IndexedStore struct {
+	backend  KeyValueStore
+	indexes  map[string]*index
+	manifest string // The file the paths of the indexes are saved to, if any
+	mu       sync.RWMutex
+}
+
+// NewIndexedStore creates an IndexedStore without any indexes on backend.
+func NewIndexedStore(backend KeyValueStore) *IndexedStore {
+	return &IndexedStore{
+		backend: backend,
+		indexes: make(map[string]*index),
+		mu:      sync.RWMutex{},
+	}
+}
+
+// reindex updates every index with the new value of key. The caller must hold mu for writing.
+func (i *IndexedStore) reindex(key string, value string) {
+	for _, x := range i.indexes {
+		x.set(key, value)
+	}
+}
+
+// reindexFromBackend updates every index with the value of key read from the
+// backend. The caller must hold mu for writing.
+func (i *IndexedStore) reindexFromBackend(key string) {
+	if len(i.indexes) == 0 {
+		return
+	}
+	if value, err := i.backend.Get(key); err == nil {
+		i.reindex(key, value)
+	}
+}
+
+func (i *IndexedStore) Put(key string, value string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := i.backend.Put(key, value); err != nil {
+		return err
+	}
+	i.reindex(key, value)
+	return nil
+}
+
+func (i *IndexedStore) Get(key string) (string, error) {
+	return i.backend.Get(key)
+}
+
+func (i *IndexedStore) Delete(key string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := i.backend.Delete(key); err != nil {
+		return err
+	}
+	for _, x := range i.indexes {
+		x.remove(key)
+	}
+	return nil
+}
+
+func (i *IndexedStore) Entries() ([]Entry, error) {
+	return i.backend.Entries()
+}
+
+func (i *IndexedStore) Increment(key string, delta int64) (int64, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	n, err := i.backend.Increment(key, delta)
+	if err != nil {
+		return 0, err
+	}
+	i.reindex(key, strconv.FormatInt(n, 10))
+	return n, nil
+}
+
+func (i *IndexedStore) Decrement(key string, delta int64) (int64, error) {
+	return decrement(i, key, delta)
+}
+
+func (i *IndexedStore) Append(key string, suffix string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	n, err := i.backend.Append(key, suffix)
+	if err != nil {
+		return 0, err
+	}
+	i.reindexFromBackend(key)
+	return n, nil
+}
+
+func (i *IndexedStore) SetRange(key string, offset int64, data string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	n, err := i.backend.SetRange(key, offset, data)
+	if err != nil {
+		return 0, err
+	}
+	i.reindexFromBackend(key)
+	return n, nil
+}
+
+func (i *IndexedStore) Update(key string, fn UpdateFunc) (string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	value, err := i.backend.Update(key, fn)
+	if err != nil {
+		return "", err
+	}
+	i.reindex(key, value)
+	return value, nil
+}
+
+func (i *IndexedStore) CreateIndex(name string, path string) (bool, error) {
+	p, err := document.ParsePath(path)
+	if err != nil {
+		return false, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entries, err := i.backend.Entries()
+	if err != nil {
+		return false, err
+	}
+
+	x := &index{path: p, values: make(map[string]indexValue, len(entries))}
+	for _, e := range entries {
+		x.set(e.Key, e.Value)
+	}
+
+	old, exists := i.indexes[name]
+	i.indexes[name] = x
+	if err := i.saveIndexes(); err != nil {
+		if exists {
+			i.indexes[name] = old
+		} else {
+			delete(i.indexes, name)
+		}
+		return false, err
+	}
+	return !exists, nil
+}
+
+func (i *IndexedStore) DropIndex(name string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	x, ok := i.indexes[name]
+	if !ok {
+		return ErrIndexNotFound
+	}
+	delete(i.indexes, name)
+	if err := i.saveIndexes(); err != nil {
+		i.indexes[name] = x
+		return err
+	}
+	return nil
+}
+
+func (i *IndexedStore) Indexes() map[string]string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	paths := make(map[string]string, len(i.indexes))
+	for name, x := range i.indexes {
+		paths[name] = x.path.String()
+	}
+	return paths
+}
+
+func (i *IndexedStore) Lookup(name string, value string) ([]Entry, error) {
+	iv := parseIndexValue(value)
+	return i.scan(name, &iv, &iv)
+}
+
+func (i *IndexedStore) Range(name string, from string, to string) ([]Entry, error) {
+	var lo, hi *indexValue
+	if from != "" {
+		v := parseIndexValue(from)
+		lo = &v
+	}
+	if to != "" {
+		v := parseIndexValue(to)
+		hi = &v
+	}
+	return i.scan(name, lo, hi)
+}
+
+// scan returns the entries of the named index between the inclusive bounds
+// lo and hi, where a nil bound is open.
+func (i *IndexedStore) scan(name string, lo, hi *indexValue) ([]Entry, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	x, ok := i.indexes[name]
+	if !ok {
+		return nil, ErrIndexNotFound
+	}
+
+	start, end := 0, len(x.sorted)
+	if lo != nil {
+		start = sort.Search(len(x.sorted), func(j int) bool {
+			return compareIndexValues(x.sorted[j].value, *lo) >= 0
+		})
+	}
+	if hi != nil {
+		end = sort.Search(len(x.sorted), func(j int) bool {
+			return compareIndexValues(x.sorted[j].value, *hi) > 0
+		})
+	}
+
+	entries := make([]Entry, 0, max(end-start, 0))
+	for _, e := range x.sorted[start:max(start, end)] {
+		// The backend may drop keys on its own, e.g. by evicting or expiring them
+		value, err := i.backend.Get(e.key)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{Key: e.key, Value: value})
+	}
+	return entries, nil
+}
+
+// Unwrap returns the backend.
+func (i *IndexedStore) Unwrap() KeyValueStore {
+	return i.backend
+}
+
+// Drop removes the saved paths of the indexes, and drops the backend if it
+// holds data outside of memory.
+func (i *IndexedStore) Drop() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := i.removeIndexes(); err != nil {
+		return err
+	}
+	if d, ok := i.backend.(Dropper); ok {
+		return d.Drop()
+	}
+	return nil
+}
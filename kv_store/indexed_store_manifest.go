@@ -0,0 +1,68 @@
+package kv_store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// PersistIndexes re-creates the indexes saved in the manifest at path by a
+// previous run, and makes i save the path of every index there whenever one is
+// created or dropped, so that indexes created at runtime survive a restart.
+// It must be called before i is used.
+func (i *IndexedStore) PersistIndexes(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err == nil {
+		var paths map[string]string
+		if err := json.Unmarshal(data, &paths); err != nil {
+			return fmt.Errorf("error reading indexes from %s: %w", path, err)
+		}
+		for name, p := range paths {
+			if _, err := i.CreateIndex(name, p); err != nil {
+				return fmt.Errorf("index %s: %w", name, err)
+			}
+		}
+	}
+
+	i.manifest = path
+	return nil
+}
+
+// saveIndexes writes the path of every index to the manifest, if i persists
+// its indexes. The caller must hold mu.
+func (i *IndexedStore) saveIndexes() error {
+	if i.manifest == "" {
+		return nil
+	}
+
+	paths := make(map[string]string, len(i.indexes))
+	for name, x := range i.indexes {
+		paths[name] = x.path.String()
+	}
+	data, err := json.Marshal(paths)
+	if err != nil {
+		return err
+	}
+
+	tmp := i.manifest + ".tmp"
+	if err := os.WriteFile(tmp, data, fileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, i.manifest)
+}
+
+// removeIndexes removes the manifest, if i persists its indexes.
+func (i *IndexedStore) removeIndexes() error {
+	if i.manifest == "" {
+		return nil
+	}
+	if err := os.Remove(i.manifest); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package kv_store
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/bonearadu/kvstore/document"
+)
+
+// entryKeys returns the keys of entries, in order
+func entryKeys(entries []Entry) []string {
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.Key
+	}
+	return keys
+}
+
+func TestIndexedStore(t *testing.T) {
+	newStore := func(t *testing.T) *IndexedStore {
+		store := NewIndexedStore(NewInMemoryStore())
+		store.Put("ada", `{"user":{"email":"ada@example.com","age":36}}`)
+		store.Put("alan", `{"user":{"email":"alan@example.com","age":41}}`)
+		store.Put("grace", `{"user":{"email":"grace@example.com","age":36}}`)
+		store.Put("text", "not a document")
+		if _, err := store.CreateIndex("age", "$.user.age"); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+		return store
+	}
+
+	t.Run("lookup", func(t *testing.T) {
+		store := newStore(t)
+
+		entries, err := store.Lookup("age", "36")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if keys := entryKeys(entries); !slices.Equal(keys, []string{"ada", "grace"}) {
+			t.Fatalf("Expected [ada grace], got %v", keys)
+		}
+		if entries[0].Value != `{"user":{"email":"ada@example.com","age":36}}` {
+			t.Fatalf("Expected the stored value, got %s", entries[0].Value)
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		store := newStore(t)
+
+		tests := []struct {
+			from, to string
+			expected []string
+		}{
+			{"36", "40", []string{"ada", "grace"}},
+			{"37", "", []string{"alan"}},
+			{"", "", []string{"ada", "grace", "alan"}},
+			{"50", "", []string{}},
+			{"41", "36", []string{}},
+		}
+		for _, tt := range tests {
+			entries, err := store.Range("age", tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if keys := entryKeys(entries); !slices.Equal(keys, tt.expected) {
+				t.Fatalf("Expected %v for [%s, %s], got %v", tt.expected, tt.from, tt.to, keys)
+			}
+		}
+	})
+
+	t.Run("maintained on writes", func(t *testing.T) {
+		store := newStore(t)
+
+		store.Put("ada", `{"user":{"age":37}}`)
+		store.Delete("grace")
+		store.Update("text", func(string, bool) (string, error) {
+			return `{"user":{"age":36}}`, nil
+		})
+
+		entries, _ := store.Lookup("age", "36")
+		if keys := entryKeys(entries); !slices.Equal(keys, []string{"text"}) {
+			t.Fatalf("Expected [text], got %v", keys)
+		}
+
+		// Breaking the document removes it from the index
+		store.Append("text", "}")
+		entries, _ = store.Lookup("age", "36")
+		if len(entries) != 0 {
+			t.Fatalf("Expected no entries, got %v", entryKeys(entries))
+		}
+	})
+
+	t.Run("string values", func(t *testing.T) {
+		store := newStore(t)
+		store.CreateIndex("email", "$.user.email")
+
+		entries, _ := store.Lookup("email", "alan@example.com")
+		if keys := entryKeys(entries); !slices.Equal(keys, []string{"alan"}) {
+			t.Fatalf("Expected [alan], got %v", keys)
+		}
+
+		// Strings sort after numbers, so a numeric lookup doesn't match them
+		entries, _ = store.Lookup("email", "36")
+		if len(entries) != 0 {
+			t.Fatalf("Expected no entries, got %v", entryKeys(entries))
+		}
+	})
+
+	t.Run("index management", func(t *testing.T) {
+		store := newStore(t)
+
+		if _, err := store.CreateIndex("bad", "user.age"); !errors.Is(err, document.ErrInvalidPath) {
+			t.Fatalf("Expected ErrInvalidPath, got %v", err)
+		}
+		if created, _ := store.CreateIndex("age", "$.user.email"); created {
+			t.Fatalf("Expected existing index to be replaced")
+		}
+		if paths := store.Indexes(); paths["age"] != "$.user.email" {
+			t.Fatalf("Expected replaced path, got %v", paths)
+		}
+		if err := store.DropIndex("age"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := store.Lookup("age", "36"); !errors.Is(err, ErrIndexNotFound) {
+			t.Fatalf("Expected ErrIndexNotFound, got %v", err)
+		}
+	})
+
+	t.Run("keys dropped by the backend are skipped", func(t *testing.T) {
+		store := newStore(t)
+
+		// Bypass the index, like an eviction or an expiry would
+		store.backend.Delete("ada")
+		entries, err := store.Lookup("age", "36")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if keys := entryKeys(entries); !slices.Equal(keys, []string{"grace"}) {
+			t.Fatalf("Expected [grace], got %v", keys)
+		}
+	})
+}
+
+func TestIndexedStoreRebuild(t *testing.T) {
+	storeRoot, err := os.MkdirTemp("", "indexed_store_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(storeRoot)
+
+	NewPersistentStore(storeRoot).Put("key", `{"color":"red"}`)
+
+	// Reopening the store rebuilds its indexes from the persisted values
+	store := NewIndexedStore(NewPersistentStore(storeRoot))
+	store.CreateIndex("color", "$.color")
+
+	entries, err := store.Lookup("color", "red")
+	if err != nil || len(entries) != 1 || entries[0].Key != "key" {
+		t.Fatalf("Expected entry for key, got %v (err: %v)", entries, err)
+	}
+}
+
+func TestIndexedStorePersistIndexes(t *testing.T) {
+	root := t.TempDir()
+	manifest := root + ".indexes"
+	defer os.Remove(manifest)
+
+	store := NewIndexedStore(NewPersistentStore(root))
+	if err := store.PersistIndexes(manifest); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.Put("key", `{"color":"red","size":3}`)
+	store.CreateIndex("color", "$.color")
+	store.CreateIndex("size", "$.size")
+	store.DropIndex("size")
+
+	// Reopening the store re-creates the indexes left by the previous run
+	reopened := NewIndexedStore(NewPersistentStore(root))
+	if err := reopened.PersistIndexes(manifest); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if paths := reopened.Indexes(); len(paths) != 1 || paths["color"] != "$.color" {
+		t.Fatalf("Expected the color index only, got %v", paths)
+	}
+	entries, err := reopened.Lookup("color", "red")
+	if err != nil || len(entries) != 1 || entries[0].Key != "key" {
+		t.Fatalf("Expected entry for key, got %v (err: %v)", entries, err)
+	}
+
+	if err := reopened.Drop(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := os.Stat(manifest); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected the manifest to be removed, got %v", err)
+	}
+}
+
+func TestAs(t *testing.T) {
+	indexed := NewIndexedStore(NewInMemoryStore())
+	store, err := NewMVCCStore(indexed, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to create MVCC store: %v", err)
+	}
+
+	is, ok := As[IndexStore](store)
+	if !ok || is != indexed {
+		t.Fatalf("Expected to find the wrapped IndexStore")
+	}
+	if _, ok := As[HistoryStore](NewInMemoryStore()); ok {
+		t.Fatalf("Expected no HistoryStore in an in-memory store")
+	}
+}
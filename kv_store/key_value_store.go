@@ -1,5 +1,7 @@
 package kv_store
 
+import "time"
+
 type KeyValueStore interface {
 	// Put stores the given value associated with the given key.
 	// If the key already exists, its value is updated.
@@ -20,8 +22,39 @@ type KeyValueStore interface {
 	// Returns a slice of Entry structs and nil error on success.
 	// Returns an empty slice and an error if the operation fails.
 	Entries() ([]Entry, error)
+
+	// Increment atomically adds delta to the integer value associated with the given key
+	// and returns the new value. A missing key is treated as holding 0.
+	// Returns ErrNotInteger if the value is not an integer, or ErrOverflow if the result
+	// does not fit in an int64.
+	Increment(key string, delta int64) (int64, error)
+
+	// Decrement atomically subtracts delta from the integer value associated with the
+	// given key and returns the new value. It behaves like Increment otherwise.
+	Decrement(key string, delta int64) (int64, error)
+
+	// Append atomically appends suffix to the value associated with the given key
+	// and returns the new length of the value. A missing key is treated as empty.
+	// Returns an error if the operation fails.
+	Append(key string, suffix string) (int, error)
+
+	// SetRange atomically overwrites the value associated with the given key with data,
+	// starting at byte offset, and returns the new length of the value. The value is
+	// padded with zero bytes if offset is past its end; a missing key is treated as empty.
+	// Returns ErrInvalidOffset if the range is out of bounds, or an error if the operation fails.
+	SetRange(key string, offset int64, data string) (int, error)
+
+	// Update atomically replaces the value associated with the given key with the result
+	// of fn applied to its current value, and returns the new value. exists is false if
+	// the key doesn't exist. If fn returns an error, the store is left unchanged and the
+	// error is returned.
+	Update(key string, fn UpdateFunc) (string, error)
 }
 
+// UpdateFunc computes the new value of a key from its current value.
+// exists reports whether the key currently exists.
+type UpdateFunc func(value string, exists bool) (string, error)
+
 // Entry represents a key-value pair in the store.
 type Entry struct {
 	// Key is the identifier for the value.
@@ -29,3 +62,42 @@ type Entry struct {
 	// Value is the data associated with the key.
 	Value string
 }
+
+// TTLStore is a KeyValueStore whose keys can expire.
+type TTLStore interface {
+	KeyValueStore
+
+	// PutWithTTL stores the given value associated with the given key, which expires
+	// after ttl. Expired keys are treated as missing. Put clears the time to live of a key.
+	PutWithTTL(key string, value string, ttl time.Duration) error
+}
+
+// StatsReporter is implemented by stores that report statistics about their internals.
+type StatsReporter interface {
+	// Stats returns the statistics of the store, by name.
+	Stats() map[string]any
+}
+
+// Wrapper is implemented by stores that wrap another store to extend its behaviour.
+type Wrapper interface {
+	// Unwrap returns the wrapped store.
+	Unwrap() KeyValueStore
+}
+
+// As returns the first store implementing T in the chain of stores wrapped by
+// store, starting with store itself. Writes made through the returned store
+// bypass the wrappers above it, so it should only be used for features those
+// wrappers don't need to observe.
+func As[T any](store KeyValueStore) (T, bool) {
+	for {
+		if t, ok := store.(T); ok {
+			return t, true
+		}
+		w, ok := store.(Wrapper)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		store = w.Unwrap()
+	}
+}
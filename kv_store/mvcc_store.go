@@ -0,0 +1,538 @@
+package kv_store
+
+import (
+	"fmt"
+	"hash/maphash"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// VersionedStore is a KeyValueStore that keeps older versions of its data and
+// can serve reads as of a past revision.
+type VersionedStore interface {
+	KeyValueStore
+
+	// Revision returns the revision of the latest write applied to the store.
+	Revision() int64
+
+	// GetAt retrieves the value associated with the given key as of revision rev.
+	// Returns ErrCompacted or ErrFutureRevision if rev is outside the readable window.
+	GetAt(key string, rev int64) (string, error)
+
+	// EntriesAt returns all key-value pairs in the store as of revision rev.
+	// Returns ErrCompacted or ErrFutureRevision if rev is outside the readable window.
+	EntriesAt(rev int64) ([]Entry, error)
+}
+
+// HistoryStore is a KeyValueStore that keeps the past versions of each key and
+// can restore them.
+type HistoryStore interface {
+	KeyValueStore
+
+	// History returns the retained versions of key, newest first.
+	// Returns ErrKeyNotFound if the key has no retained versions.
+	History(key string) ([]Version, error)
+
+	// Revert atomically restores key to the value it was given at revision rev.
+	// Returns ErrVersionNotFound if no retained version of key was written at rev.
+	Revert(key string, rev int64) error
+}
+
+// sweepInterval is the number of revisions between full sweeps of the version
+// index. Keys are also trimmed individually whenever they are written.
+const sweepInterval = 1024
+
+// deletedHistoryRevisions is the number of revisions the history of a deleted
+// key is kept for once its deletion falls behind the retention horizon, so
+// that it can still be reverted while deleted keys don't pile up in memory.
+const deletedHistoryRevisions = 1024
+
+// mvccLockStripes is the number of locks the writes of an MVCCStore are spread
+// over by key.
+const mvccLockStripes = 256
+
+type version struct {
+	rev       int64
+	value     string
+	deleted   bool
+	timestamp time.Time
+}
+
+// Version describes a past value of a key.
+type Version struct {
+	// Revision is the store revision at which the value was written.
+	Revision int64 `json:"version"`
+	// Value is the value written at that revision.
+	Value string `json:"value"`
+	// Deleted reports whether the key was deleted at that revision.
+	Deleted bool `json:"deleted"`
+	// Timestamp is the time at which the revision was created.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// MVCCStore wraps a KeyValueStore with multi-version concurrency control.
+// Every write creates a new revision of the store, and the versions of each key
+// are kept in memory so that reads can be served as of any revision newer than
+// the retention horizon. Independently of the horizon, the last few versions
+// of every key are kept as its history. The backend only ever holds the
+// latest values.
+//
+// Every retained version holds a full copy of its value, so memory grows with
+// the number of keys, the retention and the history length.
+//
+// A write applies its value to the backend holding only the lock of its key's
+// stripe, which serializes the writes of the same key, then takes mu to commit
+// the new revision. Reads are served from memory, so a write becomes visible
+// once its revision is committed.
+type MVCCStore struct {
+	backend   KeyValueStore
+	versions  map[string][]version
+	rev       int64
+	compacted int64
+	lastSweep int64
+	retention int64
+	history   int
+	pins      map[int64]int
+	keyLocks  [mvccLockStripes]sync.Mutex
+	seed      maphash.Seed
+	mu        sync.RWMutex
+}
+
+// NewMVCCStore creates an MVCCStore on top of the given backend, keeping at
+// least the last retention revisions readable and the last history versions
+// of every key. The current contents of the backend are loaded as the first
+// revision.
+func NewMVCCStore(backend KeyValueStore, retention int64, history int) (*MVCCStore, error) {
+	m := &MVCCStore{
+		backend:   backend,
+		versions:  make(map[string][]version),
+		retention: retention,
+		history:   history,
+		pins:      make(map[int64]int),
+		seed:      maphash.MakeSeed(),
+		mu:        sync.RWMutex{},
+	}
+
+	entries, err := backend.Entries()
+	if err != nil {
+		return nil, fmt.Errorf("error loading entries from backend: %w", err)
+	}
+	if len(entries) > 0 {
+		m.rev = 1
+		now := time.Now()
+		for _, e := range entries {
+			m.versions[e.Key] = []version{{rev: m.rev, value: e.Value, timestamp: now}}
+		}
+	}
+	m.compacted = m.rev
+	m.lastSweep = m.rev
+
+	return m, nil
+}
+
+func (m *MVCCStore) Put(key string, value string) error {
+	unlock := m.lock(key)
+	defer unlock()
+
+	if err := m.backend.Put(key, value); err != nil {
+		return err
+	}
+
+	m.commit(key, version{value: value})
+	return nil
+}
+
+func (m *MVCCStore) Get(key string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.lookup(key, m.rev)
+}
+
+func (m *MVCCStore) Delete(key string) error {
+	unlock := m.lock(key)
+	defer unlock()
+
+	if err := m.backend.Delete(key); err != nil {
+		return err
+	}
+
+	m.commitDelete(key)
+	return nil
+}
+
+func (m *MVCCStore) Increment(key string, delta int64) (int64, error) {
+	unlock := m.lock(key)
+	defer unlock()
+
+	value, err := m.latest(key)
+	n, err := addInt(value, err == nil, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	value = strconv.FormatInt(n, 10)
+	if err := m.backend.Put(key, value); err != nil {
+		return 0, err
+	}
+	m.commit(key, version{value: value})
+	return n, nil
+}
+
+func (m *MVCCStore) Decrement(key string, delta int64) (int64, error) {
+	return decrement(m, key, delta)
+}
+
+func (m *MVCCStore) Append(key string, suffix string) (int, error) {
+	unlock := m.lock(key)
+	defer unlock()
+
+	value, _ := m.latest(key)
+	if _, err := m.backend.Append(key, suffix); err != nil {
+		return 0, err
+	}
+
+	value += suffix
+	m.commit(key, version{value: value})
+	return len(value), nil
+}
+
+func (m *MVCCStore) SetRange(key string, offset int64, data string) (int, error) {
+	if err := checkRange(offset, len(data)); err != nil {
+		return 0, err
+	}
+
+	unlock := m.lock(key)
+	defer unlock()
+
+	value, _ := m.latest(key)
+	if data == "" {
+		return len(value), nil
+	}
+	if _, err := m.backend.SetRange(key, offset, data); err != nil {
+		return 0, err
+	}
+
+	value = setRange(value, offset, data)
+	m.commit(key, version{value: value})
+	return len(value), nil
+}
+
+func (m *MVCCStore) Update(key string, fn UpdateFunc) (string, error) {
+	unlock := m.lock(key)
+	defer unlock()
+
+	value, err := m.latest(key)
+	value, err = fn(value, err == nil)
+	if err != nil {
+		return "", err
+	}
+
+	if err := m.backend.Put(key, value); err != nil {
+		return "", err
+	}
+	m.commit(key, version{value: value})
+	return value, nil
+}
+
+// Entries returns a consistent view of all key-value pairs as of the latest revision.
+func (m *MVCCStore) Entries() ([]Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.entriesAt(m.rev), nil
+}
+
+func (m *MVCCStore) Revision() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.rev
+}
+
+func (m *MVCCStore) GetAt(key string, rev int64) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := m.checkRevision(rev); err != nil {
+		return "", err
+	}
+	return m.lookup(key, rev)
+}
+
+func (m *MVCCStore) EntriesAt(rev int64) ([]Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := m.checkRevision(rev); err != nil {
+		return []Entry{}, err
+	}
+	return m.entriesAt(rev), nil
+}
+
+// History returns the retained versions of key, newest first.
+// Returns ErrKeyNotFound if the key has no retained versions.
+func (m *MVCCStore) History(key string) ([]Version, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	vs := m.versions[key]
+	if len(vs) == 0 {
+		return []Version{}, ErrKeyNotFound
+	}
+
+	history := make([]Version, 0, len(vs))
+	for i := len(vs) - 1; i >= 0; i-- {
+		history = append(history, Version{
+			Revision:  vs[i].rev,
+			Value:     vs[i].value,
+			Deleted:   vs[i].deleted,
+			Timestamp: vs[i].timestamp,
+		})
+	}
+	return history, nil
+}
+
+// Revert atomically restores key to the value it was given at revision rev,
+// creating a new revision. Reverting to a deletion deletes the key.
+// Returns ErrVersionNotFound if no retained version of key was written at rev.
+func (m *MVCCStore) Revert(key string, rev int64) error {
+	unlock := m.lock(key)
+	defer unlock()
+
+	target, ok := m.versionAt(key, rev)
+	if !ok {
+		return ErrVersionNotFound
+	}
+
+	if target.deleted {
+		if err := m.backend.Delete(key); err != nil {
+			return err
+		}
+		m.commitDelete(key)
+		return nil
+	}
+
+	if err := m.backend.Put(key, target.value); err != nil {
+		return err
+	}
+	m.commit(key, version{value: target.value})
+	return nil
+}
+
+// versionAt returns the retained version of key written at revision rev, and
+// whether there is one.
+func (m *MVCCStore) versionAt(key string, rev int64) (version, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	vs := m.versions[key]
+	i := sort.Search(len(vs), func(i int) bool { return vs[i].rev >= rev })
+	if i == len(vs) || vs[i].rev != rev {
+		return version{}, false
+	}
+	return vs[i], true
+}
+
+// Unwrap returns the backend.
+func (m *MVCCStore) Unwrap() KeyValueStore {
+	return m.backend
+}
+
+// Drop drops the backend, if it holds data outside of memory.
+func (m *MVCCStore) Drop() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if d, ok := m.backend.(Dropper); ok {
+		return d.Drop()
+	}
+	return nil
+}
+
+// Snapshot opens a read-only view of the store as of the latest revision.
+func (m *MVCCStore) Snapshot() *Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pin(m.rev)
+}
+
+// SnapshotAt opens a read-only view of the store as of revision rev.
+func (m *MVCCStore) SnapshotAt(rev int64) (*Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkRevision(rev); err != nil {
+		return nil, err
+	}
+	return m.pin(rev), nil
+}
+
+func (m *MVCCStore) pin(rev int64) *Snapshot {
+	m.pins[rev]++
+	return &Snapshot{store: m, rev: rev}
+}
+
+func (m *MVCCStore) unpin(rev int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pins[rev]--
+	if m.pins[rev] == 0 {
+		delete(m.pins, rev)
+	}
+}
+
+// lock locks the stripe of key and returns the function unlocking it.
+func (m *MVCCStore) lock(key string) func() {
+	mu := &m.keyLocks[maphash.String(m.seed, key)%mvccLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// latest returns the latest value of key. The caller must hold the lock of key,
+// so that the value doesn't change until its write is committed.
+func (m *MVCCStore) latest(key string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.lookup(key, m.rev)
+}
+
+// commit records v as the latest version of key in a new revision, once it
+// has been written to the backend. The caller must hold the lock of key.
+func (m *MVCCStore) commit(key string, v version) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.appendVersion(key, v)
+}
+
+// commitDelete records the deletion of key in a new revision if it exists, once
+// it has been deleted from the backend. The caller must hold the lock of key.
+func (m *MVCCStore) commitDelete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.lookup(key, m.rev); err == nil {
+		m.appendVersion(key, version{deleted: true})
+	}
+}
+
+func (m *MVCCStore) checkRevision(rev int64) error {
+	if rev > m.rev {
+		return ErrFutureRevision
+	}
+	if rev < m.compacted {
+		return ErrCompacted
+	}
+	return nil
+}
+
+// lookup returns the value of key visible at revision rev. The caller must hold mu.
+func (m *MVCCStore) lookup(key string, rev int64) (string, error) {
+	vs := m.versions[key]
+	i := sort.Search(len(vs), func(i int) bool { return vs[i].rev > rev }) - 1
+	if i < 0 || vs[i].deleted {
+		return "", ErrKeyNotFound
+	}
+	return vs[i].value, nil
+}
+
+// entriesAt returns the key-value pairs visible at revision rev. The caller must hold mu.
+func (m *MVCCStore) entriesAt(rev int64) []Entry {
+	entries := make([]Entry, 0, len(m.versions))
+	for key := range m.versions {
+		if val, err := m.lookup(key, rev); err == nil {
+			entries = append(entries, Entry{Key: key, Value: val})
+		}
+	}
+	return entries
+}
+
+// appendVersion records a new revision for key and garbage-collects versions
+// that fell behind the retention horizon. The caller must hold mu for writing.
+func (m *MVCCStore) appendVersion(key string, v version) {
+	m.rev++
+	v.rev = m.rev
+	v.timestamp = time.Now()
+	m.versions[key] = append(m.versions[key], v)
+
+	horizon := m.horizon()
+	if horizon <= m.compacted {
+		return
+	}
+	m.compacted = horizon
+	m.trim(key, horizon)
+
+	if m.rev-m.lastSweep >= sweepInterval {
+		for k := range m.versions {
+			m.trim(k, horizon)
+		}
+		m.lastSweep = m.rev
+	}
+}
+
+// horizon returns the oldest revision that must stay readable, taking open
+// snapshots into account. The caller must hold mu.
+func (m *MVCCStore) horizon() int64 {
+	horizon := m.rev - m.retention
+	for rev := range m.pins {
+		horizon = min(horizon, rev)
+	}
+	return horizon
+}
+
+// trim drops the versions of key that are neither visible at or after horizon
+// nor part of the key's history, and drops deleted keys once their deletion is
+// behind the horizon, along with their history deletedHistoryRevisions later.
+// The caller must hold mu for writing.
+func (m *MVCCStore) trim(key string, horizon int64) {
+	vs := m.versions[key]
+	i := sort.Search(len(vs), func(i int) bool { return vs[i].rev > horizon }) - 1
+	i = min(i, len(vs)-m.history)
+	if i > 0 {
+		n := copy(vs, vs[i:])
+		clear(vs[n:])
+		vs = vs[:n]
+		m.versions[key] = vs
+	}
+
+	expiry := horizon
+	if m.history > 0 {
+		expiry -= deletedHistoryRevisions
+	}
+	if len(vs) > 0 && vs[len(vs)-1].deleted && vs[len(vs)-1].rev <= expiry {
+		delete(m.versions, key)
+	}
+}
+
+// Snapshot is a read-only view of an MVCCStore as of a fixed revision.
+// Versions visible to an open snapshot are never garbage-collected, so the
+// snapshot stays stable while writers continue. Close releases it.
+type Snapshot struct {
+	store *MVCCStore
+	rev   int64
+	once  sync.Once
+}
+
+// Revision returns the revision the snapshot was taken at.
+func (s *Snapshot) Revision() int64 {
+	return s.rev
+}
+
+func (s *Snapshot) Get(key string) (string, error) {
+	return s.store.GetAt(key, s.rev)
+}
+
+func (s *Snapshot) Entries() ([]Entry, error) {
+	return s.store.EntriesAt(s.rev)
+}
+
+// Close releases the snapshot, allowing its versions to be garbage-collected.
+func (s *Snapshot) Close() {
+	s.once.Do(func() { s.store.unpin(s.rev) })
+}
@@ -0,0 +1,569 @@
+package kv_store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func newTestMVCCStore(t *testing.T, retention int64) *MVCCStore {
+	store, err := NewMVCCStore(NewInMemoryStore(), retention, 0)
+	if err != nil {
+		t.Fatalf("Failed to create MVCC store: %v", err)
+	}
+	return store
+}
+
+func TestNewMVCCStore(t *testing.T) {
+	t.Run("empty backend", func(t *testing.T) {
+		store := newTestMVCCStore(t, 10)
+
+		if store.Revision() != 0 {
+			t.Fatalf("Expected revision 0, got %d", store.Revision())
+		}
+	})
+
+	t.Run("loads existing backend contents", func(t *testing.T) {
+		storeRoot, err := os.MkdirTemp("", "mvcc_store_test")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(storeRoot)
+
+		backend := NewPersistentStore(storeRoot)
+		backend.Put("key1", "value1")
+		backend.Put("key2", "value2")
+
+		store, err := NewMVCCStore(backend, 10, 0)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if store.Revision() != 1 {
+			t.Fatalf("Expected revision 1, got %d", store.Revision())
+		}
+
+		value, err := store.Get("key2")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if value != "value2" {
+			t.Fatalf("Expected value 'value2', got '%v'", value)
+		}
+	})
+}
+
+func TestMVCCStoreWrites(t *testing.T) {
+	t.Run("each write creates a revision", func(t *testing.T) {
+		store := newTestMVCCStore(t, 10)
+
+		store.Put("key1", "value1")
+		store.Put("key1", "value2")
+		store.Delete("key1")
+
+		if store.Revision() != 3 {
+			t.Fatalf("Expected revision 3, got %d", store.Revision())
+		}
+	})
+
+	t.Run("deleting a missing key does not create a revision", func(t *testing.T) {
+		store := newTestMVCCStore(t, 10)
+
+		err := store.Delete("nonexistent")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if store.Revision() != 0 {
+			t.Fatalf("Expected revision 0, got %d", store.Revision())
+		}
+	})
+
+	t.Run("writes reach the backend", func(t *testing.T) {
+		backend := NewInMemoryStore()
+		store, _ := NewMVCCStore(backend, 10, 0)
+
+		store.Put("key1", "value1")
+		store.Put("key2", "value2")
+		store.Delete("key2")
+
+		value, err := backend.Get("key1")
+		if err != nil || value != "value1" {
+			t.Fatalf("Expected backend value 'value1', got '%v' (err: %v)", value, err)
+		}
+		if _, err := backend.Get("key2"); err == nil {
+			t.Fatal("Expected key2 to be deleted from the backend")
+		}
+	})
+}
+
+func TestMVCCStoreReadsAtRevision(t *testing.T) {
+	store := newTestMVCCStore(t, 10)
+
+	store.Put("key1", "v1") // rev 1
+	store.Put("key2", "v1") // rev 2
+	store.Put("key1", "v2") // rev 3
+	store.Delete("key2")    // rev 4
+
+	tests := []struct {
+		rev      int64
+		key      string
+		expected string
+		err      error
+	}{
+		{0, "key1", "", ErrKeyNotFound},
+		{1, "key1", "v1", nil},
+		{2, "key2", "v1", nil},
+		{3, "key1", "v2", nil},
+		{3, "key2", "v1", nil},
+		{4, "key2", "", ErrKeyNotFound},
+		{5, "key1", "", ErrFutureRevision},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s at rev %d", tt.key, tt.rev), func(t *testing.T) {
+			value, err := store.GetAt(tt.key, tt.rev)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if value != tt.expected {
+				t.Fatalf("Expected value '%s', got '%s'", tt.expected, value)
+			}
+		})
+	}
+
+	t.Run("entries at revision", func(t *testing.T) {
+		entries, err := store.EntriesAt(3)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		entryMap := make(map[string]string)
+		for _, entry := range entries {
+			entryMap[entry.Key] = entry.Value
+		}
+		if len(entryMap) != 2 || entryMap["key1"] != "v2" || entryMap["key2"] != "v1" {
+			t.Fatalf("Expected entries {key1: v2, key2: v1}, got %+v", entryMap)
+		}
+	})
+}
+
+func TestMVCCStoreCompaction(t *testing.T) {
+	t.Run("versions past the retention horizon are compacted", func(t *testing.T) {
+		store := newTestMVCCStore(t, 2)
+
+		for i := 1; i <= 5; i++ {
+			store.Put("key", fmt.Sprintf("v%d", i))
+		}
+
+		_, err := store.GetAt("key", 2)
+		if !errors.Is(err, ErrCompacted) {
+			t.Fatalf("Expected ErrCompacted, got %v", err)
+		}
+
+		value, err := store.GetAt("key", 3)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if value != "v3" {
+			t.Fatalf("Expected value 'v3', got '%s'", value)
+		}
+
+		if len(store.versions["key"]) != 3 {
+			t.Fatalf("Expected 3 retained versions, got %d", len(store.versions["key"]))
+		}
+	})
+
+	t.Run("deleted keys are dropped once compacted", func(t *testing.T) {
+		store := newTestMVCCStore(t, 0)
+
+		store.Put("key1", "value1")
+		store.Delete("key1")
+		store.Put("key2", "value2")
+
+		if _, ok := store.versions["key1"]; ok {
+			t.Fatal("Expected key1 to be removed from the version index")
+		}
+	})
+
+	t.Run("deleted keys with a history are dropped eventually", func(t *testing.T) {
+		store, _ := NewMVCCStore(NewInMemoryStore(), 0, 5)
+
+		for i := 0; i < 10000; i++ {
+			key := fmt.Sprintf("key%d", i)
+			store.Put(key, "v1")
+			store.Put(key, "v2")
+			store.Delete(key)
+		}
+
+		// Only the keys deleted since the last sweeps may be left
+		if n := len(store.versions); n > deletedHistoryRevisions+sweepInterval {
+			t.Fatalf("Expected at most %d keys in the version index, got %d", deletedHistoryRevisions+sweepInterval, n)
+		}
+		if _, err := store.History("key9999"); err != nil {
+			t.Fatalf("Expected the last deleted key to keep its history, got %v", err)
+		}
+	})
+
+	t.Run("sweep trims keys that are not written", func(t *testing.T) {
+		store := newTestMVCCStore(t, 0)
+
+		store.Put("cold", "v1")
+		store.Put("cold", "v2")
+		for i := 0; i < sweepInterval; i++ {
+			store.Put("hot", "value")
+		}
+
+		if len(store.versions["cold"]) != 1 {
+			t.Fatalf("Expected 1 retained version for cold key, got %d", len(store.versions["cold"]))
+		}
+	})
+}
+
+func TestMVCCStoreSnapshot(t *testing.T) {
+	t.Run("snapshot sees a stable view", func(t *testing.T) {
+		store := newTestMVCCStore(t, 0)
+
+		store.Put("key1", "v1")
+		store.Put("key2", "v1")
+
+		snapshot := store.Snapshot()
+		defer snapshot.Close()
+
+		store.Put("key1", "v2")
+		store.Delete("key2")
+		store.Put("key3", "v1")
+
+		entries, err := snapshot.Entries()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		entryMap := make(map[string]string)
+		for _, entry := range entries {
+			entryMap[entry.Key] = entry.Value
+		}
+		if len(entryMap) != 2 || entryMap["key1"] != "v1" || entryMap["key2"] != "v1" {
+			t.Fatalf("Expected entries {key1: v1, key2: v1}, got %+v", entryMap)
+		}
+	})
+
+	t.Run("closing a snapshot allows compaction", func(t *testing.T) {
+		store := newTestMVCCStore(t, 0)
+
+		store.Put("key", "v1")
+		snapshot := store.Snapshot()
+		store.Put("key", "v2")
+		snapshot.Close()
+		store.Put("key", "v3")
+
+		_, err := snapshot.Get("key")
+		if !errors.Is(err, ErrCompacted) {
+			t.Fatalf("Expected ErrCompacted, got %v", err)
+		}
+	})
+
+	t.Run("snapshot at compacted revision fails", func(t *testing.T) {
+		store := newTestMVCCStore(t, 0)
+
+		store.Put("key", "v1")
+		store.Put("key", "v2")
+
+		_, err := store.SnapshotAt(1)
+		if !errors.Is(err, ErrCompacted) {
+			t.Fatalf("Expected ErrCompacted, got %v", err)
+		}
+	})
+}
+
+func TestMVCCStoreConsistentEntries(t *testing.T) {
+	store := newTestMVCCStore(t, 0)
+	const keys = 50
+
+	for i := 0; i < keys; i++ {
+		store.Put(fmt.Sprintf("key-%d", i), "0")
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	// The writer always updates all keys to the same generation, one at a time
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for gen := 1; ; gen++ {
+			for i := 0; i < keys; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				store.Put(fmt.Sprintf("key-%d", i), fmt.Sprintf("%d", gen))
+			}
+		}
+	}()
+
+	// A consistent snapshot never observes more than two generations at once
+	for n := 0; n < 100; n++ {
+		snapshot := store.Snapshot()
+		entries, err := snapshot.Entries()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(entries) != keys {
+			t.Fatalf("Expected %d entries, got %d", keys, len(entries))
+		}
+
+		values := make(map[string]bool)
+		for _, entry := range entries {
+			values[entry.Value] = true
+		}
+		if len(values) > 2 {
+			t.Fatalf("Snapshot contains more than two generations: %v", values)
+		}
+		snapshot.Close()
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestMVCCStoreHistory(t *testing.T) {
+	t.Run("returns versions newest first", func(t *testing.T) {
+		store, _ := NewMVCCStore(NewInMemoryStore(), 0, 10)
+
+		store.Put("key", "v1")
+		store.Put("key", "v2")
+		store.Delete("key")
+
+		history, err := store.History("key")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(history) != 3 {
+			t.Fatalf("Expected 3 versions, got %d", len(history))
+		}
+		if !history[0].Deleted || history[0].Revision != 3 {
+			t.Fatalf("Expected newest version to be a deletion at revision 3, got %+v", history[0])
+		}
+		if history[2].Value != "v1" || history[2].Timestamp.IsZero() {
+			t.Fatalf("Expected oldest version to be 'v1' with a timestamp, got %+v", history[2])
+		}
+	})
+
+	t.Run("keeps only the last versions of a key", func(t *testing.T) {
+		store, _ := NewMVCCStore(NewInMemoryStore(), 0, 2)
+
+		for i := 1; i <= 5; i++ {
+			store.Put("key", fmt.Sprintf("v%d", i))
+		}
+
+		history, _ := store.History("key")
+		if len(history) != 2 {
+			t.Fatalf("Expected 2 versions, got %d", len(history))
+		}
+		if history[1].Value != "v4" {
+			t.Fatalf("Expected oldest retained version 'v4', got '%s'", history[1].Value)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		store, _ := NewMVCCStore(NewInMemoryStore(), 0, 2)
+
+		_, err := store.History("nonexistent")
+		if !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+		}
+	})
+}
+
+func TestMVCCStoreRevert(t *testing.T) {
+	t.Run("restores an older value", func(t *testing.T) {
+		backend := NewInMemoryStore()
+		store, _ := NewMVCCStore(backend, 0, 10)
+
+		store.Put("key", "v1")
+		store.Put("key", "v2")
+
+		err := store.Revert("key", 1)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		value, _ := store.Get("key")
+		if value != "v1" {
+			t.Fatalf("Expected value 'v1', got '%s'", value)
+		}
+		value, _ = backend.Get("key")
+		if value != "v1" {
+			t.Fatalf("Expected backend value 'v1', got '%s'", value)
+		}
+		if store.Revision() != 3 {
+			t.Fatalf("Expected revert to create revision 3, got %d", store.Revision())
+		}
+	})
+
+	t.Run("restores a deleted key", func(t *testing.T) {
+		store, _ := NewMVCCStore(NewInMemoryStore(), 0, 10)
+
+		store.Put("key", "v1")
+		store.Delete("key")
+
+		store.Revert("key", 1)
+
+		value, err := store.Get("key")
+		if err != nil || value != "v1" {
+			t.Fatalf("Expected value 'v1', got '%s' (err: %v)", value, err)
+		}
+	})
+
+	t.Run("reverting to a deletion deletes the key", func(t *testing.T) {
+		store, _ := NewMVCCStore(NewInMemoryStore(), 0, 10)
+
+		store.Put("key", "v1")
+		store.Delete("key")
+		store.Put("key", "v2")
+
+		store.Revert("key", 2)
+
+		if _, err := store.Get("key"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+		}
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		store, _ := NewMVCCStore(NewInMemoryStore(), 0, 10)
+
+		store.Put("key", "v1")
+		store.Put("other", "v1")
+
+		err := store.Revert("key", 2)
+		if !errors.Is(err, ErrVersionNotFound) {
+			t.Fatalf("Expected ErrVersionNotFound, got %v", err)
+		}
+	})
+}
+
+func TestMVCCStoreIncrement(t *testing.T) {
+	backend := NewInMemoryStore()
+	store, _ := NewMVCCStore(backend, 10, 0)
+
+	store.Increment("counter", 2)
+	n, err := store.Decrement("counter", 5)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if n != -3 {
+		t.Fatalf("Expected -3, got %d", n)
+	}
+
+	value, _ := store.GetAt("counter", 1)
+	if value != "2" {
+		t.Fatalf("Expected value '2' at revision 1, got '%s'", value)
+	}
+	value, _ = backend.Get("counter")
+	if value != "-3" {
+		t.Fatalf("Expected backend value '-3', got '%s'", value)
+	}
+
+	store.Put("text", "abc")
+	_, err = store.Increment("text", 1)
+	if !errors.Is(err, ErrNotInteger) {
+		t.Fatalf("Expected ErrNotInteger, got %v", err)
+	}
+}
+
+func TestMVCCStoreAppendAndSetRange(t *testing.T) {
+	backend := NewInMemoryStore()
+	store, _ := NewMVCCStore(backend, 10, 0)
+
+	store.Append("key", "hello")      // rev 1
+	store.Append("key", " world")     // rev 2
+	store.SetRange("key", 6, "there") // rev 3
+
+	tests := []struct {
+		rev      int64
+		expected string
+	}{
+		{1, "hello"},
+		{2, "hello world"},
+		{3, "hello there"},
+	}
+	for _, tt := range tests {
+		value, _ := store.GetAt("key", tt.rev)
+		if value != tt.expected {
+			t.Fatalf("Expected '%s' at revision %d, got '%s'", tt.expected, tt.rev, value)
+		}
+	}
+
+	value, _ := backend.Get("key")
+	if value != "hello there" {
+		t.Fatalf("Expected backend value 'hello there', got '%s'", value)
+	}
+}
+
+func TestMVCCStoreUpdate(t *testing.T) {
+	store := newTestMVCCStore(t, 10)
+	store.Put("key", "a")
+
+	store.Update("key", func(value string, exists bool) (string, error) {
+		return value + "b", nil
+	})
+	_, err := store.Update("key", func(string, bool) (string, error) {
+		return "", errors.New("update failed")
+	})
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	if store.Revision() != 2 {
+		t.Fatalf("Expected revision 2, got %d", store.Revision())
+	}
+	value, _ := store.GetAt("key", 1)
+	if value != "a" {
+		t.Fatalf("Expected 'a' at revision 1, got '%s'", value)
+	}
+	value, _ = store.Get("key")
+	if value != "ab" {
+		t.Fatalf("Expected 'ab', got '%s'", value)
+	}
+}
+
+func TestMVCCStoreSlowWrites(t *testing.T) {
+	backend := &blockingStore{
+		InMemoryStore: NewInMemoryStore(),
+		key:           "slow",
+		started:       make(chan struct{}),
+		release:       make(chan struct{}),
+	}
+	store, _ := NewMVCCStore(backend, 10, 0)
+
+	done := make(chan error)
+	go func() {
+		done <- store.Put("slow", "value")
+	}()
+	<-backend.started
+
+	// Other keys are written and read while the backend writes the slow key
+	if err := store.Put("fast", "value"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, err := store.Get("fast"); err != nil || value != "value" {
+		t.Fatalf("Expected 'value', got '%s', %v", value, err)
+	}
+	// The slow write is only visible once committed
+	if _, err := store.Get("slow"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	close(backend.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, err := store.Get("slow"); err != nil || value != "value" {
+		t.Fatalf("Expected 'value', got '%s', %v", value, err)
+	}
+	if rev := store.Revision(); rev != 2 {
+		t.Fatalf("Expected revision 2, got %d", rev)
+	}
+}
@@ -0,0 +1,32 @@
+package kv_store
+
+import (
+	"math"
+	"strconv"
+)
+
+// addInt parses value as a base-10 int64 and adds delta to it.
+// A missing value (exists == false) is treated as 0.
+func addInt(value string, exists bool, delta int64) (int64, error) {
+	var n int64
+	if exists {
+		var err error
+		n, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+	return n + delta, nil
+}
+
+// decrement implements Decrement in terms of the store's Increment.
+func decrement(store KeyValueStore, key string, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrOverflow
+	}
+	return store.Increment(key, -delta)
+}
@@ -0,0 +1,59 @@
+package kv_store
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// flight is a read of a key from disk, shared by the cache misses that join it.
+type flight struct {
+	gen   uint64
+	done  chan struct{}
+	value string
+	err   error
+}
+
+// flightGroup coalesces concurrent cache misses for the same key into a single
+// read from disk. A miss only joins a flight started at the same generation of
+// its key: a flight started before a write could return the value from before
+// it to a read that began after it.
+type flightGroup struct {
+	flights   map[string]*flight
+	coalesced atomic.Int64
+	mu        sync.Mutex
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: make(map[string]*flight)}
+}
+
+// join returns the flight reading key at generation gen, and whether the
+// caller leads it: the leader reads the key and calls land, the others wait
+// for the flight's done channel. A flight started at another generation is
+// replaced for the misses that follow.
+func (g *flightGroup) join(key string, gen uint64) (*flight, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f, ok := g.flights[key]; ok && f.gen == gen {
+		g.coalesced.Add(1)
+		return f, false
+	}
+
+	f := &flight{gen: gen, done: make(chan struct{})}
+	g.flights[key] = f
+	return f, true
+}
+
+// land records the result of the flight f of key, and releases the misses
+// waiting for it.
+func (g *flightGroup) land(key string, f *flight, value string, err error) {
+	g.mu.Lock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	g.mu.Unlock()
+
+	f.value, f.err = value, err
+	close(f.done)
+}
@@ -1,22 +1,93 @@
 package kv_store
 
 import (
+	"errors"
+	"hash/maphash"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/bonearadu/kvstore/cache"
 )
 
+// generationStripes is the number of generation counters of a PersistentCachedStore.
+const generationStripes = 256
+
+// PersistentCachedStore caches the values of a PersistentStore. By default it
+// is write-through: every write is persisted before it returns. In write-back
+// mode, created with NewWriteBackCachedStore, writes are persisted later.
+//
+// Writes hold mu for writing. Cache misses read the disk while holding mu for
+// reading, then fill the cache while holding it for writing, but only if the
+// generation of the key hasn't changed in between: every write bumps the
+// generation of its key, so a fill can never replace a newer value, or
+// resurrect a deleted one. Keys share generation counters by hash, which at
+// worst skips a fill that was safe.
+//
+// Concurrent misses for the same key share a single read from disk, as long
+// as the key isn't written in between.
+//
+// Keys found missing on disk can be remembered for a while in a negative cache,
+// enabled with CacheMisses, so that reading them again doesn't touch the disk.
+// Every write of a key forgets that it was missing.
 type PersistentCachedStore struct {
-	store *PersistentStore
-	cache cache.Cache
-	mu    sync.RWMutex
+	store       *PersistentStore
+	cache       cache.Cache[string, string]
+	missing     cache.Cache[string, struct{}]
+	missingTTL  time.Duration
+	writeBack   *writeBack
+	warmUp      *warmUp
+	flights     *flightGroup
+	generations [generationStripes]uint64
+	seed        maphash.Seed
+	mu          sync.RWMutex
 }
 
+// NewPersistentCachedStore creates a write-through PersistentCachedStore with
+// an LRU cache of cacheCapacity entries.
 func NewPersistentCachedStore(storeRootPath string, cacheCapacity int) *PersistentCachedStore {
+	return NewPersistentCachedStoreWithCache(storeRootPath, cache.NewLRUCache[string, string](cacheCapacity))
+}
+
+// NewPersistentCachedStoreWithCache creates a write-through PersistentCachedStore
+// caching values in c, which must not be used elsewhere.
+func NewPersistentCachedStoreWithCache(storeRootPath string, c cache.Cache[string, string]) *PersistentCachedStore {
 	return &PersistentCachedStore{
-		store: NewPersistentStore(storeRootPath),
-		cache: cache.NewLRUCache(cacheCapacity),
-		mu:    sync.RWMutex{},
+		store:   NewPersistentStore(storeRootPath),
+		cache:   c,
+		flights: newFlightGroup(),
+		seed:    maphash.MakeSeed(),
+		mu:      sync.RWMutex{},
+	}
+}
+
+// CacheMisses enables the negative cache, remembering up to capacity missing
+// keys for ttl each. It must be called before p is used, and returns p.
+func (p *PersistentCachedStore) CacheMisses(capacity int, ttl time.Duration) *PersistentCachedStore {
+	p.missing = cache.NewLRUCache[string, struct{}](capacity)
+	p.missingTTL = ttl
+	return p
+}
+
+// FilterKeys keeps the keys on disk in a cuckoo filter, like
+// PersistentStore.FilterKeys, so that cache misses for missing keys mostly
+// don't touch the disk. It must be called before p is used.
+func (p *PersistentCachedStore) FilterKeys(falsePositiveRate float64) error {
+	return p.store.FilterKeys(falsePositiveRate)
+}
+
+// generation returns the generation counter of key. It may only be read while
+// holding mu, and incremented while holding mu for writing.
+func (p *PersistentCachedStore) generation(key string) *uint64 {
+	return &p.generations[maphash.String(p.seed, key)%generationStripes]
+}
+
+// written records a write of key, before it is made: it bumps the generation of
+// key, and forgets that key was missing. The caller must hold mu for writing.
+func (p *PersistentCachedStore) written(key string) {
+	*p.generation(key)++
+	if p.missing != nil {
+		p.missing.Delete(key)
 	}
 }
 
@@ -24,6 +95,12 @@ func (p *PersistentCachedStore) Put(key string, value string) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if p.writeBack != nil {
+		p.writeDirty(key, value)
+		return nil
+	}
+
+	p.written(key)
 	err := p.store.Put(key, value)
 	if err != nil {
 		return err
@@ -36,23 +113,53 @@ func (p *PersistentCachedStore) Put(key string, value string) error {
 func (p *PersistentCachedStore) Get(key string) (string, error) {
 	p.mu.RLock()
 
-	val, ok := p.cache.Read(key)
-	if ok {
+	if val, ok := p.cache.Read(key); ok {
 		p.mu.RUnlock()
 		return val, nil
 	}
+	if p.writeBack != nil {
+		if val, ok := p.dirtyValue(key); ok {
+			p.mu.RUnlock()
+			return val, nil
+		}
+	}
+	if p.missing != nil {
+		if _, ok := p.missing.Read(key); ok {
+			p.mu.RUnlock()
+			return "", ErrKeyNotFound
+		}
+	}
+
+	// Wait for the read of another miss, rather than reading the key again
+	gen := *p.generation(key)
+	f, leader := p.flights.join(key, gen)
+	if !leader {
+		p.mu.RUnlock()
+		<-f.done
+		return f.value, f.err
+	}
 
 	val, err := p.store.Get(key)
 	p.mu.RUnlock()
+	p.flights.land(key, f, val, err)
+
+	notFound := errors.Is(err, ErrKeyNotFound) && p.missing != nil
+	if err != nil && !notFound {
+		return "", err
+	}
 
-	if err == nil {
-		p.mu.Lock()
-		defer p.mu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
+	// Skip the fill if the key was written since it was read
+	if *p.generation(key) != gen {
+		return val, err
+	}
+	if notFound {
+		p.missing.WriteWithTTL(key, struct{}{}, p.missingTTL)
+	} else {
 		p.cache.Write(key, val)
-		return val, nil
 	}
-
 	return val, err
 }
 
@@ -60,10 +167,197 @@ func (p *PersistentCachedStore) Delete(key string) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	p.written(key)
 	p.cache.Delete(key)
+	if p.writeBack != nil {
+		p.clean(key)
+	}
 	return p.store.Delete(key)
 }
 
+// Entries reads the entries from disk while holding mu, so that they reflect
+// every write that completed before. In write-through mode, the cache never
+// holds a value that isn't on disk; in write-back mode, dirty values replace
+// those on disk.
 func (p *PersistentCachedStore) Entries() ([]Entry, error) {
-	return p.store.Entries()
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entries, err := p.store.Entries()
+	if err != nil || p.writeBack == nil {
+		return entries, err
+	}
+
+	// Dirty keys are newer than their persisted value, if any
+	persisted := make(map[string]bool, len(entries))
+	for i, e := range entries {
+		persisted[e.Key] = true
+		if value, ok := p.dirtyValue(e.Key); ok {
+			entries[i].Value = value
+		}
+	}
+	for e := p.writeBack.dirty.Front(); e != nil; e = e.Next() {
+		if d := e.Value.(*dirtyEntry); !persisted[d.key] {
+			entries = append(entries, Entry{Key: d.key, Value: d.value})
+		}
+	}
+	return entries, nil
+}
+
+func (p *PersistentCachedStore) Increment(key string, delta int64) (int64, error) {
+	if p.writeBack != nil {
+		var n int64
+		_, err := p.updateDirty(key, func(value string, exists bool) (string, error) {
+			var err error
+			n, err = addInt(value, exists, delta)
+			if err != nil {
+				return "", err
+			}
+			return strconv.FormatInt(n, 10), nil
+		})
+		return n, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.written(key)
+	n, err := p.store.Increment(key, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	p.cache.Write(key, strconv.FormatInt(n, 10))
+	return n, nil
+}
+
+func (p *PersistentCachedStore) Decrement(key string, delta int64) (int64, error) {
+	return decrement(p, key, delta)
+}
+
+// Append appends to the persisted value and updates the cached copy, if any,
+// so that the cache never serves the value from before the append.
+func (p *PersistentCachedStore) Append(key string, suffix string) (int, error) {
+	if p.writeBack != nil {
+		value, err := p.updateDirty(key, func(value string, _ bool) (string, error) {
+			return value + suffix, nil
+		})
+		return len(value), err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.written(key)
+	n, err := p.store.Append(key, suffix)
+	if err != nil {
+		p.cache.Delete(key)
+		return 0, err
+	}
+
+	if val, ok := p.cache.Peek(key); ok {
+		p.cache.Write(key, val+suffix)
+	}
+	return n, nil
+}
+
+// SetRange overwrites part of the persisted value and updates the cached copy,
+// if any, so that the cache never serves the value from before the write.
+func (p *PersistentCachedStore) SetRange(key string, offset int64, data string) (int, error) {
+	if p.writeBack != nil {
+		return p.setRangeWriteBack(key, offset, data)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.written(key)
+	n, err := p.store.SetRange(key, offset, data)
+	if err != nil {
+		p.cache.Delete(key)
+		return 0, err
+	}
+
+	if val, ok := p.cache.Peek(key); ok {
+		p.cache.Write(key, setRange(val, offset, data))
+	}
+	return n, nil
+}
+
+func (p *PersistentCachedStore) Update(key string, fn UpdateFunc) (string, error) {
+	if p.writeBack != nil {
+		return p.updateDirty(key, fn)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.written(key)
+	value, err := p.store.Update(key, fn)
+	if err != nil {
+		return "", err
+	}
+
+	p.cache.Write(key, value)
+	return value, nil
+}
+
+func (p *PersistentCachedStore) Drop() error {
+	if p.writeBack != nil {
+		p.stopFlusher()
+	}
+	if p.warmUp != nil {
+		p.stopWarmUp()
+		if err := p.removeCacheKeys(); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.writeBack != nil {
+		p.writeBack.dirty.Init()
+		clear(p.writeBack.elements)
+	}
+	return p.store.Drop()
+}
+
+// Stats reports the statistics of the cache, the number of dirty keys in
+// write-back mode, the number of misses that waited for the read of another,
+// the number of keys loaded by the warm-up, the keys held and found in the
+// negative cache and the statistics of the filter of keys on disk, if enabled.
+func (p *PersistentCachedStore) Stats() map[string]any {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	stats := p.cache.Stats()
+	report := map[string]any{
+		"cache": map[string]any{
+			"entries":   p.cache.Len(),
+			"hits":      stats.Hits,
+			"misses":    stats.Misses,
+			"hit_ratio": stats.HitRatio(),
+			"inserts":   stats.Inserts,
+			"evictions": stats.Evictions,
+			"bytes":     stats.Bytes,
+		},
+	}
+	if p.writeBack != nil {
+		report["dirty"] = p.writeBack.dirty.Len()
+	}
+	report["coalesced"] = p.flights.coalesced.Load()
+	if p.warmUp != nil {
+		report["warmed"] = p.warmUp.warmed.Load()
+	}
+	if p.missing != nil {
+		report["missing"] = map[string]any{
+			"entries": p.missing.Len(),
+			"hits":    p.missing.Stats().Hits,
+		}
+	}
+	if filter, ok := p.store.filterReport(); ok {
+		report["filter"] = filter
+	}
+	return report
 }
@@ -1,8 +1,14 @@
 package kv_store
 
 import (
+	"errors"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/bonearadu/kvstore/cache"
 )
 
 func TestPersistentCachedStorePut(t *testing.T) {
@@ -178,3 +184,462 @@ func TestPersistentCachedStoreEntries(t *testing.T) {
 		}
 	})
 }
+
+func TestPersistentCachedStoreIncrement(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "persistent_cached_store_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	store := NewPersistentCachedStore(tempDir, 2)
+
+	t.Run("cached value is updated", func(t *testing.T) {
+		store.Put("counter", "1")
+		store.Get("counter")
+
+		n, err := store.Increment("counter", 2)
+		if err != nil {
+			t.Fatalf("Increment failed: %v", err)
+		}
+		if n != 3 {
+			t.Errorf("Expected 3, got %d", n)
+		}
+
+		val, _ := store.Get("counter")
+		if val != "3" {
+			t.Errorf("Expected 3, got %s", val)
+		}
+	})
+
+	t.Run("decrement", func(t *testing.T) {
+		n, err := store.Decrement("counter", 5)
+		if err != nil {
+			t.Fatalf("Decrement failed: %v", err)
+		}
+		if n != -2 {
+			t.Errorf("Expected -2, got %d", n)
+		}
+	})
+}
+
+func TestPersistentCachedStoreAppendAndSetRange(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "persistent_cached_store_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	store := NewPersistentCachedStore(tempDir, 2)
+
+	t.Run("append updates cached value", func(t *testing.T) {
+		store.Put("log", "a")
+
+		n, err := store.Append("log", "b")
+		if err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+		if n != 2 {
+			t.Errorf("Expected length 2, got %d", n)
+		}
+
+		val, ok := store.cache.Read("log")
+		if !ok || val != "ab" {
+			t.Errorf("Expected cached value ab, got %s (hit: %v)", val, ok)
+		}
+	})
+
+	t.Run("append to uncached key", func(t *testing.T) {
+		store.store.Put("cold", "a")
+
+		store.Append("cold", "b")
+
+		val, err := store.Get("cold")
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if val != "ab" {
+			t.Errorf("Expected ab, got %s", val)
+		}
+	})
+
+	t.Run("overwrite updates cached value", func(t *testing.T) {
+		store.Put("key", "hello world")
+
+		store.SetRange("key", 0, "HELLO")
+
+		val, ok := store.cache.Read("key")
+		if !ok || val != "HELLO world" {
+			t.Errorf("Expected cached value HELLO world, got %s (hit: %v)", val, ok)
+		}
+		val, _ = store.store.Get("key")
+		if val != "HELLO world" {
+			t.Errorf("Expected persisted value HELLO world, got %s", val)
+		}
+	})
+}
+
+func TestPersistentCachedStoreUpdate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "persistent_cached_store_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	store := NewPersistentCachedStore(tempDir, 2)
+	store.Put("key", "a")
+
+	_, err = store.Update("key", func(value string, exists bool) (string, error) {
+		return value + "b", nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	val, ok := store.cache.Read("key")
+	if !ok || val != "ab" {
+		t.Errorf("Expected cached value ab, got %s (hit: %v)", val, ok)
+	}
+	val, _ = store.store.Get("key")
+	if val != "ab" {
+		t.Errorf("Expected persisted value ab, got %s", val)
+	}
+}
+
+func TestPersistentCachedStoreStats(t *testing.T) {
+	t.Run("write-through", func(t *testing.T) {
+		store := NewPersistentCachedStore(t.TempDir(), 1)
+
+		store.Put("a", "1")
+		store.Put("b", "2")
+		store.Get("b")
+		store.Get("a")
+
+		stats := store.Stats()
+		c := stats["cache"].(map[string]any)
+		if c["entries"] != 1 || c["hits"] != uint64(1) || c["misses"] != uint64(1) || c["evictions"] != uint64(2) {
+			t.Fatalf("Expected 1 entry, 1 hit, 1 miss and 2 evictions, got %v", c)
+		}
+		if _, ok := stats["dirty"]; ok {
+			t.Fatalf("Expected no dirty keys to be reported, got %v", stats)
+		}
+	})
+
+	t.Run("write-back", func(t *testing.T) {
+		store := NewWriteBackCachedStore(t.TempDir(), cache.NewLRUCache[string, string](10), WriteBack{})
+		defer store.Close()
+
+		store.Put("a", "1")
+		store.Put("b", "2")
+
+		if dirty := store.Stats()["dirty"]; dirty != 2 {
+			t.Fatalf("Expected 2 dirty keys, got %v", dirty)
+		}
+	})
+
+	t.Run("key filter", func(t *testing.T) {
+		store := NewPersistentCachedStore(t.TempDir(), 10)
+		if err := store.FilterKeys(0.01); err != nil {
+			t.Fatalf("Failed to filter keys: %v", err)
+		}
+
+		store.Put("a", "1")
+		store.Get("missing")
+
+		filter, ok := store.Stats()["filter"].(map[string]any)
+		if !ok || filter["keys"] != 1 || filter["avoided_reads"] != int64(1) {
+			t.Fatalf("Expected 1 key and 1 avoided read, got %v", filter)
+		}
+	})
+}
+
+func TestPersistentCachedStoreNegativeCache(t *testing.T) {
+	t.Run("missing keys are read from disk once", func(t *testing.T) {
+		store := NewPersistentCachedStore(t.TempDir(), 10).CacheMisses(10, time.Hour)
+
+		if _, err := store.Get("key"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+		}
+
+		// Written behind the cached store's back, so only a disk read finds it
+		store.store.Put("key", "value")
+		if _, err := store.Get("key"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Expected the miss to be cached, got %v", err)
+		}
+		if hits := store.Stats()["missing"].(map[string]any)["hits"]; hits != uint64(1) {
+			t.Fatalf("Expected 1 hit in the negative cache, got %v", hits)
+		}
+	})
+
+	t.Run("missing keys expire", func(t *testing.T) {
+		store := NewPersistentCachedStore(t.TempDir(), 10).CacheMisses(10, time.Millisecond)
+
+		store.Get("key")
+		store.store.Put("key", "value")
+		time.Sleep(5 * time.Millisecond)
+
+		if value, err := store.Get("key"); err != nil || value != "value" {
+			t.Fatalf("Expected 'value', got '%s', %v", value, err)
+		}
+	})
+
+	t.Run("writes forget missing keys", func(t *testing.T) {
+		for _, write := range []struct {
+			name  string
+			write func(store *PersistentCachedStore) error
+			want  string
+		}{
+			{"put", func(store *PersistentCachedStore) error { return store.Put("key", "1") }, "1"},
+			{"increment", func(store *PersistentCachedStore) error {
+				_, err := store.Increment("key", 2)
+				return err
+			}, "2"},
+			{"append", func(store *PersistentCachedStore) error {
+				_, err := store.Append("key", "ab")
+				return err
+			}, "ab"},
+			{"set range", func(store *PersistentCachedStore) error {
+				_, err := store.SetRange("key", 0, "cd")
+				return err
+			}, "cd"},
+			{"update", func(store *PersistentCachedStore) error {
+				_, err := store.Update("key", func(string, bool) (string, error) { return "3", nil })
+				return err
+			}, "3"},
+		} {
+			for _, store := range []*PersistentCachedStore{
+				NewPersistentCachedStore(t.TempDir(), 10).CacheMisses(10, time.Hour),
+				NewWriteBackCachedStore(t.TempDir(), cache.NewLRUCache[string, string](10), WriteBack{}).CacheMisses(10, time.Hour),
+			} {
+				store.Get("key")
+				if err := write.write(store); err != nil {
+					t.Fatalf("%s: expected no error, got %v", write.name, err)
+				}
+				if value, err := store.Get("key"); err != nil || value != write.want {
+					t.Fatalf("%s: expected '%s', got '%s', %v", write.name, write.want, value, err)
+				}
+				store.Close()
+			}
+		}
+	})
+}
+
+func TestPersistentCachedStoreCoalescing(t *testing.T) {
+	type result struct {
+		value string
+		err   error
+	}
+	get := func(store *PersistentCachedStore, key string) <-chan result {
+		results := make(chan result, 1)
+		go func() {
+			value, err := store.Get(key)
+			results <- result{value, err}
+		}()
+		return results
+	}
+
+	t.Run("misses wait for the read in flight", func(t *testing.T) {
+		store := NewPersistentCachedStore(t.TempDir(), 10)
+		store.store.Put("key", "disk")
+
+		// Start a read of key, as a concurrent miss would
+		f, leader := store.flights.join("key", *store.generation("key"))
+		if !leader {
+			t.Fatal("Expected to lead the first flight")
+		}
+
+		results := get(store, "key")
+		select {
+		case r := <-results:
+			t.Fatalf("Expected the miss to wait for the flight, got '%s', %v", r.value, r.err)
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		store.flights.land("key", f, "flight", nil)
+		if r := <-results; r.err != nil || r.value != "flight" {
+			t.Fatalf("Expected the value read by the flight, got '%s', %v", r.value, r.err)
+		}
+		if coalesced := store.Stats()["coalesced"]; coalesced != int64(1) {
+			t.Fatalf("Expected 1 coalesced miss, got %v", coalesced)
+		}
+	})
+
+	for _, write := range []struct {
+		name  string
+		write func(store *PersistentCachedStore)
+		want  result
+	}{
+		{"put", func(store *PersistentCachedStore) { store.Put("key", "new") }, result{"new", nil}},
+		{"delete", func(store *PersistentCachedStore) { store.Delete("key") }, result{"", ErrKeyNotFound}},
+	} {
+		t.Run("misses after a "+write.name+" do not join a read from before it", func(t *testing.T) {
+			store := NewPersistentCachedStore(t.TempDir(), 1)
+			store.Put("key", "old")
+			store.Put("other", "x")
+
+			f, _ := store.flights.join("key", *store.generation("key"))
+			defer store.flights.land("key", f, "old", nil)
+
+			write.write(store)
+			// Evict key, so that the next read misses
+			store.Put("other", "y")
+
+			select {
+			case r := <-get(store, "key"):
+				if r.value != write.want.value || !errors.Is(r.err, write.want.err) {
+					t.Fatalf("Expected '%s', %v, got '%s', %v", write.want.value, write.want.err, r.value, r.err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Expected the miss not to wait for a read from before the write")
+			}
+		})
+	}
+
+	t.Run("concurrent misses read the latest value", func(t *testing.T) {
+		store := NewPersistentCachedStore(t.TempDir(), 1)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			store.Put("key", strconv.Itoa(i))
+			store.Put("other", "x")
+
+			for r := 0; r < 8; r++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if value, err := store.Get("key"); err != nil || value != strconv.Itoa(i) {
+						t.Errorf("Expected '%d', got '%s', %v", i, value, err)
+					}
+				}()
+			}
+			wg.Wait()
+		}
+	})
+}
+
+func TestPersistentCachedStoreConcurrency(t *testing.T) {
+	const readers = 4
+	const iterations = 300
+
+	modes := []struct {
+		name     string
+		newStore func(root string) *PersistentCachedStore
+	}{
+		{"write-through", func(root string) *PersistentCachedStore {
+			return NewPersistentCachedStore(root, 1)
+		}},
+		{"write-back", func(root string) *PersistentCachedStore {
+			return NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](1), WriteBack{BatchSize: 2})
+		}},
+		{"negative cache", func(root string) *PersistentCachedStore {
+			return NewPersistentCachedStore(root, 1).CacheMisses(10, time.Hour)
+		}},
+		{"write-back with negative cache", func(root string) *PersistentCachedStore {
+			return NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](1), WriteBack{BatchSize: 2}).CacheMisses(10, time.Hour)
+		}},
+	}
+
+	// run calls write once per iteration while readers call read concurrently
+	run := func(write func(i int), read func()) {
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		for r := 0; r < readers; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						read()
+					}
+				}
+			}()
+		}
+		for i := 0; i < iterations; i++ {
+			write(i)
+		}
+		close(done)
+		wg.Wait()
+	}
+
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			t.Run("fills do not resurrect deleted values", func(t *testing.T) {
+				store := mode.newStore(t.TempDir())
+				defer store.Close()
+
+				run(func(i int) {
+					store.Put("key", strconv.Itoa(i))
+					// Evict the key, so that readers fill the cache from disk
+					store.Put("other", "x")
+					store.Delete("key")
+					if value, err := store.Get("key"); !errors.Is(err, ErrKeyNotFound) {
+						t.Errorf("Expected ErrKeyNotFound after delete, got '%s', %v", value, err)
+					}
+				}, func() {
+					store.Get("key")
+				})
+			})
+
+			t.Run("missing keys are not remembered once written", func(t *testing.T) {
+				store := mode.newStore(t.TempDir())
+				defer store.Close()
+
+				run(func(i int) {
+					store.Delete("key")
+					store.Put("key", strconv.Itoa(i))
+					if value, err := store.Get("key"); err != nil || value != strconv.Itoa(i) {
+						t.Errorf("Expected '%d' after put, got '%s', %v", i, value, err)
+					}
+				}, func() {
+					store.Get("key")
+				})
+			})
+
+			t.Run("fills do not revert overwritten values", func(t *testing.T) {
+				store := mode.newStore(t.TempDir())
+				defer store.Close()
+
+				run(func(i int) {
+					store.Put("key", strconv.Itoa(i))
+					store.Put("other", "x")
+					store.Increment("key", 1)
+					if value, err := store.Get("key"); err != nil || value != strconv.Itoa(i+1) {
+						t.Errorf("Expected '%d' after increment, got '%s', %v", i+1, value, err)
+					}
+				}, func() {
+					store.Get("key")
+				})
+			})
+
+			t.Run("entries observe writes in order", func(t *testing.T) {
+				store := mode.newStore(t.TempDir())
+				defer store.Close()
+
+				run(func(i int) {
+					store.Put("a", strconv.Itoa(i))
+					store.Put("b", strconv.Itoa(i))
+				}, func() {
+					entries, err := store.Entries()
+					if err != nil {
+						t.Errorf("Expected no error, got %v", err)
+						return
+					}
+					values := make(map[string]int)
+					for _, e := range entries {
+						values[e.Key], _ = strconv.Atoi(e.Value)
+					}
+					// a is always written first, so b can never be ahead of it
+					if _, ok := values["a"]; !ok && len(values) > 0 {
+						t.Errorf("Expected a to exist along with b, got %v", entries)
+					}
+					if values["b"] > values["a"] {
+						t.Errorf("Expected b to never be ahead of a, got %v", entries)
+					}
+				})
+			})
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package kv_store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cacheKeysSuffix is appended to the root of a PersistentCachedStore to name
+// the file holding the keys of its cache. It is kept next to the root rather
+// than in it, where every file is a key.
+const cacheKeysSuffix = ".cache"
+
+// warmUp is the state of the cache warm-up of a PersistentCachedStore.
+type warmUp struct {
+	timeout      time.Duration
+	saveInterval time.Duration
+	warmed       atomic.Int64
+	stop         chan struct{}
+	done         chan struct{}
+	stopOnce     sync.Once
+}
+
+// warmEntry is a value read from disk by the warm-up, at generation gen of its key.
+type warmEntry struct {
+	key   string
+	value string
+	gen   uint64
+}
+
+// WarmCache makes p save the keys of its cache on Close, and every saveInterval
+// if positive so that a crash doesn't lose them, and starts loading the keys
+// saved last into the cache in the background. Keys are read from disk from the
+// most to the least valuable, until they run out or timeout expires, and then
+// added to the cache in reverse, so that the most valuable are the last to be
+// evicted. It must be called before p is used, and returns p.
+func (p *PersistentCachedStore) WarmCache(timeout time.Duration, saveInterval time.Duration) *PersistentCachedStore {
+	p.warmUp = &warmUp{
+		timeout:      timeout,
+		saveInterval: saveInterval,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	go p.warmLoop()
+	return p
+}
+
+// cacheKeysPath returns the path of the file holding the keys of the cache.
+func (p *PersistentCachedStore) cacheKeysPath() string {
+	// Cleaned so that a root with a trailing slash doesn't put the file inside it
+	return filepath.Clean(p.store.storeRoot) + cacheKeysSuffix
+}
+
+// warmLoop warms the cache from the saved keys, if any, then saves the keys
+// of the cache every save interval, until the warm-up is stopped.
+func (p *PersistentCachedStore) warmLoop() {
+	defer close(p.warmUp.done)
+
+	if keys, err := p.savedCacheKeys(); err == nil {
+		if !p.warm(keys) {
+			return
+		}
+	}
+	if p.warmUp.saveInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.warmUp.saveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.warmUp.stop:
+			return
+		case <-ticker.C:
+		}
+		// A failed save keeps the keys saved before, and is retried at the next tick
+		p.saveCacheKeys()
+	}
+}
+
+// warm reads keys until they run out, the timeout expires or the warm-up is
+// stopped, then fills the cache with the values read. Returns false if the
+// warm-up was stopped.
+func (p *PersistentCachedStore) warm(keys []string) bool {
+	deadline := time.Now().Add(p.warmUp.timeout)
+	entries := make([]warmEntry, 0, len(keys))
+	for _, key := range keys {
+		select {
+		case <-p.warmUp.stop:
+			return false
+		default:
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+
+		if e, ok := p.warmRead(key); ok {
+			entries = append(entries, e)
+		}
+	}
+
+	p.warmFill(entries)
+	return true
+}
+
+// savedCacheKeys returns the keys saved by the last Close, if any.
+func (p *PersistentCachedStore) savedCacheKeys() ([]string, error) {
+	data, err := os.ReadFile(p.cacheKeysPath())
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// warmRead reads key from disk like a cache miss would, unless it is cached or
+// dirty. Returns false if it wasn't read, or was deleted since it was saved.
+func (p *PersistentCachedStore) warmRead(key string) (warmEntry, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if _, ok := p.cache.Peek(key); ok {
+		return warmEntry{}, false
+	}
+	if p.writeBack != nil {
+		if _, ok := p.dirtyValue(key); ok {
+			return warmEntry{}, false
+		}
+	}
+
+	gen := *p.generation(key)
+	value, err := p.store.Get(key)
+	if err != nil {
+		return warmEntry{}, false
+	}
+	return warmEntry{key: key, value: value, gen: gen}, true
+}
+
+// warmFill adds entries to the cache from the last to the first, skipping the
+// keys written or cached since they were read.
+func (p *PersistentCachedStore) warmFill(entries []warmEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if *p.generation(e.key) != e.gen {
+			continue
+		}
+		if _, ok := p.cache.Peek(e.key); ok {
+			continue
+		}
+		p.cache.Write(e.key, e.value)
+		p.warmUp.warmed.Add(1)
+	}
+}
+
+// stopWarmUp stops the warm-up and the periodic saves, if still running, and waits for them.
+func (p *PersistentCachedStore) stopWarmUp() {
+	wu := p.warmUp
+	wu.stopOnce.Do(func() {
+		close(wu.stop)
+	})
+	<-wu.done
+}
+
+// saveCacheKeys saves the keys of the cache for the next warm-up. The file is
+// replaced atomically, so that a crash while saving keeps the previous keys.
+func (p *PersistentCachedStore) saveCacheKeys() error {
+	data, err := json.Marshal(p.cache.Keys())
+	if err != nil {
+		return err
+	}
+
+	tmp := p.cacheKeysPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, fileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.cacheKeysPath())
+}
+
+// removeCacheKeys removes the saved keys of the cache.
+func (p *PersistentCachedStore) removeCacheKeys() error {
+	if err := os.Remove(p.cacheKeysPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package kv_store
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bonearadu/kvstore/cache"
+)
+
+// warmed waits for the warm-up of store to finish, and returns the number of keys it loaded.
+func warmed(store *PersistentCachedStore) int64 {
+	<-store.warmUp.done
+	return store.warmUp.warmed.Load()
+}
+
+func TestPersistentCachedStoreWarmUp(t *testing.T) {
+	t.Run("cached keys are loaded after a restart", func(t *testing.T) {
+		root := t.TempDir() + "/store"
+		store := NewPersistentCachedStore(root, 10).WarmCache(time.Minute, 0)
+		store.Put("a", "1")
+		store.Put("b", "2")
+		store.Put("c", "3")
+		if err := store.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		restarted := NewPersistentCachedStore(root, 10).WarmCache(time.Minute, 0)
+		defer restarted.Close()
+
+		if n := warmed(restarted); n != 3 {
+			t.Fatalf("Expected 3 keys to be loaded, got %d", n)
+		}
+		for _, key := range []string{"a", "b", "c"} {
+			if _, ok := restarted.cache.Peek(key); !ok {
+				t.Fatalf("Expected %s to be cached", key)
+			}
+		}
+		if n := restarted.Stats()["warmed"]; n != int64(3) {
+			t.Fatalf("Expected 3 warmed keys to be reported, got %v", n)
+		}
+	})
+
+	t.Run("the most used keys are the last to be evicted", func(t *testing.T) {
+		root := t.TempDir() + "/store"
+		store := NewPersistentCachedStore(root, 10).WarmCache(time.Minute, 0)
+		for i := 0; i < 10; i++ {
+			store.Put(strconv.Itoa(i), "v")
+		}
+		store.Get("3")
+		saved := store.cache.Keys()
+		store.Close()
+
+		restarted := NewPersistentCachedStore(root, 10).WarmCache(time.Minute, 0)
+		defer restarted.Close()
+		warmed(restarted)
+
+		if keys := restarted.cache.Keys(); !slices.Equal(keys, saved) {
+			t.Fatalf("Expected the keys in the order they were saved, %v, got %v", saved, keys)
+		}
+
+		// A smaller cache keeps the most used keys
+		smaller := NewPersistentCachedStore(root, 3).WarmCache(time.Minute, 0)
+		defer smaller.Close()
+		warmed(smaller)
+
+		if keys := smaller.cache.Keys(); !slices.Equal(keys, saved[:3]) {
+			t.Fatalf("Expected the keys %v, got %v", saved[:3], keys)
+		}
+	})
+
+	t.Run("keys deleted since they were saved are skipped", func(t *testing.T) {
+		root := t.TempDir() + "/store"
+		store := NewPersistentCachedStore(root, 10).WarmCache(time.Minute, 0)
+		store.Put("a", "1")
+		store.Put("b", "2")
+		store.Close()
+
+		NewPersistentStore(root).Delete("b")
+
+		restarted := NewPersistentCachedStore(root, 10).WarmCache(time.Minute, 0)
+		defer restarted.Close()
+
+		if n := warmed(restarted); n != 1 {
+			t.Fatalf("Expected 1 key to be loaded, got %d", n)
+		}
+		if _, err := restarted.Get("b"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+		}
+	})
+
+	t.Run("loading stops after the timeout", func(t *testing.T) {
+		root := t.TempDir() + "/store"
+		store := NewPersistentCachedStore(root, 10).WarmCache(time.Minute, 0)
+		store.Put("a", "1")
+		store.Close()
+
+		restarted := NewPersistentCachedStore(root, 10).WarmCache(0, 0)
+		defer restarted.Close()
+
+		if n := warmed(restarted); n != 0 {
+			t.Fatalf("Expected no keys to be loaded, got %d", n)
+		}
+	})
+
+	t.Run("write-back stores keep dirty values", func(t *testing.T) {
+		root := t.TempDir() + "/store"
+		store := NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](10), WriteBack{}).WarmCache(time.Minute, 0)
+		store.Put("a", "1")
+		store.Close()
+
+		restarted := NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](10), WriteBack{}).WarmCache(time.Minute, 0)
+		defer restarted.Close()
+
+		warmed(restarted)
+		restarted.Put("a", "2")
+		if value, err := restarted.Get("a"); err != nil || value != "2" {
+			t.Fatalf("Expected '2', got '%s', %v", value, err)
+		}
+	})
+
+	t.Run("keys are saved periodically", func(t *testing.T) {
+		root := t.TempDir() + "/store"
+		store := NewPersistentCachedStore(root, 10).WarmCache(time.Minute, 10*time.Millisecond)
+		defer store.Close()
+		store.Put("a", "1")
+
+		// The keys are saved without closing the store, as if it crashed
+		deadline := time.Now().Add(time.Second)
+		for {
+			if keys, err := store.savedCacheKeys(); err == nil && slices.Equal(keys, []string{"a"}) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Expected the keys of the cache to be saved")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("the keys are saved next to a root with a trailing slash", func(t *testing.T) {
+		root := t.TempDir() + "/store/"
+		store := NewPersistentCachedStore(root, 10).WarmCache(time.Minute, 0)
+		store.Put("a", "1")
+		store.Close()
+
+		if _, err := os.Stat(root + cacheKeysSuffix); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Expected no saved keys inside the root, got %v", err)
+		}
+		if _, err := os.Stat(root[:len(root)-1] + cacheKeysSuffix); err != nil {
+			t.Fatalf("Expected the keys to be saved next to the root, got %v", err)
+		}
+
+		restarted := NewPersistentCachedStore(root, 10).WarmCache(time.Minute, 0)
+		defer restarted.Close()
+		if n := warmed(restarted); n != 1 {
+			t.Fatalf("Expected 1 key to be loaded, got %d", n)
+		}
+	})
+
+	t.Run("drop removes the saved keys", func(t *testing.T) {
+		root := t.TempDir() + "/store"
+		store := NewPersistentCachedStore(root, 10).WarmCache(time.Minute, 0)
+		store.Put("a", "1")
+		store.Close()
+
+		restarted := NewPersistentCachedStore(root, 10).WarmCache(time.Minute, 0)
+		if err := restarted.Drop(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := os.Stat(root + cacheKeysSuffix); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Expected the saved keys to be removed, got %v", err)
+		}
+	})
+}
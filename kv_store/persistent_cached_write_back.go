@@ -0,0 +1,266 @@
+package kv_store
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bonearadu/kvstore/cache"
+)
+
+// WriteBack configures the write-back mode of a PersistentCachedStore.
+type WriteBack struct {
+	// Interval is the time between flushes of the dirty keys. If it isn't
+	// positive, keys are only flushed in full batches, on eviction and on Close.
+	Interval time.Duration
+
+	// BatchSize is the maximum number of keys written to disk while holding the
+	// store's lock. As soon as this many keys are dirty, they are flushed without
+	// waiting for the interval. If it isn't positive, all dirty keys are flushed at once.
+	BatchSize int
+}
+
+// writeBack holds the keys written to the cache but not yet to disk, in the
+// order they were first written, along with the state of the background flusher.
+type writeBack struct {
+	config   WriteBack
+	dirty    *list.List
+	elements map[string]*list.Element
+	kick     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+type dirtyEntry struct {
+	key   string
+	value string
+}
+
+// NewWriteBackCachedStore creates a PersistentCachedStore in write-back mode,
+// caching values in c, which must not be used elsewhere. Writes only update the
+// cache and mark the key dirty, and a background flusher persists dirty keys in
+// batches. Evicting a dirty key from the cache persists it right away. Dirty
+// keys are lost if the process stops without calling Close.
+//
+// The store never gives cached entries a time to live, so c only evicts entries
+// from Write, which the store calls with its lock held for writing. Entries
+// written to c with a time to live would be evicted from Read as well, without
+// that lock.
+func NewWriteBackCachedStore(storeRootPath string, c cache.Cache[string, string], config WriteBack) *PersistentCachedStore {
+	p := NewPersistentCachedStoreWithCache(storeRootPath, c)
+	p.writeBack = &writeBack{
+		config:   config,
+		dirty:    list.New(),
+		elements: make(map[string]*list.Element),
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	c.OnEvict(p.evicted)
+
+	go p.flushLoop()
+	return p
+}
+
+// flushLoop flushes the dirty keys every interval, or when a batch is full,
+// until the flusher is stopped.
+func (p *PersistentCachedStore) flushLoop() {
+	wb := p.writeBack
+	defer close(wb.done)
+
+	var tick <-chan time.Time
+	if wb.config.Interval > 0 {
+		ticker := time.NewTicker(wb.config.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-wb.stop:
+			return
+		case <-tick:
+		case <-wb.kick:
+		}
+		// Keys that fail to flush stay dirty and are retried next time
+		p.Flush()
+	}
+}
+
+// stopFlusher stops the background flusher and waits for it to return.
+// The caller must not hold mu, which the flusher may be waiting for.
+func (p *PersistentCachedStore) stopFlusher() {
+	wb := p.writeBack
+	wb.stopOnce.Do(func() {
+		close(wb.stop)
+	})
+	<-wb.done
+}
+
+// writeDirty writes value to the cache and marks key dirty, keeping its
+// position if it already was. The caller must hold mu for writing.
+func (p *PersistentCachedStore) writeDirty(key string, value string) {
+	p.written(key)
+
+	wb := p.writeBack
+	if e, ok := wb.elements[key]; ok {
+		e.Value.(*dirtyEntry).value = value
+	} else {
+		wb.elements[key] = wb.dirty.PushBack(&dirtyEntry{key: key, value: value})
+	}
+
+	p.cache.Write(key, value)
+
+	if wb.config.BatchSize > 0 && wb.dirty.Len() >= wb.config.BatchSize {
+		select {
+		case wb.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// clean unmarks key as dirty. The caller must hold mu for writing.
+func (p *PersistentCachedStore) clean(key string) {
+	wb := p.writeBack
+	if e, ok := wb.elements[key]; ok {
+		wb.dirty.Remove(e)
+		delete(wb.elements, key)
+	}
+}
+
+// dirtyValue returns the value of key if it is dirty. The caller must hold mu.
+func (p *PersistentCachedStore) dirtyValue(key string) (string, bool) {
+	if e, ok := p.writeBack.elements[key]; ok {
+		return e.Value.(*dirtyEntry).value, true
+	}
+	return "", false
+}
+
+// evicted persists a dirty key evicted from the cache. If that fails, the key
+// stays dirty and is still read from the dirty set until it is flushed. It is
+// called by the cache from Write, so mu is held for writing.
+func (p *PersistentCachedStore) evicted(key string, value string, reason cache.EvictReason) {
+	if _, ok := p.dirtyValue(key); !ok {
+		return
+	}
+	if err := p.store.Put(key, value); err == nil {
+		p.clean(key)
+	}
+}
+
+// load returns the latest value of key, from the cache, the dirty set or the
+// disk, in that order. The caller must hold mu.
+func (p *PersistentCachedStore) load(key string) (string, bool, error) {
+	if value, ok := p.cache.Read(key); ok {
+		return value, true, nil
+	}
+	if value, ok := p.dirtyValue(key); ok {
+		return value, true, nil
+	}
+
+	value, err := p.store.Get(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// setRangeWriteBack overwrites part of the latest value of key, like SetRange,
+// and writes the result back to the cache as a dirty key.
+func (p *PersistentCachedStore) setRangeWriteBack(key string, offset int64, data string) (int, error) {
+	if err := checkRange(offset, len(data)); err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	value, exists, err := p.load(key)
+	if err != nil {
+		return 0, err
+	}
+	if !exists && data == "" {
+		return 0, nil
+	}
+
+	value = setRange(value, offset, data)
+	p.writeDirty(key, value)
+	return len(value), nil
+}
+
+// updateDirty applies fn to the latest value of key and writes the result back
+// to the cache as a dirty key.
+func (p *PersistentCachedStore) updateDirty(key string, fn UpdateFunc) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	value, exists, err := p.load(key)
+	if err != nil {
+		return "", err
+	}
+	value, err = fn(value, exists)
+	if err != nil {
+		return "", err
+	}
+
+	p.writeDirty(key, value)
+	return value, nil
+}
+
+// flushBatch writes the oldest batch of dirty keys to disk, in the order they
+// were first written, and returns whether dirty keys remain.
+func (p *PersistentCachedStore) flushBatch() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wb := p.writeBack
+	n := wb.config.BatchSize
+	if n <= 0 {
+		n = wb.dirty.Len()
+	}
+
+	for ; n > 0 && wb.dirty.Len() > 0; n-- {
+		e := wb.dirty.Front().Value.(*dirtyEntry)
+		if err := p.store.Put(e.key, e.value); err != nil {
+			return true, err
+		}
+		p.clean(e.key)
+	}
+	return wb.dirty.Len() > 0, nil
+}
+
+// Flush writes all dirty keys to disk, one batch at a time, so that other
+// operations can run between batches. In write-through mode, it does nothing.
+func (p *PersistentCachedStore) Flush() error {
+	if p.writeBack == nil {
+		return nil
+	}
+
+	for {
+		more, err := p.flushBatch()
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// Close stops the background flusher and writes all dirty keys to disk, and
+// stops the cache warm-up and saves the keys of the cache for the next one.
+// The store must not be written to afterwards.
+func (p *PersistentCachedStore) Close() error {
+	var errs []error
+	if p.writeBack != nil {
+		p.stopFlusher()
+		errs = append(errs, p.Flush())
+	}
+	if p.warmUp != nil {
+		p.stopWarmUp()
+		errs = append(errs, p.saveCacheKeys())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,299 @@
+package kv_store
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bonearadu/kvstore/cache"
+)
+
+// persisted returns the value of key on disk under root, as a restarted store would see it.
+func persisted(t *testing.T, root string, key string) (string, bool) {
+	t.Helper()
+	value, err := NewPersistentStore(root).Get(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return "", false
+	}
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return value, true
+}
+
+// eventuallyPersisted waits for key to be persisted with value.
+func eventuallyPersisted(t *testing.T, root string, key string, value string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if v, ok := persisted(t, root, key); ok && v == value {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected %s to be persisted with value '%s'", key, value)
+}
+
+func TestWriteBackCachedStore(t *testing.T) {
+	// Without an interval or batch size, keys are only flushed on eviction and on demand
+	manual := WriteBack{}
+
+	t.Run("writes are not persisted before a flush", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](10), manual)
+		defer store.Close()
+
+		store.Put("key", "value")
+
+		// A crash at this point loses the write
+		if _, ok := persisted(t, root, "key"); ok {
+			t.Fatal("Expected key not to be persisted before a flush")
+		}
+		if value, err := store.Get("key"); err != nil || value != "value" {
+			t.Fatalf("Expected 'value', got '%s', %v", value, err)
+		}
+
+		if err := store.Flush(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if value, ok := persisted(t, root, "key"); !ok || value != "value" {
+			t.Fatalf("Expected 'value' to be persisted, got '%s', %v", value, ok)
+		}
+	})
+
+	t.Run("evicting a dirty key persists it", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](1), manual)
+		defer store.Close()
+
+		store.Put("a", "1")
+		store.Put("b", "2")
+
+		if value, ok := persisted(t, root, "a"); !ok || value != "1" {
+			t.Fatalf("Expected evicted key to be persisted with '1', got '%s', %v", value, ok)
+		}
+		if _, ok := persisted(t, root, "b"); ok {
+			t.Fatal("Expected cached key not to be persisted")
+		}
+		if value, err := store.Get("a"); err != nil || value != "1" {
+			t.Fatalf("Expected '1', got '%s', %v", value, err)
+		}
+	})
+
+	t.Run("evicted dirty keys are persisted with every cache policy", func(t *testing.T) {
+		for _, policy := range cache.Policies {
+			root := t.TempDir()
+			c, _ := cache.New[string, string](policy, 2)
+			store := NewWriteBackCachedStore(root, c, manual)
+
+			// Rejecting a new entry at admission counts as evicting it
+			for i := 0; i < 20; i++ {
+				store.Put(strconv.Itoa(i), strconv.Itoa(i))
+				store.Get(strconv.Itoa(i / 3))
+			}
+			for i := 0; i < 20; i++ {
+				if value, err := store.Get(strconv.Itoa(i)); err != nil || value != strconv.Itoa(i) {
+					t.Fatalf("%s: expected '%d', got '%s', %v", policy, i, value, err)
+				}
+			}
+			store.Close()
+		}
+	})
+
+	t.Run("values too large to be cached are persisted", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewWriteBackCachedStore(root, cache.NewWeightedLRUCache(cache.Weights[string, string]{MaxWeight: 80}), manual)
+		defer store.Close()
+
+		store.Put("small", "1")
+		store.Put("large", strings.Repeat("x", 100))
+
+		if value, ok := persisted(t, root, "large"); !ok || len(value) != 100 {
+			t.Fatalf("Expected the large value to be persisted, got '%s', %v", value, ok)
+		}
+		if _, ok := persisted(t, root, "small"); ok {
+			t.Fatal("Expected the cached small value not to be persisted")
+		}
+	})
+
+	t.Run("batches are flushed in the order keys were first written", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](10), WriteBack{BatchSize: 2})
+		defer store.Close()
+
+		// Keep the flusher from racing with the batches written below
+		store.stopFlusher()
+
+		store.Put("c", "1")
+		store.Put("a", "1")
+		store.Put("b", "1")
+		store.Put("c", "2")
+
+		// A crash after the first batch keeps the oldest keys, with their latest value
+		if more, err := store.flushBatch(); err != nil || !more {
+			t.Fatalf("Expected more dirty keys and no error, got %v, %v", more, err)
+		}
+		if value, ok := persisted(t, root, "c"); !ok || value != "2" {
+			t.Fatalf("Expected c to be persisted with '2', got '%s', %v", value, ok)
+		}
+		if _, ok := persisted(t, root, "a"); !ok {
+			t.Fatal("Expected a to be persisted")
+		}
+		if _, ok := persisted(t, root, "b"); ok {
+			t.Fatal("Expected b not to be persisted before the second batch")
+		}
+
+		if more, err := store.flushBatch(); err != nil || more {
+			t.Fatalf("Expected no more dirty keys and no error, got %v, %v", more, err)
+		}
+		if _, ok := persisted(t, root, "b"); !ok {
+			t.Fatal("Expected b to be persisted")
+		}
+	})
+
+	t.Run("deleted dirty keys are not flushed", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](10), manual)
+		defer store.Close()
+
+		store.Put("key", "old")
+		store.Flush()
+		store.Put("key", "new")
+		store.Delete("key")
+		store.Flush()
+
+		if _, ok := persisted(t, root, "key"); ok {
+			t.Fatal("Expected deleted key not to be persisted")
+		}
+		if _, err := store.Get("key"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+		}
+	})
+
+	t.Run("flusher persists keys every interval", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](10), WriteBack{Interval: 10 * time.Millisecond})
+		defer store.Close()
+
+		store.Put("key", "value")
+		eventuallyPersisted(t, root, "key", "value")
+	})
+
+	t.Run("full batches are flushed without waiting", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](10), WriteBack{Interval: time.Hour, BatchSize: 2})
+		defer store.Close()
+
+		store.Put("a", "1")
+		store.Put("b", "2")
+		eventuallyPersisted(t, root, "a", "1")
+		eventuallyPersisted(t, root, "b", "2")
+	})
+
+	t.Run("close drains dirty keys", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](100), WriteBack{BatchSize: 7})
+
+		for i := 0; i < 50; i++ {
+			store.Put(strconv.Itoa(i), strconv.Itoa(i))
+		}
+		if err := store.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		for i := 0; i < 50; i++ {
+			if value, ok := persisted(t, root, strconv.Itoa(i)); !ok || value != strconv.Itoa(i) {
+				t.Fatalf("Expected %d to be persisted, got '%s', %v", i, value, ok)
+			}
+		}
+	})
+
+	t.Run("read-modify-write operations see dirty values", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](1), manual)
+		defer store.Close()
+
+		store.Put("n", "1")
+		store.Put("s", "ab")
+		store.Put("other", "x")
+
+		if n, err := store.Increment("n", 2); err != nil || n != 3 {
+			t.Fatalf("Expected 3, got %d, %v", n, err)
+		}
+		if n, err := store.Append("s", "cd"); err != nil || n != 4 {
+			t.Fatalf("Expected 4, got %d, %v", n, err)
+		}
+		if n, err := store.SetRange("s", 1, "B"); err != nil || n != 4 {
+			t.Fatalf("Expected 4, got %d, %v", n, err)
+		}
+		if n, err := store.SetRange("missing", 0, ""); err != nil || n != 0 {
+			t.Fatalf("Expected 0, got %d, %v", n, err)
+		}
+		value, err := store.Update("n", func(value string, exists bool) (string, error) {
+			return value + "0", nil
+		})
+		if err != nil || value != "30" {
+			t.Fatalf("Expected '30', got '%s', %v", value, err)
+		}
+		if value, _ := store.Get("s"); value != "aBcd" {
+			t.Fatalf("Expected 'aBcd', got '%s'", value)
+		}
+	})
+
+	t.Run("entries include dirty keys", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](10), manual)
+		defer store.Close()
+
+		store.Put("a", "1")
+		store.Put("b", "1")
+		store.Flush()
+		store.Put("b", "2")
+		store.Put("c", "3")
+
+		entries, err := store.Entries()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		values := make(map[string]string)
+		for _, e := range entries {
+			values[e.Key] = e.Value
+		}
+		if len(entries) != 3 || values["a"] != "1" || values["b"] != "2" || values["c"] != "3" {
+			t.Fatalf("Expected a=1, b=2 and c=3, got %v", entries)
+		}
+	})
+
+	t.Run("concurrent writes with a running flusher", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewWriteBackCachedStore(root, cache.NewLRUCache[string, string](4), WriteBack{Interval: time.Millisecond, BatchSize: 3})
+
+		const goroutines = 8
+		const iterations = 100
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					store.Increment("counter", 1)
+					store.Put("key"+strconv.Itoa((g+i)%10), strconv.Itoa(g))
+					store.Get("key" + strconv.Itoa(i%10))
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		if err := store.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		want := strconv.Itoa(goroutines * iterations)
+		if value, ok := persisted(t, root, "counter"); !ok || value != want {
+			t.Fatalf("Expected '%s' to be persisted, got '%s', %v", want, value, ok)
+		}
+	})
+}
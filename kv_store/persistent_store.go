@@ -5,105 +5,170 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 )
 
+// PersistentStore keeps every key in its own file under storeRoot.
+//
+// Operations on a key hold a lock entry for that key, which is created on first
+// use and reference-counted, so that it is removed only once no goroutine holds
+// or waits for it. Operations on single keys also hold storeMutex for reading,
+// while Entries and Drop hold it for writing to observe the whole store at once.
+//
+// Keys can be kept in a filter, enabled with FilterKeys, so that reading a
+// missing key mostly doesn't touch the disk.
 type PersistentStore struct {
-	storeRoot   string
-	keyMutexMap map[string]*sync.RWMutex
-	mapMutex    sync.RWMutex
+	storeRoot  string
+	filter     *keyFilter
+	keyLocks   map[string]*keyLock
+	locksMutex sync.Mutex
+	storeMutex sync.RWMutex
+}
+
+// keyLock is the lock entry of a key, shared by the refs goroutines using it.
+type keyLock struct {
+	mu   sync.RWMutex
+	refs int
 }
 
 const fileMode = 0777
 
 func NewPersistentStore(storeRootPath string) *PersistentStore {
 	if _, err := os.Stat(storeRootPath); errors.Is(err, os.ErrNotExist) {
-		os.Mkdir(storeRootPath, fileMode)
+		os.MkdirAll(storeRootPath, fileMode)
 	}
 
 	return &PersistentStore{
-		storeRoot:   storeRootPath,
-		keyMutexMap: make(map[string]*sync.RWMutex),
-		mapMutex:    sync.RWMutex{},
+		storeRoot:  storeRootPath,
+		keyLocks:   make(map[string]*keyLock),
+		locksMutex: sync.Mutex{},
+		storeMutex: sync.RWMutex{},
 	}
 }
 
-func (p *PersistentStore) getMutex(key string) *sync.RWMutex {
-	p.mapMutex.RLock()
-	m, ok := p.keyMutexMap[key]
-	p.mapMutex.RUnlock()
+// acquire returns the lock entry of key, creating it if needed, and takes a
+// reference to it. Every call must be paired with a call to release.
+func (p *PersistentStore) acquire(key string) *keyLock {
+	p.locksMutex.Lock()
+	defer p.locksMutex.Unlock()
 
+	l, ok := p.keyLocks[key]
 	if !ok {
-		m = &sync.RWMutex{}
+		l = &keyLock{}
+		p.keyLocks[key] = l
+	}
+	l.refs++
+	return l
+}
+
+// release drops a reference to the lock entry of key, removing it once unused.
+func (p *PersistentStore) release(key string, l *keyLock) {
+	p.locksMutex.Lock()
+	defer p.locksMutex.Unlock()
 
-		p.mapMutex.Lock()
-		p.keyMutexMap[key] = m
-		p.mapMutex.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(p.keyLocks, key)
 	}
+}
+
+// lock locks key for writing and returns the function unlocking it.
+func (p *PersistentStore) lock(key string) func() {
+	p.storeMutex.RLock()
+	l := p.acquire(key)
+	l.mu.Lock()
 
-	return m
+	return func() {
+		l.mu.Unlock()
+		p.release(key, l)
+		p.storeMutex.RUnlock()
+	}
 }
 
-func (p *PersistentStore) removeMutex(key string) {
-	p.mapMutex.Lock()
-	delete(p.keyMutexMap, key)
-	p.mapMutex.Unlock()
+// rlock locks key for reading and returns the function unlocking it.
+func (p *PersistentStore) rlock(key string) func() {
+	p.storeMutex.RLock()
+	l := p.acquire(key)
+	l.mu.RLock()
+
+	return func() {
+		l.mu.RUnlock()
+		p.release(key, l)
+		p.storeMutex.RUnlock()
+	}
 }
 
 func (p *PersistentStore) Put(key string, value string) error {
-	mu := p.getMutex(key)
-	mu.Lock()
-	defer mu.Unlock()
+	defer p.lock(key)()
+
+	return p.putUnsafe(key, value)
+}
 
+func (p *PersistentStore) putUnsafe(key string, value string) error {
+	add := p.filterAdds(key)
 	bytes := []byte(value)
 	err := os.WriteFile(path.Join(p.storeRoot, key), bytes, fileMode)
 
 	if err != nil {
 		return fmt.Errorf("error writing value for key %s", key)
 	}
+	if add {
+		p.filter.add(key)
+	}
 	return nil
 }
 
 func (p *PersistentStore) Get(key string) (string, error) {
-	mu := p.getMutex(key)
-	mu.RLock()
-	defer mu.RUnlock()
+	defer p.rlock(key)()
 
 	return p.getUnsafe(key)
 }
 
+// getUnsafe reads key from disk, unless the filter tells it is missing.
 func (p *PersistentStore) getUnsafe(key string) (string, error) {
+	if !p.mayHold(key) {
+		return "", ErrKeyNotFound
+	}
+
+	value, err := p.readUnsafe(key)
+	if err != nil && p.filter != nil {
+		p.filter.falsePositives.Add(1)
+	}
+	return value, err
+}
+
+// readUnsafe reads key from disk.
+func (p *PersistentStore) readUnsafe(key string) (string, error) {
 	bytes, err := os.ReadFile(path.Join(p.storeRoot, key))
 
 	if err != nil {
-		return "", fmt.Errorf("key not found")
+		return "", ErrKeyNotFound
 	}
 
 	return string(bytes), nil
 }
 
 func (p *PersistentStore) Delete(key string) error {
-	mu := p.getMutex(key)
-	mu.Lock()
-	defer func() {
-		mu.Unlock()
-		p.removeMutex(key)
-	}()
+	defer p.lock(key)()
 
 	err := os.Remove(path.Join(p.storeRoot, key))
 
 	if err != nil && !strings.Contains(err.Error(), "no such file or directory") {
 		return fmt.Errorf("error removing key %s", key)
 	}
+	// Only keys on disk are in the filter: removing another could remove the
+	// fingerprint of a key that shares it
+	if err == nil && p.filter != nil {
+		p.filter.remove(key)
+	}
 	return nil
 }
 
 func (p *PersistentStore) Entries() ([]Entry, error) {
-	for _, mu := range p.keyMutexMap {
-		mu.Lock()
-		defer mu.Unlock()
-	}
+	p.storeMutex.Lock()
+	defer p.storeMutex.Unlock()
 
 	keys, err := os.ReadDir(p.storeRoot)
 	if err != nil {
@@ -113,7 +178,7 @@ func (p *PersistentStore) Entries() ([]Entry, error) {
 	entries := make([]Entry, 0, len(keys))
 	for _, key := range keys {
 		name := key.Name()
-		val, err := p.getUnsafe(name)
+		val, err := p.readUnsafe(name)
 		if err != nil {
 			return []Entry{}, err
 		}
@@ -122,3 +187,113 @@ func (p *PersistentStore) Entries() ([]Entry, error) {
 
 	return entries, nil
 }
+
+func (p *PersistentStore) Increment(key string, delta int64) (int64, error) {
+	defer p.lock(key)()
+
+	value, err := p.getUnsafe(key)
+	n, err := addInt(value, err == nil, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := p.putUnsafe(key, strconv.FormatInt(n, 10)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (p *PersistentStore) Decrement(key string, delta int64) (int64, error) {
+	return decrement(p, key, delta)
+}
+
+// Append appends suffix to the file backing the key using an O_APPEND write,
+// without reading the existing value.
+func (p *PersistentStore) Append(key string, suffix string) (int, error) {
+	defer p.lock(key)()
+
+	add := p.filterAdds(key)
+	f, err := os.OpenFile(path.Join(p.storeRoot, key), os.O_WRONLY|os.O_APPEND|os.O_CREATE, fileMode)
+	if err != nil {
+		return 0, fmt.Errorf("error appending value for key %s", key)
+	}
+	defer f.Close()
+	if add {
+		p.filter.add(key)
+	}
+
+	if _, err := f.WriteString(suffix); err != nil {
+		return 0, fmt.Errorf("error appending value for key %s", key)
+	}
+	return fileSize(f)
+}
+
+// SetRange writes data at offset into the file backing the key, without
+// reading the existing value. Gaps past the end of the file read back as zero bytes.
+func (p *PersistentStore) SetRange(key string, offset int64, data string) (int, error) {
+	if err := checkRange(offset, len(data)); err != nil {
+		return 0, err
+	}
+
+	defer p.lock(key)()
+
+	if data == "" {
+		info, err := os.Stat(path.Join(p.storeRoot, key))
+		if err != nil {
+			return 0, nil
+		}
+		return int(info.Size()), nil
+	}
+
+	add := p.filterAdds(key)
+	f, err := os.OpenFile(path.Join(p.storeRoot, key), os.O_WRONLY|os.O_CREATE, fileMode)
+	if err != nil {
+		return 0, fmt.Errorf("error writing value for key %s", key)
+	}
+	defer f.Close()
+	if add {
+		p.filter.add(key)
+	}
+
+	if _, err := f.WriteAt([]byte(data), offset); err != nil {
+		return 0, fmt.Errorf("error writing value for key %s", key)
+	}
+	return fileSize(f)
+}
+
+func (p *PersistentStore) Update(key string, fn UpdateFunc) (string, error) {
+	defer p.lock(key)()
+
+	value, err := p.getUnsafe(key)
+	value, err = fn(value, err == nil)
+	if err != nil {
+		return "", err
+	}
+
+	if err := p.putUnsafe(key, value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func fileSize(f *os.File) (int, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("error reading size of %s", f.Name())
+	}
+	return int(info.Size()), nil
+}
+
+// Drop removes the store's root directory along with all the keys it holds.
+func (p *PersistentStore) Drop() error {
+	p.storeMutex.Lock()
+	defer p.storeMutex.Unlock()
+
+	if err := os.RemoveAll(p.storeRoot); err != nil {
+		return fmt.Errorf("error removing store root %s", p.storeRoot)
+	}
+	if p.filter != nil {
+		p.filter.reset()
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package kv_store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync/atomic"
+)
+
+// keyFilter is the filter of the keys of a PersistentStore, along with the
+// reads of missing keys it saved, and the ones it didn't.
+type keyFilter struct {
+	*cuckooFilter
+	avoided        atomic.Int64
+	falsePositives atomic.Int64
+}
+
+// FilterKeys makes p keep its keys in a cuckoo filter, so that reading a key
+// that doesn't exist mostly doesn't touch the disk. The filter is built from
+// the keys on disk, and updated by every write and delete: files added to the
+// root of p by other means aren't seen until the next start. falsePositiveRate
+// is the share of the reads of missing keys that still read the disk. It must
+// be called before p is used. Returns an error, leaving keys unfiltered, if the
+// keys on disk can't be listed.
+func (p *PersistentStore) FilterKeys(falsePositiveRate float64) error {
+	p.storeMutex.Lock()
+	defer p.storeMutex.Unlock()
+
+	keys, err := os.ReadDir(p.storeRoot)
+	if err != nil {
+		return fmt.Errorf("error reading keys from path %s: %w", p.storeRoot, err)
+	}
+
+	p.filter = &keyFilter{cuckooFilter: newCuckooFilter(2*len(keys), falsePositiveRate)}
+	for _, key := range keys {
+		p.filter.add(key.Name())
+	}
+	return nil
+}
+
+// mayHold reports whether key may be on disk, recording the read avoided if not.
+func (p *PersistentStore) mayHold(key string) bool {
+	if p.filter == nil {
+		return true
+	}
+	if !p.filter.contains(key) {
+		p.filter.avoided.Add(1)
+		return false
+	}
+	return true
+}
+
+// filterAdds reports whether key must be added to the filter once written:
+// whether p filters keys, and key isn't on disk yet. The disk is only checked
+// if the filter may hold key. The caller must hold the lock of key for writing.
+func (p *PersistentStore) filterAdds(key string) bool {
+	if p.filter == nil {
+		return false
+	}
+	if !p.filter.contains(key) {
+		return true
+	}
+	_, err := os.Stat(path.Join(p.storeRoot, key))
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// filterReport returns the statistics of the filter of p, if it filters keys.
+func (p *PersistentStore) filterReport() (map[string]any, bool) {
+	if p.filter == nil {
+		return nil, false
+	}
+	return map[string]any{
+		"keys":            p.filter.len(),
+		"bytes":           p.filter.bytes(),
+		"avoided_reads":   p.filter.avoided.Load(),
+		"false_positives": p.filter.falsePositives.Load(),
+	}, true
+}
+
+// Stats reports the keys in the filter of p, the memory it takes, the reads of
+// missing keys it avoided and the ones it let through, if p filters keys.
+func (p *PersistentStore) Stats() map[string]any {
+	report := map[string]any{}
+	if filter, ok := p.filterReport(); ok {
+		report["filter"] = filter
+	}
+	return report
+}
@@ -1,7 +1,13 @@
 package kv_store
 
 import (
+	"errors"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -207,3 +213,464 @@ func TestPersistentStorePersistence(t *testing.T) {
 		t.Fatalf("Expected value 'value1', got '%v'", value)
 	}
 }
+
+func TestPersistentStoreIncrement(t *testing.T) {
+	storeRoot, err := os.MkdirTemp("", "persistent_store_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(storeRoot)
+
+	store := NewPersistentStore(storeRoot)
+
+	t.Run("increment and decrement", func(t *testing.T) {
+		store.Increment("counter", 10)
+		n, err := store.Decrement("counter", 4)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if n != 6 {
+			t.Fatalf("Expected 6, got %d", n)
+		}
+
+		value, _ := store.Get("counter")
+		if value != "6" {
+			t.Fatalf("Expected stored value '6', got '%s'", value)
+		}
+	})
+
+	t.Run("non-numeric value", func(t *testing.T) {
+		store.Put("text", "abc")
+
+		_, err := store.Increment("text", 1)
+		if !errors.Is(err, ErrNotInteger) {
+			t.Fatalf("Expected ErrNotInteger, got %v", err)
+		}
+	})
+
+	t.Run("concurrent increments", func(t *testing.T) {
+		const goroutines = 10
+		const operationsPerGoroutine = 20
+
+		var wg sync.WaitGroup
+		wg.Add(goroutines)
+		for i := 0; i < goroutines; i++ {
+			go func() {
+				defer wg.Done()
+				for j := 0; j < operationsPerGoroutine; j++ {
+					store.Increment("hits", 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		value, _ := store.Get("hits")
+		if value != strconv.Itoa(goroutines*operationsPerGoroutine) {
+			t.Fatalf("Expected %d, got %s", goroutines*operationsPerGoroutine, value)
+		}
+	})
+}
+
+func TestPersistentStoreAppendAndSetRange(t *testing.T) {
+	storeRoot, err := os.MkdirTemp("", "persistent_store_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(storeRoot)
+
+	store := NewPersistentStore(storeRoot)
+
+	t.Run("append", func(t *testing.T) {
+		store.Append("log", "line1\n")
+		n, err := store.Append("log", "line2\n")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if n != 12 {
+			t.Fatalf("Expected length 12, got %d", n)
+		}
+
+		value, _ := store.Get("log")
+		if value != "line1\nline2\n" {
+			t.Fatalf("Expected 'line1\\nline2\\n', got %q", value)
+		}
+	})
+
+	t.Run("overwrite range", func(t *testing.T) {
+		store.Put("key", "hello world")
+
+		n, err := store.SetRange("key", 6, "there")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if n != 11 {
+			t.Fatalf("Expected length 11, got %d", n)
+		}
+
+		value, _ := store.Get("key")
+		if value != "hello there" {
+			t.Fatalf("Expected 'hello there', got %q", value)
+		}
+	})
+
+	t.Run("overwrite past end pads with zero bytes", func(t *testing.T) {
+		n, err := store.SetRange("sparse", 2, "x")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if n != 3 {
+			t.Fatalf("Expected length 3, got %d", n)
+		}
+
+		value, _ := store.Get("sparse")
+		if value != "\x00\x00x" {
+			t.Fatalf("Expected zero-padded value, got %q", value)
+		}
+	})
+}
+
+func TestPersistentStoreUpdate(t *testing.T) {
+	storeRoot, err := os.MkdirTemp("", "persistent_store_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(storeRoot)
+
+	store := NewPersistentStore(storeRoot)
+	store.Put("key", "a")
+
+	value, err := store.Update("key", func(value string, exists bool) (string, error) {
+		return value + "b", nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value != "ab" {
+		t.Fatalf("Expected 'ab', got '%s'", value)
+	}
+
+	_, err = store.Update("key", func(string, bool) (string, error) {
+		return "", errors.New("update failed")
+	})
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if value, _ := store.Get("key"); value != "ab" {
+		t.Fatalf("Expected 'ab', got '%s'", value)
+	}
+}
+
+func TestPersistentStoreConcurrency(t *testing.T) {
+	const goroutines = 8
+	const iterations = 200
+
+	// Every value written to a key is a single repeated character, so a torn
+	// read or write shows up as a value mixing characters.
+	checkValue := func(t *testing.T, key, value string) {
+		if value != "" && strings.Count(value, value[:1]) != len(value) {
+			t.Errorf("Expected an untorn value for key %s, got '%s'", key, value)
+		}
+	}
+
+	t.Run("put get delete entries", func(t *testing.T) {
+		storeRoot, err := os.MkdirTemp("", "persistent_store_test")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(storeRoot)
+
+		store := NewPersistentStore(storeRoot)
+		keys := []string{"a", "b", "c"}
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				value := strings.Repeat(strconv.Itoa(g), 512+g)
+				for i := 0; i < iterations; i++ {
+					key := keys[i%len(keys)]
+					switch (g + i) % 4 {
+					case 0:
+						if err := store.Put(key, value); err != nil {
+							t.Errorf("Expected no error, got %v", err)
+						}
+					case 1:
+						got, err := store.Get(key)
+						if err != nil && !errors.Is(err, ErrKeyNotFound) {
+							t.Errorf("Expected no error or ErrKeyNotFound, got %v", err)
+						}
+						checkValue(t, key, got)
+					case 2:
+						if err := store.Delete(key); err != nil {
+							t.Errorf("Expected no error, got %v", err)
+						}
+					case 3:
+						entries, err := store.Entries()
+						if err != nil {
+							t.Errorf("Expected no error, got %v", err)
+						}
+						for _, e := range entries {
+							checkValue(t, e.Key, e.Value)
+						}
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		if len(store.keyLocks) != 0 {
+			t.Fatalf("Expected all lock entries to be released, got %d", len(store.keyLocks))
+		}
+	})
+
+	t.Run("increments with concurrent deletes of other keys", func(t *testing.T) {
+		storeRoot, err := os.MkdirTemp("", "persistent_store_test")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(storeRoot)
+
+		store := NewPersistentStore(storeRoot)
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					if _, err := store.Increment("counter", 1); err != nil {
+						t.Errorf("Expected no error, got %v", err)
+					}
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					store.Put("other", "x")
+					store.Delete("other")
+					store.Entries()
+				}
+			}()
+		}
+		wg.Wait()
+
+		value, err := store.Get("counter")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if want := strconv.Itoa(goroutines * iterations); value != want {
+			t.Fatalf("Expected '%s', got '%s'", want, value)
+		}
+		if len(store.keyLocks) != 0 {
+			t.Fatalf("Expected all lock entries to be released, got %d", len(store.keyLocks))
+		}
+	})
+
+	t.Run("updates stay exclusive across deletes", func(t *testing.T) {
+		storeRoot, err := os.MkdirTemp("", "persistent_store_test")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(storeRoot)
+
+		store := NewPersistentStore(storeRoot)
+
+		// Deleting a key must not hand out a second lock for it while
+		// others still hold or wait for the first one.
+		var inside atomic.Int32
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					if g%2 == 0 && i%4 == 0 {
+						store.Delete("key")
+						continue
+					}
+					_, err := store.Update("key", func(value string, exists bool) (string, error) {
+						if n := inside.Add(1); n != 1 {
+							t.Errorf("Expected exclusive access to the key, got %d holders", n)
+						}
+						runtime.Gosched()
+						inside.Add(-1)
+						return value + "x", nil
+					})
+					if err != nil {
+						t.Errorf("Expected no error, got %v", err)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		if len(store.keyLocks) != 0 {
+			t.Fatalf("Expected all lock entries to be released, got %d", len(store.keyLocks))
+		}
+	})
+}
+
+// newFilteredStore creates a PersistentStore at storeRoot filtering its keys.
+func newFilteredStore(t *testing.T, storeRoot string) *PersistentStore {
+	t.Helper()
+	store := NewPersistentStore(storeRoot)
+	if err := store.FilterKeys(0.01); err != nil {
+		t.Fatalf("Failed to filter keys: %v", err)
+	}
+	return store
+}
+
+func TestPersistentStoreKeyFilter(t *testing.T) {
+	t.Run("missing keys don't read the disk", func(t *testing.T) {
+		store := newFilteredStore(t, t.TempDir())
+		store.Put("a", "1")
+
+		if value, err := store.Get("a"); err != nil || value != "1" {
+			t.Fatalf("Expected '1', got '%s', %v", value, err)
+		}
+		if _, err := store.Get("missing"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+		}
+		filter := store.Stats()["filter"].(map[string]any)
+		if filter["keys"] != 1 || filter["avoided_reads"] != int64(1) {
+			t.Fatalf("Expected 1 key and 1 avoided read, got %v", filter)
+		}
+	})
+
+	t.Run("keys on disk are filtered after a restart", func(t *testing.T) {
+		storeRoot := t.TempDir()
+		store := NewPersistentStore(storeRoot)
+		for i := 0; i < 100; i++ {
+			store.Put(strconv.Itoa(i), "v")
+		}
+
+		restarted := newFilteredStore(t, storeRoot)
+		for i := 0; i < 100; i++ {
+			if _, err := restarted.Get(strconv.Itoa(i)); err != nil {
+				t.Fatalf("Expected no error for %d, got %v", i, err)
+			}
+		}
+	})
+
+	t.Run("deleted keys are removed", func(t *testing.T) {
+		store := newFilteredStore(t, t.TempDir())
+		store.Put("a", "1")
+		store.Delete("a")
+		store.Delete("never written")
+
+		if store.filter.len() != 0 {
+			t.Fatalf("Expected no keys in the filter, got %d", store.filter.len())
+		}
+		if _, err := store.Get("a"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+		}
+	})
+
+	t.Run("keys are added once however they are written", func(t *testing.T) {
+		store := newFilteredStore(t, t.TempDir())
+		for i := 0; i < 3; i++ {
+			store.Put("put", "v")
+			store.Append("append", "v")
+			store.SetRange("setrange", 1, "v")
+			store.Increment("increment", 1)
+			store.Update("update", func(string, bool) (string, error) { return "v", nil })
+		}
+
+		if store.filter.len() != 5 {
+			t.Fatalf("Expected 5 keys in the filter, got %d", store.filter.len())
+		}
+		for _, key := range []string{"put", "append", "setrange", "increment", "update"} {
+			if _, err := store.Get(key); err != nil {
+				t.Fatalf("Expected no error for %s, got %v", key, err)
+			}
+		}
+	})
+
+	t.Run("entries include files added by other means", func(t *testing.T) {
+		storeRoot := t.TempDir()
+		store := newFilteredStore(t, storeRoot)
+		os.WriteFile(storeRoot+"/outside", []byte("v"), fileMode)
+
+		entries, err := store.Entries()
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("Expected 1 entry, got %v, %v", entries, err)
+		}
+	})
+
+	t.Run("drop empties the filter", func(t *testing.T) {
+		store := newFilteredStore(t, t.TempDir())
+		store.Put("a", "1")
+		store.Drop()
+
+		if store.filter.len() != 0 {
+			t.Fatalf("Expected no keys in the filter, got %d", store.filter.len())
+		}
+	})
+
+	t.Run("unreadable roots are reported", func(t *testing.T) {
+		// A file in place of the root makes listing the keys fail
+		storeRoot := t.TempDir() + "/file"
+		os.WriteFile(storeRoot, []byte("v"), fileMode)
+
+		store := NewPersistentStore(storeRoot)
+		if err := store.FilterKeys(0.01); err == nil {
+			t.Fatal("Expected an error")
+		}
+		if store.filter != nil {
+			t.Fatal("Expected keys not to be filtered")
+		}
+	})
+
+	t.Run("stores without a filter report no filter", func(t *testing.T) {
+		if _, ok := NewPersistentStore(t.TempDir()).Stats()["filter"]; ok {
+			t.Fatalf("Expected no filter statistics")
+		}
+	})
+
+	t.Run("concurrent writes and deletes keep every key on disk", func(t *testing.T) {
+		storeRoot := t.TempDir()
+		store := newFilteredStore(t, storeRoot)
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					key := strconv.Itoa((g*7 + i) % 20)
+					switch i % 3 {
+					case 0:
+						store.Put(key, "v")
+					case 1:
+						store.Delete(key)
+					default:
+						store.Increment(key+"-counter", 1)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		files, _ := os.ReadDir(storeRoot)
+		for _, file := range files {
+			if !store.filter.contains(file.Name()) {
+				t.Fatalf("Expected %s to be in the filter", file.Name())
+			}
+		}
+		if store.filter.len() != len(files) {
+			t.Fatalf("Expected %d keys in the filter, got %d", len(files), store.filter.len())
+		}
+		// Counters are never deleted, so every increment is counted
+		total := 0
+		for i := 0; i < 20; i++ {
+			if value, err := store.Get(strconv.Itoa(i) + "-counter"); err == nil {
+				n, _ := strconv.Atoi(value)
+				total += n
+			}
+		}
+		if total != 8*66 {
+			t.Fatalf("Expected %d increments, got %d", 8*66, total)
+		}
+	})
+}
@@ -0,0 +1,421 @@
+package kv_store
+
+import (
+	"hash/maphash"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limits bounds the keys and values a QuotaStore accepts. A zero field means no limit.
+type Limits struct {
+	// MaxKeyLength is the maximum length of a key, in bytes.
+	MaxKeyLength int
+
+	// MaxValueSize is the maximum size of a value, in bytes.
+	MaxValueSize int64
+
+	// MaxKeys is the maximum number of keys in the store.
+	MaxKeys int
+
+	// MaxTotalBytes is the maximum total size of all keys and values in the store.
+	MaxTotalBytes int64
+}
+
+// quotaLockStripes is the number of locks the writes of a QuotaStore are
+// spread over by key.
+const quotaLockStripes = 256
+
+// QuotaStore wraps a KeyValueStore and rejects writes that exceed its limits.
+// The size of every key and value is tracked incrementally, so checking a write
+// doesn't need to scan the backend.
+//
+// A write reserves the room it may take under mu, and mu is released while the
+// backend applies it: the reservation is then replaced by the actual size of
+// the value, or cancelled if the backend fails. Writes of the same key are
+// serialized by the lock of its stripe, so that they are accounted for in the
+// order the backend applies them.
+//
+// Keys written with a time to live are counted until they expire. Expired keys
+// are only uncounted when a write would otherwise exceed the quotas, or when the
+// usage is read, as finding them takes a scan of the keys with a time to live.
+type QuotaStore struct {
+	backend  KeyValueStore
+	limits   Limits
+	sizes    map[string]int64
+	expiries map[string]time.Time // Expiry of the counted keys with a time to live
+	total    int64
+	reserved int64 // Bytes reserved by writes in progress
+	adding   int   // Keys being created by writes in progress
+	keyLocks [quotaLockStripes]sync.Mutex
+	seed     maphash.Seed
+	mu       sync.Mutex
+}
+
+// reservation is the room reserved by a write of key in progress.
+type reservation struct {
+	key   string
+	bytes int64
+	adds  bool
+}
+
+// NewQuotaStore creates a QuotaStore enforcing limits on backend. The sizes of
+// the backend's existing entries are counted towards the quotas, even if they
+// exceed them.
+func NewQuotaStore(backend KeyValueStore, limits Limits) (*QuotaStore, error) {
+	q := &QuotaStore{
+		backend:  backend,
+		limits:   limits,
+		sizes:    make(map[string]int64),
+		expiries: make(map[string]time.Time),
+		seed:     maphash.MakeSeed(),
+		mu:       sync.Mutex{},
+	}
+
+	entries, err := backend.Entries()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		q.setSize(e.Key, len(e.Value))
+	}
+
+	return q, nil
+}
+
+// Limits returns the limits enforced by the store.
+func (q *QuotaStore) Limits() Limits {
+	return q.limits
+}
+
+// Usage returns the number of keys and the total size of keys and values in
+// the store, not counting the writes in progress.
+func (q *QuotaStore) Usage() (int, int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.expire()
+	return len(q.sizes), q.total
+}
+
+// lock locks the stripe of key and returns the function unlocking it.
+func (q *QuotaStore) lock(key string) func() {
+	mu := &q.keyLocks[maphash.String(q.seed, key)%quotaLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// reserve reserves the room to set key to a value of the length returned by
+// length, which is given the current length of the value of key, or returns
+// an error if it would exceed the limits. The caller must hold the lock of key.
+func (q *QuotaStore) reserve(key string, length func(current int) int) (reservation, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.expired(key, time.Now()) {
+		q.removeSize(key)
+	}
+	n := length(q.valueLength(key))
+	if q.limits.MaxKeyLength > 0 && len(key) > q.limits.MaxKeyLength {
+		return reservation{}, ErrKeyTooLong
+	}
+	if q.limits.MaxValueSize > 0 && int64(n) > q.limits.MaxValueSize {
+		return reservation{}, ErrValueTooLarge
+	}
+
+	old, exists := q.sizes[key]
+	grow := max(int64(len(key)+n)-old, 0)
+	if q.exceeds(grow, !exists) {
+		// Uncount the expired keys before giving up
+		q.expire()
+		if q.exceeds(grow, !exists) {
+			return reservation{}, ErrQuotaExceeded
+		}
+	}
+
+	r := reservation{key: key, bytes: grow, adds: !exists}
+	q.reserved += r.bytes
+	if r.adds {
+		q.adding++
+	}
+	return r, nil
+}
+
+// exceeds reports whether growing the store by grow bytes, and by a key if adds
+// is set, would exceed the quotas. The caller must hold mu.
+func (q *QuotaStore) exceeds(grow int64, adds bool) bool {
+	if q.limits.MaxKeys > 0 && adds && len(q.sizes)+q.adding >= q.limits.MaxKeys {
+		return true
+	}
+	return q.limits.MaxTotalBytes > 0 && q.total+q.reserved+grow > q.limits.MaxTotalBytes
+}
+
+// cancel releases the room reserved by r. The caller must hold mu.
+func (q *QuotaStore) cancel(r reservation) {
+	q.reserved -= r.bytes
+	if r.adds {
+		q.adding--
+	}
+}
+
+// rollback releases the room reserved by a write that failed.
+func (q *QuotaStore) rollback(r reservation) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.cancel(r)
+}
+
+// commit replaces the room reserved by r with the value of length bytes written.
+func (q *QuotaStore) commit(r reservation, length int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.cancel(r)
+	q.setSize(r.key, length)
+}
+
+// commitPut replaces the room reserved by r with the value of length bytes
+// put, which expires at expiry, or never if expiry is zero.
+func (q *QuotaStore) commitPut(r reservation, length int, expiry time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.cancel(r)
+	q.setSize(r.key, length)
+	if expiry.IsZero() {
+		delete(q.expiries, r.key)
+	} else {
+		q.expiries[r.key] = expiry
+	}
+}
+
+// setSize records that key holds a value of length bytes. A time to live that
+// has passed belongs to a previous value of key, which expired before the
+// write. The caller must hold mu.
+func (q *QuotaStore) setSize(key string, length int) {
+	if q.expired(key, time.Now()) {
+		delete(q.expiries, key)
+	}
+	size := int64(len(key) + length)
+	q.total += size - q.sizes[key]
+	q.sizes[key] = size
+}
+
+// removeSize records that key doesn't exist. The caller must hold mu.
+func (q *QuotaStore) removeSize(key string) {
+	q.total -= q.sizes[key]
+	delete(q.sizes, key)
+	delete(q.expiries, key)
+}
+
+// expired reports whether key has a time to live that has passed at now.
+// The caller must hold mu.
+func (q *QuotaStore) expired(key string, now time.Time) bool {
+	expiry, ok := q.expiries[key]
+	return ok && !now.Before(expiry)
+}
+
+// expire uncounts the keys whose time to live has passed. The caller must hold mu.
+func (q *QuotaStore) expire() {
+	now := time.Now()
+	for key := range q.expiries {
+		if q.expired(key, now) {
+			q.removeSize(key)
+		}
+	}
+}
+
+// valueLength returns the length of the value held by key, or 0 if it doesn't exist.
+// The caller must hold mu.
+func (q *QuotaStore) valueLength(key string) int {
+	size, ok := q.sizes[key]
+	if !ok {
+		return 0
+	}
+	return int(size) - len(key)
+}
+
+// fixedLength returns a function returning n, for reservations of values of a known length.
+func fixedLength(n int) func(int) int {
+	return func(int) int {
+		return n
+	}
+}
+
+func (q *QuotaStore) Put(key string, value string) error {
+	unlock := q.lock(key)
+	defer unlock()
+
+	r, err := q.reserve(key, fixedLength(len(value)))
+	if err != nil {
+		return err
+	}
+	if err := q.backend.Put(key, value); err != nil {
+		q.rollback(r)
+		return err
+	}
+	q.commitPut(r, len(value), time.Time{})
+	return nil
+}
+
+// PutWithTTL stores the given value associated with the given key, which
+// expires after ttl. Returns ErrTTLUnsupported if the backend doesn't support
+// expiring keys.
+func (q *QuotaStore) PutWithTTL(key string, value string, ttl time.Duration) error {
+	ts, ok := q.backend.(TTLStore)
+	if !ok {
+		return ErrTTLUnsupported
+	}
+
+	unlock := q.lock(key)
+	defer unlock()
+
+	r, err := q.reserve(key, fixedLength(len(value)))
+	if err != nil {
+		return err
+	}
+	if err := ts.PutWithTTL(key, value, ttl); err != nil {
+		q.rollback(r)
+		return err
+	}
+	// Counted from after the write, so that the key has expired in the backend
+	// by the time it is uncounted
+	q.commitPut(r, len(value), time.Now().Add(ttl))
+	return nil
+}
+
+func (q *QuotaStore) Get(key string) (string, error) {
+	return q.backend.Get(key)
+}
+
+func (q *QuotaStore) Delete(key string) error {
+	unlock := q.lock(key)
+	defer unlock()
+
+	if err := q.backend.Delete(key); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.removeSize(key)
+	return nil
+}
+
+func (q *QuotaStore) Entries() ([]Entry, error) {
+	return q.backend.Entries()
+}
+
+func (q *QuotaStore) Increment(key string, delta int64) (int64, error) {
+	var n int64
+	_, err := q.Update(key, func(value string, exists bool) (string, error) {
+		var err error
+		n, err = addInt(value, exists, delta)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(n, 10), nil
+	})
+	return n, err
+}
+
+func (q *QuotaStore) Decrement(key string, delta int64) (int64, error) {
+	return decrement(q, key, delta)
+}
+
+func (q *QuotaStore) Append(key string, suffix string) (int, error) {
+	unlock := q.lock(key)
+	defer unlock()
+
+	r, err := q.reserve(key, func(current int) int {
+		return current + len(suffix)
+	})
+	if err != nil {
+		return 0, err
+	}
+	n, err := q.backend.Append(key, suffix)
+	if err != nil {
+		q.rollback(r)
+		return 0, err
+	}
+	q.commit(r, n)
+	return n, nil
+}
+
+func (q *QuotaStore) SetRange(key string, offset int64, data string) (int, error) {
+	if err := checkRange(offset, len(data)); err != nil {
+		return 0, err
+	}
+	if data == "" {
+		// Nothing is written
+		return q.backend.SetRange(key, offset, data)
+	}
+
+	unlock := q.lock(key)
+	defer unlock()
+
+	r, err := q.reserve(key, func(current int) int {
+		return max(current, int(offset)+len(data))
+	})
+	if err != nil {
+		return 0, err
+	}
+	n, err := q.backend.SetRange(key, offset, data)
+	if err != nil {
+		q.rollback(r)
+		return 0, err
+	}
+	q.commit(r, n)
+	return n, nil
+}
+
+func (q *QuotaStore) Update(key string, fn UpdateFunc) (string, error) {
+	unlock := q.lock(key)
+	defer unlock()
+
+	var r *reservation
+	value, err := q.backend.Update(key, func(value string, exists bool) (string, error) {
+		value, err := fn(value, exists)
+		if err != nil {
+			return "", err
+		}
+		res, err := q.reserve(key, fixedLength(len(value)))
+		if err != nil {
+			return "", err
+		}
+		r = &res
+		return value, nil
+	})
+	if err != nil {
+		if r != nil {
+			q.rollback(*r)
+		}
+		return "", err
+	}
+	q.commit(*r, len(value))
+	return value, nil
+}
+
+// Unwrap returns the backend.
+func (q *QuotaStore) Unwrap() KeyValueStore {
+	return q.backend
+}
+
+// Drop drops the backend, if it holds data outside of memory, and stops
+// counting its keys. Writes in progress still release their reservations.
+func (q *QuotaStore) Drop() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if d, ok := q.backend.(Dropper); ok {
+		if err := d.Drop(); err != nil {
+			return err
+		}
+	}
+	clear(q.sizes)
+	clear(q.expiries)
+	q.total = 0
+	return nil
+}
@@ -0,0 +1,223 @@
+package kv_store
+
+// sizedCollectionStore is a CollectionStore reporting the size of its values,
+// which a QuotaStore needs to count collections after they are written.
+type sizedCollectionStore interface {
+	CollectionStore
+
+	// valueSize returns the number of bytes held by the value of key, and whether key exists.
+	valueSize(key string) (int, bool)
+}
+
+// collections returns the backend as a sizedCollectionStore, or
+// ErrCollectionsUnsupported if it doesn't support collections.
+func (q *QuotaStore) collections() (sizedCollectionStore, error) {
+	cs, ok := q.backend.(sizedCollectionStore)
+	if !ok {
+		return nil, ErrCollectionsUnsupported
+	}
+	return cs, nil
+}
+
+// grow applies write, which grows the collection held by key by at most growth
+// bytes, after reserving the room for it. The collection is then counted at
+// the size reported by the backend.
+func (q *QuotaStore) grow(key string, growth int, write func(cs sizedCollectionStore) error) error {
+	cs, err := q.collections()
+	if err != nil {
+		return err
+	}
+
+	unlock := q.lock(key)
+	defer unlock()
+
+	r, err := q.reserve(key, func(current int) int {
+		return current + growth
+	})
+	if err != nil {
+		return err
+	}
+	if err := write(cs); err != nil {
+		q.rollback(r)
+		return err
+	}
+
+	length, exists := cs.valueSize(key)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.cancel(r)
+	q.recount(key, length, exists)
+	return nil
+}
+
+// shrink applies write, which removes elements from the collection held by
+// key, and counts the collection at the size reported by the backend. Nothing
+// is reserved, as removals are never rejected.
+func (q *QuotaStore) shrink(key string, write func(cs sizedCollectionStore) error) error {
+	cs, err := q.collections()
+	if err != nil {
+		return err
+	}
+
+	unlock := q.lock(key)
+	defer unlock()
+
+	if err := write(cs); err != nil {
+		return err
+	}
+
+	length, exists := cs.valueSize(key)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.recount(key, length, exists)
+	return nil
+}
+
+// recount records the size of the value of key reported by the backend, or
+// that key doesn't exist, e.g. because its collection became empty. The caller
+// must hold mu.
+func (q *QuotaStore) recount(key string, length int, exists bool) {
+	if exists {
+		q.setSize(key, length)
+	} else {
+		q.removeSize(key)
+	}
+}
+
+// Type returns the type of the value held by the given key. Without collection
+// support in the backend, keys can only hold strings.
+func (q *QuotaStore) Type(key string) KeyType {
+	if cs, err := q.collections(); err == nil {
+		return cs.Type(key)
+	}
+	if _, err := q.backend.Get(key); err != nil {
+		return TypeNone
+	}
+	return TypeString
+}
+
+func (q *QuotaStore) LPush(key string, values ...string) (n int, err error) {
+	err = q.grow(key, byteLen(values), func(cs sizedCollectionStore) error {
+		n, err = cs.LPush(key, values...)
+		return err
+	})
+	return n, err
+}
+
+func (q *QuotaStore) RPush(key string, values ...string) (n int, err error) {
+	err = q.grow(key, byteLen(values), func(cs sizedCollectionStore) error {
+		n, err = cs.RPush(key, values...)
+		return err
+	})
+	return n, err
+}
+
+func (q *QuotaStore) LPop(key string) (value string, err error) {
+	err = q.shrink(key, func(cs sizedCollectionStore) error {
+		value, err = cs.LPop(key)
+		return err
+	})
+	return value, err
+}
+
+func (q *QuotaStore) RPop(key string) (value string, err error) {
+	err = q.shrink(key, func(cs sizedCollectionStore) error {
+		value, err = cs.RPop(key)
+		return err
+	})
+	return value, err
+}
+
+func (q *QuotaStore) LRange(key string, start, stop int) ([]string, error) {
+	cs, err := q.collections()
+	if err != nil {
+		return nil, err
+	}
+	return cs.LRange(key, start, stop)
+}
+
+func (q *QuotaStore) SAdd(key string, members ...string) (n int, err error) {
+	err = q.grow(key, byteLen(members), func(cs sizedCollectionStore) error {
+		n, err = cs.SAdd(key, members...)
+		return err
+	})
+	return n, err
+}
+
+func (q *QuotaStore) SRem(key string, members ...string) (n int, err error) {
+	err = q.shrink(key, func(cs sizedCollectionStore) error {
+		n, err = cs.SRem(key, members...)
+		return err
+	})
+	return n, err
+}
+
+func (q *QuotaStore) SMembers(key string) ([]string, error) {
+	cs, err := q.collections()
+	if err != nil {
+		return nil, err
+	}
+	return cs.SMembers(key)
+}
+
+func (q *QuotaStore) HSet(key string, field string, value string) (created bool, err error) {
+	err = q.grow(key, len(field)+len(value), func(cs sizedCollectionStore) error {
+		created, err = cs.HSet(key, field, value)
+		return err
+	})
+	return created, err
+}
+
+func (q *QuotaStore) HGet(key string, field string) (string, error) {
+	cs, err := q.collections()
+	if err != nil {
+		return "", err
+	}
+	return cs.HGet(key, field)
+}
+
+func (q *QuotaStore) HDel(key string, fields ...string) (n int, err error) {
+	err = q.shrink(key, func(cs sizedCollectionStore) error {
+		n, err = cs.HDel(key, fields...)
+		return err
+	})
+	return n, err
+}
+
+func (q *QuotaStore) HGetAll(key string) (map[string]string, error) {
+	cs, err := q.collections()
+	if err != nil {
+		return nil, err
+	}
+	return cs.HGetAll(key)
+}
+
+func (q *QuotaStore) ZAdd(key string, members map[string]float64) (n int, err error) {
+	growth := 0
+	for m := range members {
+		growth += len(m) + scoreSize
+	}
+	err = q.grow(key, growth, func(cs sizedCollectionStore) error {
+		n, err = cs.ZAdd(key, members)
+		return err
+	})
+	return n, err
+}
+
+func (q *QuotaStore) ZRem(key string, members ...string) (n int, err error) {
+	err = q.shrink(key, func(cs sizedCollectionStore) error {
+		n, err = cs.ZRem(key, members...)
+		return err
+	})
+	return n, err
+}
+
+func (q *QuotaStore) ZRange(key string, start, stop int) ([]ScoredMember, error) {
+	cs, err := q.collections()
+	if err != nil {
+		return nil, err
+	}
+	return cs.ZRange(key, start, stop)
+}
@@ -0,0 +1,304 @@
+package kv_store
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestQuotaStore(t *testing.T, limits Limits) *QuotaStore {
+	store, err := NewQuotaStore(NewInMemoryStore(), limits)
+	if err != nil {
+		t.Fatalf("Failed to create quota store: %v", err)
+	}
+	return store
+}
+
+func TestQuotaStoreLimits(t *testing.T) {
+	t.Run("key length", func(t *testing.T) {
+		store := newTestQuotaStore(t, Limits{MaxKeyLength: 3})
+
+		if err := store.Put("abc", "value"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := store.Put("abcd", "value"); !errors.Is(err, ErrKeyTooLong) {
+			t.Fatalf("Expected ErrKeyTooLong, got %v", err)
+		}
+	})
+
+	t.Run("value size", func(t *testing.T) {
+		store := newTestQuotaStore(t, Limits{MaxValueSize: 5})
+
+		if err := store.Put("key", "12345"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := store.Put("key", "123456"); !errors.Is(err, ErrValueTooLarge) {
+			t.Fatalf("Expected ErrValueTooLarge, got %v", err)
+		}
+		if _, err := store.Append("key", "6"); !errors.Is(err, ErrValueTooLarge) {
+			t.Fatalf("Expected ErrValueTooLarge on append, got %v", err)
+		}
+		if _, err := store.SetRange("key", 4, "56"); !errors.Is(err, ErrValueTooLarge) {
+			t.Fatalf("Expected ErrValueTooLarge on set range, got %v", err)
+		}
+		if n, err := store.SetRange("key", 3, "ab"); err != nil || n != 5 {
+			t.Fatalf("Expected length 5, got %d (err: %v)", n, err)
+		}
+
+		value, _ := store.Get("key")
+		if value != "123ab" {
+			t.Fatalf("Expected rejected writes to leave the value unchanged, got %q", value)
+		}
+	})
+
+	t.Run("key count", func(t *testing.T) {
+		store := newTestQuotaStore(t, Limits{MaxKeys: 2})
+
+		store.Put("a", "1")
+		store.Put("b", "2")
+		if err := store.Put("c", "3"); !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+		}
+		if _, err := store.Increment("c", 1); !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("Expected ErrQuotaExceeded on increment, got %v", err)
+		}
+
+		// Existing keys can still be updated, and deleting frees a slot
+		if err := store.Put("a", "updated"); err != nil {
+			t.Fatalf("Expected no error updating an existing key, got %v", err)
+		}
+		store.Delete("b")
+		if err := store.Put("c", "3"); err != nil {
+			t.Fatalf("Expected no error after delete, got %v", err)
+		}
+	})
+
+	t.Run("total bytes", func(t *testing.T) {
+		store := newTestQuotaStore(t, Limits{MaxTotalBytes: 10})
+
+		// "key" + "value" is 8 bytes
+		store.Put("key", "value")
+		if err := store.Put("k2", "v"); !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+		}
+		if _, err := store.Update("key", func(string, bool) (string, error) {
+			return "longvalue", nil
+		}); !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("Expected ErrQuotaExceeded on update, got %v", err)
+		}
+
+		// Shrinking a value frees space
+		store.Put("key", "v")
+		if err := store.Put("k2", "v"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		keys, total := store.Usage()
+		if keys != 2 || total != 7 {
+			t.Fatalf("Expected 2 keys and 7 bytes, got %d keys and %d bytes", keys, total)
+		}
+	})
+}
+
+func TestQuotaStoreTracksExistingEntries(t *testing.T) {
+	storeRoot, err := os.MkdirTemp("", "quota_store_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(storeRoot)
+
+	backend := NewPersistentStore(storeRoot)
+	backend.Put("key1", strings.Repeat("x", 10))
+	backend.Put("key2", "value")
+
+	store, err := NewQuotaStore(backend, Limits{MaxTotalBytes: 30})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	keys, total := store.Usage()
+	if keys != 2 || total != 23 {
+		t.Fatalf("Expected 2 keys and 23 bytes, got %d keys and %d bytes", keys, total)
+	}
+	if err := store.Put("key3", "toolong"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+	}
+}
+
+// blockingStore is an in-memory store whose writes of key block until release is closed.
+type blockingStore struct {
+	*InMemoryStore
+	key     string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingStore) Put(key string, value string) error {
+	if key == b.key {
+		close(b.started)
+		<-b.release
+	}
+	return b.InMemoryStore.Put(key, value)
+}
+
+func TestQuotaStoreConcurrentWrites(t *testing.T) {
+	t.Run("slow writes don't block other keys", func(t *testing.T) {
+		backend := &blockingStore{
+			InMemoryStore: NewInMemoryStore(),
+			key:           "slow",
+			started:       make(chan struct{}),
+			release:       make(chan struct{}),
+		}
+		store, _ := NewQuotaStore(backend, Limits{MaxKeys: 2})
+
+		done := make(chan error)
+		go func() {
+			done <- store.Put("slow", "value")
+		}()
+		<-backend.started
+
+		if err := store.Put("fast", "value"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		// The slow write holds the last key slot until it completes
+		if err := store.Put("other", "value"); !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+		}
+
+		close(backend.release)
+		if err := <-done; err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if keys, _ := store.Usage(); keys != 2 {
+			t.Fatalf("Expected 2 keys, got %d", keys)
+		}
+	})
+
+	t.Run("failed writes release their reservation", func(t *testing.T) {
+		root := t.TempDir()
+		store, _ := NewQuotaStore(NewPersistentStore(root), Limits{MaxKeys: 1, MaxTotalBytes: 10})
+
+		// A directory in place of the key file makes the write fail
+		if err := os.Mkdir(root+"/key", 0777); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := store.Put("key", "value"); err == nil {
+			t.Fatal("Expected the write to fail")
+		}
+		if _, err := store.Append("key", "value"); err == nil {
+			t.Fatal("Expected the append to fail")
+		}
+
+		if err := store.Put("other", "value"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if keys, total := store.Usage(); keys != 1 || total != 10 {
+			t.Fatalf("Expected 1 key and 10 bytes, got %d keys and %d bytes", keys, total)
+		}
+	})
+}
+
+func TestQuotaStoreCollections(t *testing.T) {
+	t.Run("collection writes are counted", func(t *testing.T) {
+		store := newTestQuotaStore(t, Limits{MaxTotalBytes: 10})
+
+		// "list" + "ab" + "cd" is 8 bytes
+		if _, err := store.RPush("list", "ab", "cd"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := store.RPush("list", "efg"); !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+		}
+		if _, err := store.HSet("h", "f", "v"); !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+		}
+		if keys, total := store.Usage(); keys != 1 || total != 8 {
+			t.Fatalf("Expected 1 key and 8 bytes, got %d keys and %d bytes", keys, total)
+		}
+	})
+
+	t.Run("removals free space", func(t *testing.T) {
+		store := newTestQuotaStore(t, Limits{MaxKeys: 1})
+
+		store.SAdd("set", "a", "b")
+		if _, err := store.SRem("set", "a"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if keys, total := store.Usage(); keys != 1 || total != 4 {
+			t.Fatalf("Expected 1 key and 4 bytes, got %d keys and %d bytes", keys, total)
+		}
+
+		// The set is removed once empty
+		store.SRem("set", "b")
+		if _, err := store.ZAdd("zset", map[string]float64{"a": 1}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("backends without collections", func(t *testing.T) {
+		store, _ := NewQuotaStore(NewPersistentStore(t.TempDir()), Limits{})
+
+		if _, err := store.LPush("list", "a"); !errors.Is(err, ErrCollectionsUnsupported) {
+			t.Fatalf("Expected ErrCollectionsUnsupported, got %v", err)
+		}
+		store.Put("key", "value")
+		if typ := store.Type("key"); typ != TypeString {
+			t.Fatalf("Expected type string, got %s", typ)
+		}
+	})
+}
+
+func TestQuotaStoreTTL(t *testing.T) {
+	t.Run("expired keys are uncounted", func(t *testing.T) {
+		store := newTestQuotaStore(t, Limits{MaxKeys: 1})
+
+		if err := store.PutWithTTL("key", "value", 10*time.Millisecond); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := store.Put("other", "value"); !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		if err := store.Put("other", "value"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if keys, total := store.Usage(); keys != 1 || total != 10 {
+			t.Fatalf("Expected 1 key and 10 bytes, got %d keys and %d bytes", keys, total)
+		}
+	})
+
+	t.Run("put clears the time to live", func(t *testing.T) {
+		store := newTestQuotaStore(t, Limits{})
+
+		store.PutWithTTL("key", "value", 10*time.Millisecond)
+		store.Put("key", "value")
+
+		time.Sleep(20 * time.Millisecond)
+		if keys, _ := store.Usage(); keys != 1 {
+			t.Fatalf("Expected 1 key, got %d", keys)
+		}
+	})
+
+	t.Run("backends without expiring keys", func(t *testing.T) {
+		store, _ := NewQuotaStore(NewPersistentStore(t.TempDir()), Limits{})
+
+		if err := store.PutWithTTL("key", "value", time.Minute); !errors.Is(err, ErrTTLUnsupported) {
+			t.Fatalf("Expected ErrTTLUnsupported, got %v", err)
+		}
+	})
+}
+
+func TestQuotaStoreDrop(t *testing.T) {
+	store, _ := NewQuotaStore(NewPersistentStore(t.TempDir()), Limits{MaxKeys: 1})
+	store.Put("key", "value")
+
+	if err := store.Drop(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if keys, total := store.Usage(); keys != 0 || total != 0 {
+		t.Fatalf("Expected no keys and 0 bytes, got %d keys and %d bytes", keys, total)
+	}
+}
@@ -0,0 +1,200 @@
+package kv_store
+
+import (
+	"fmt"
+	"hash/maphash"
+	"time"
+)
+
+// ShardedInMemoryStore spreads keys over several InMemoryStore shards by key
+// hash, so that writes to different shards don't contend for the same lock.
+type ShardedInMemoryStore struct {
+	shards []*InMemoryStore
+	mask   uint64
+	seed   maphash.Seed
+}
+
+// NewShardedInMemoryStore creates a store with the given number of shards,
+// which must be a power of two.
+func NewShardedInMemoryStore(shards int) (*ShardedInMemoryStore, error) {
+	return newShardedInMemoryStore(shards, func() (*InMemoryStore, error) {
+		return NewInMemoryStore(), nil
+	})
+}
+
+// NewBoundedShardedInMemoryStore creates a store with the given number of
+// shards, which must be a power of two, and splits the memory budget evenly
+// between them. Each shard evicts its own keys according to policy.
+func NewBoundedShardedInMemoryStore(shards int, maxBytes int64, policy EvictionPolicy) (*ShardedInMemoryStore, error) {
+	if maxBytes < int64(shards) {
+		return nil, fmt.Errorf("memory budget of %d bytes is too small for %d shards", maxBytes, shards)
+	}
+	return newShardedInMemoryStore(shards, func() (*InMemoryStore, error) {
+		return NewBoundedInMemoryStore(maxBytes/int64(shards), policy)
+	})
+}
+
+func newShardedInMemoryStore(shards int, newShard func() (*InMemoryStore, error)) (*ShardedInMemoryStore, error) {
+	if shards <= 0 || shards&(shards-1) != 0 {
+		return nil, fmt.Errorf("shard count %d is not a power of two", shards)
+	}
+
+	s := &ShardedInMemoryStore{
+		shards: make([]*InMemoryStore, shards),
+		mask:   uint64(shards - 1),
+		seed:   maphash.MakeSeed(),
+	}
+	for j := range s.shards {
+		shard, err := newShard()
+		if err != nil {
+			return nil, err
+		}
+		s.shards[j] = shard
+	}
+	return s, nil
+}
+
+// shard returns the shard holding key.
+func (s *ShardedInMemoryStore) shard(key string) *InMemoryStore {
+	return s.shards[maphash.String(s.seed, key)&s.mask]
+}
+
+func (s *ShardedInMemoryStore) Put(key string, value string) error {
+	return s.shard(key).Put(key, value)
+}
+
+func (s *ShardedInMemoryStore) PutWithTTL(key string, value string, ttl time.Duration) error {
+	return s.shard(key).PutWithTTL(key, value, ttl)
+}
+
+func (s *ShardedInMemoryStore) Get(key string) (string, error) {
+	return s.shard(key).Get(key)
+}
+
+func (s *ShardedInMemoryStore) Delete(key string) error {
+	return s.shard(key).Delete(key)
+}
+
+// Entries returns a consistent view of all shards: every shard is read-locked,
+// in order, before any of them is read, so no write is seen partially.
+func (s *ShardedInMemoryStore) Entries() ([]Entry, error) {
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+	}
+	defer func() {
+		for _, shard := range s.shards {
+			shard.mu.RUnlock()
+		}
+	}()
+
+	n := 0
+	for _, shard := range s.shards {
+		n += len(shard.mapStore)
+	}
+	entries := make([]Entry, 0, n)
+	for _, shard := range s.shards {
+		entries = shard.appendEntries(entries)
+	}
+	return entries, nil
+}
+
+func (s *ShardedInMemoryStore) Increment(key string, delta int64) (int64, error) {
+	return s.shard(key).Increment(key, delta)
+}
+
+func (s *ShardedInMemoryStore) Decrement(key string, delta int64) (int64, error) {
+	return s.shard(key).Decrement(key, delta)
+}
+
+func (s *ShardedInMemoryStore) Append(key string, suffix string) (int, error) {
+	return s.shard(key).Append(key, suffix)
+}
+
+func (s *ShardedInMemoryStore) SetRange(key string, offset int64, data string) (int, error) {
+	return s.shard(key).SetRange(key, offset, data)
+}
+
+func (s *ShardedInMemoryStore) Update(key string, fn UpdateFunc) (string, error) {
+	return s.shard(key).Update(key, fn)
+}
+
+// valueSize returns the number of bytes held by the value of key, and whether key exists.
+func (s *ShardedInMemoryStore) valueSize(key string) (int, bool) {
+	return s.shard(key).valueSize(key)
+}
+
+func (s *ShardedInMemoryStore) Type(key string) KeyType {
+	return s.shard(key).Type(key)
+}
+
+func (s *ShardedInMemoryStore) LPush(key string, values ...string) (int, error) {
+	return s.shard(key).LPush(key, values...)
+}
+
+func (s *ShardedInMemoryStore) RPush(key string, values ...string) (int, error) {
+	return s.shard(key).RPush(key, values...)
+}
+
+func (s *ShardedInMemoryStore) LPop(key string) (string, error) {
+	return s.shard(key).LPop(key)
+}
+
+func (s *ShardedInMemoryStore) RPop(key string) (string, error) {
+	return s.shard(key).RPop(key)
+}
+
+func (s *ShardedInMemoryStore) LRange(key string, start, stop int) ([]string, error) {
+	return s.shard(key).LRange(key, start, stop)
+}
+
+func (s *ShardedInMemoryStore) SAdd(key string, members ...string) (int, error) {
+	return s.shard(key).SAdd(key, members...)
+}
+
+func (s *ShardedInMemoryStore) SRem(key string, members ...string) (int, error) {
+	return s.shard(key).SRem(key, members...)
+}
+
+func (s *ShardedInMemoryStore) SMembers(key string) ([]string, error) {
+	return s.shard(key).SMembers(key)
+}
+
+func (s *ShardedInMemoryStore) HSet(key string, field string, value string) (bool, error) {
+	return s.shard(key).HSet(key, field, value)
+}
+
+func (s *ShardedInMemoryStore) HGet(key string, field string) (string, error) {
+	return s.shard(key).HGet(key, field)
+}
+
+func (s *ShardedInMemoryStore) HDel(key string, fields ...string) (int, error) {
+	return s.shard(key).HDel(key, fields...)
+}
+
+func (s *ShardedInMemoryStore) HGetAll(key string) (map[string]string, error) {
+	return s.shard(key).HGetAll(key)
+}
+
+func (s *ShardedInMemoryStore) ZAdd(key string, members map[string]float64) (int, error) {
+	return s.shard(key).ZAdd(key, members)
+}
+
+func (s *ShardedInMemoryStore) ZRem(key string, members ...string) (int, error) {
+	return s.shard(key).ZRem(key, members...)
+}
+
+func (s *ShardedInMemoryStore) ZRange(key string, start, stop int) ([]ScoredMember, error) {
+	return s.shard(key).ZRange(key, start, stop)
+}
+
+// MemoryUsage returns the number of bytes of keys and values held by all
+// shards, and their total budget, which is 0 if the store is unbounded.
+func (s *ShardedInMemoryStore) MemoryUsage() (int64, int64) {
+	var used, maxBytes int64
+	for _, shard := range s.shards {
+		u, m := shard.MemoryUsage()
+		used += u
+		maxBytes += m
+	}
+	return used, maxBytes
+}
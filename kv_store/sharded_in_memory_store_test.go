@@ -0,0 +1,124 @@
+package kv_store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestNewShardedInMemoryStore(t *testing.T) {
+	for _, shards := range []int{0, 3, -4} {
+		if _, err := NewShardedInMemoryStore(shards); err == nil {
+			t.Fatalf("Expected error for %d shards", shards)
+		}
+	}
+
+	store, err := NewShardedInMemoryStore(8)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(store.shards) != 8 {
+		t.Fatalf("Expected 8 shards, got %d", len(store.shards))
+	}
+}
+
+func TestShardedInMemoryStore(t *testing.T) {
+	store, _ := NewShardedInMemoryStore(4)
+
+	t.Run("keys spread over shards", func(t *testing.T) {
+		for j := 0; j < 100; j++ {
+			store.Put(fmt.Sprintf("key-%d", j), "value")
+		}
+
+		for j, shard := range store.shards {
+			if len(shard.mapStore) == 0 {
+				t.Fatalf("Expected shard %d to hold keys", j)
+			}
+		}
+
+		entries, _ := store.Entries()
+		if len(entries) != 100 {
+			t.Fatalf("Expected 100 entries, got %d", len(entries))
+		}
+	})
+
+	t.Run("operations reach the key's shard", func(t *testing.T) {
+		store.Put("counter", "41")
+		if n, err := store.Increment("counter", 1); err != nil || n != 42 {
+			t.Fatalf("Expected 42, got %d (err: %v)", n, err)
+		}
+		if n, _ := store.RPush("list", "a", "b"); n != 2 {
+			t.Fatalf("Expected length 2, got %d", n)
+		}
+		if store.Type("list") != TypeList {
+			t.Fatalf("Expected list type, got %s", store.Type("list"))
+		}
+
+		store.Delete("counter")
+		if _, err := store.Get("counter"); err == nil {
+			t.Fatalf("Expected deleted key to be missing")
+		}
+	})
+
+	t.Run("bounded shards need a budget each", func(t *testing.T) {
+		if _, err := NewBoundedShardedInMemoryStore(8, 4, EvictLRU); err == nil {
+			t.Fatalf("Expected an error for a budget smaller than the shard count")
+		}
+	})
+
+	t.Run("bounded shards split the budget", func(t *testing.T) {
+		bounded, err := NewBoundedShardedInMemoryStore(4, 400, EvictLRU)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for j := 0; j < 1000; j++ {
+			bounded.Put(fmt.Sprintf("key-%03d", j), "value")
+		}
+
+		used, maxBytes := bounded.MemoryUsage()
+		if maxBytes != 400 || used > maxBytes {
+			t.Fatalf("Expected usage within 400 bytes, got %d of %d", used, maxBytes)
+		}
+	})
+}
+
+func TestShardedInMemoryStoreConsistentEntries(t *testing.T) {
+	store, _ := NewShardedInMemoryStore(8)
+
+	// Writers move a single token between keys in different shards; a
+	// consistent view never sees it twice
+	const keys = 16
+	store.Put("token-0", "token")
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; ; j++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			from, to := fmt.Sprintf("token-%d", j%keys), fmt.Sprintf("token-%d", (j+1)%keys)
+			store.Put(to, "token")
+			store.Delete(from)
+		}
+	}()
+
+	for j := 0; j < 200; j++ {
+		entries, _ := store.Entries()
+		if len(entries) > 2 {
+			keys := make([]string, len(entries))
+			for k, e := range entries {
+				keys[k] = e.Key
+			}
+			sort.Strings(keys)
+			t.Fatalf("Expected at most 2 tokens in a consistent view, got %v", keys)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,414 @@
+package kv_store
+
+import (
+	"errors"
+	"hash/maphash"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TieredStore keeps hot keys in an in-memory tier and cold keys in a disk tier
+// backed by a PersistentStore. Writes only update the memory tier. When it holds
+// more than its capacity, the least frequently used keys are demoted to disk,
+// with access counts aged so that keys that are no longer used are demoted too;
+// reading a key from disk promotes it back to memory.
+//
+// Keys written since they were last on disk are dirty, and only held in memory
+// until they are demoted, flushed by the background flusher enabled with
+// FlushEvery, or the store is closed. Dirty keys are lost if the process stops
+// without calling Close.
+//
+// Disk reads don't hold mu. Every write, delete and demotion of a key bumps its
+// generation, so that a read that raced with one of them reads the key again
+// instead of promoting a stale value.
+type TieredStore struct {
+	cold        *PersistentStore
+	hot         map[string]*tieredEntry
+	capacity    int
+	policy      evictionPolicy
+	stats       tierStats
+	flusher     *tierFlusher
+	generations [generationStripes]uint64
+	seed        maphash.Seed
+	mu          sync.Mutex
+}
+
+// tierFlusher is the state of the background flusher of a TieredStore.
+type tierFlusher struct {
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// tieredEntry is a value held in the memory tier.
+type tieredEntry struct {
+	value string
+	dirty bool
+}
+
+type tierStats struct {
+	hotHits       int64
+	coldHits      int64
+	misses        int64
+	promotions    int64
+	demotions     int64
+	flushes       int64
+	flushFailures int64
+}
+
+// NewTieredStore creates a TieredStore keeping at most hotCapacity keys in
+// memory, and the others under storeRootPath.
+func NewTieredStore(storeRootPath string, hotCapacity int) *TieredStore {
+	return &TieredStore{
+		cold:     NewPersistentStore(storeRootPath),
+		hot:      make(map[string]*tieredEntry),
+		capacity: max(hotCapacity, 1),
+		policy:   &lfuPolicy{heap: newKeyHeap()},
+		seed:     maphash.MakeSeed(),
+		mu:       sync.Mutex{},
+	}
+}
+
+// FlushEvery starts a background flusher writing the dirty keys to disk every
+// interval, which bounds the writes lost if the process crashes to the ones
+// made during the last interval. It must be called before t is used, and returns t.
+func (t *TieredStore) FlushEvery(interval time.Duration) *TieredStore {
+	t.flusher = &tierFlusher{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go t.flushLoop(interval)
+	return t
+}
+
+// flushLoop flushes the dirty keys every interval, until the flusher is stopped.
+func (t *TieredStore) flushLoop(interval time.Duration) {
+	defer close(t.flusher.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.flusher.stop:
+			return
+		case <-ticker.C:
+		}
+		// Keys that fail to flush stay dirty and are retried next time
+		t.Flush()
+	}
+}
+
+// stopFlusher stops the background flusher, if any, and waits for it to return.
+// The caller must not hold mu, which the flusher may be waiting for.
+func (t *TieredStore) stopFlusher() {
+	f := t.flusher
+	if f == nil {
+		return
+	}
+	f.stopOnce.Do(func() {
+		close(f.stop)
+	})
+	<-f.done
+}
+
+// generation returns the generation counter of key. It may only be used while holding mu.
+func (t *TieredStore) generation(key string) *uint64 {
+	return &t.generations[maphash.String(t.seed, key)%generationStripes]
+}
+
+// load returns the memory tier entry of key, promoting it from disk if needed,
+// or nil if the key doesn't exist. It releases mu while reading the disk, and
+// reads again if the key was written, deleted or demoted meanwhile, so the
+// entry it returns is current. The caller must hold mu.
+func (t *TieredStore) load(key string) (*tieredEntry, error) {
+	for {
+		if e, ok := t.hot[key]; ok {
+			t.stats.hotHits++
+			t.policy.touch(key)
+			return e, nil
+		}
+
+		gen := *t.generation(key)
+		t.mu.Unlock()
+		value, err := t.cold.Get(key)
+		t.mu.Lock()
+
+		if *t.generation(key) == gen {
+			return t.promote(key, value, err)
+		}
+	}
+}
+
+// promote adds the value of key read from disk to the memory tier, or returns
+// nil if the read found no key. The caller must hold mu.
+func (t *TieredStore) promote(key string, value string, err error) (*tieredEntry, error) {
+	// Another read may have promoted key while the disk was read
+	if e, ok := t.hot[key]; ok {
+		t.stats.hotHits++
+		t.policy.touch(key)
+		return e, nil
+	}
+
+	if errors.Is(err, ErrKeyNotFound) {
+		t.stats.misses++
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t.stats.coldHits++
+	t.stats.promotions++
+	e := &tieredEntry{value: value}
+	t.hot[key] = e
+	t.policy.track(key, time.Time{})
+	t.demote(key)
+	return e, nil
+}
+
+// set writes value to the memory tier. The caller must hold mu.
+func (t *TieredStore) set(key string, value string) {
+	*t.generation(key)++
+	if e, ok := t.hot[key]; ok {
+		e.value, e.dirty = value, true
+		t.policy.track(key, time.Time{})
+		return
+	}
+
+	t.hot[key] = &tieredEntry{value: value, dirty: true}
+	t.policy.track(key, time.Time{})
+	t.demote(key)
+}
+
+// demote moves the least frequently used keys other than exclude to disk until
+// the memory tier is within its capacity. A dirty key that fails to be written
+// to disk stays in memory, over capacity, and is counted in the stats: demotion
+// only follows another operation, which already succeeded. The caller must hold mu.
+func (t *TieredStore) demote(exclude string) {
+	for len(t.hot) > t.capacity {
+		key, ok := t.policy.victim(exclude)
+		if !ok {
+			return
+		}
+		if e := t.hot[key]; e.dirty {
+			if err := t.cold.Put(key, e.value); err != nil {
+				t.stats.flushFailures++
+				return
+			}
+			t.stats.flushes++
+		}
+		delete(t.hot, key)
+		t.policy.remove(key)
+		*t.generation(key)++
+		t.stats.demotions++
+	}
+}
+
+func (t *TieredStore) Put(key string, value string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.set(key, value)
+	return nil
+}
+
+func (t *TieredStore) Get(key string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, err := t.load(key)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", ErrKeyNotFound
+	}
+	return e.value, nil
+}
+
+func (t *TieredStore) Delete(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Delete from disk first, so that a failure keeps the value in memory
+	*t.generation(key)++
+	if err := t.cold.Delete(key); err != nil {
+		return err
+	}
+	delete(t.hot, key)
+	t.policy.remove(key)
+	return nil
+}
+
+// Entries returns the entries of both tiers, without promoting any of them.
+func (t *TieredStore) Entries() ([]Entry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries, err := t.cold.Entries()
+	if err != nil {
+		return []Entry{}, err
+	}
+
+	// The memory tier holds the latest value of the keys it has
+	n := 0
+	for _, e := range entries {
+		if _, ok := t.hot[e.Key]; !ok {
+			entries[n] = e
+			n++
+		}
+	}
+	entries = entries[:n]
+	for key, e := range t.hot {
+		entries = append(entries, Entry{Key: key, Value: e.value})
+	}
+	return entries, nil
+}
+
+func (t *TieredStore) Increment(key string, delta int64) (int64, error) {
+	var n int64
+	_, err := t.Update(key, func(value string, exists bool) (string, error) {
+		var err error
+		n, err = addInt(value, exists, delta)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(n, 10), nil
+	})
+	return n, err
+}
+
+func (t *TieredStore) Decrement(key string, delta int64) (int64, error) {
+	return decrement(t, key, delta)
+}
+
+func (t *TieredStore) Append(key string, suffix string) (int, error) {
+	value, err := t.Update(key, func(value string, _ bool) (string, error) {
+		return value + suffix, nil
+	})
+	return len(value), err
+}
+
+func (t *TieredStore) SetRange(key string, offset int64, data string) (int, error) {
+	if err := checkRange(offset, len(data)); err != nil {
+		return 0, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, err := t.load(key)
+	if err != nil {
+		return 0, err
+	}
+	if e == nil {
+		if data == "" {
+			return 0, nil
+		}
+		e = &tieredEntry{}
+	}
+
+	value := setRange(e.value, offset, data)
+	t.set(key, value)
+	return len(value), nil
+}
+
+func (t *TieredStore) Update(key string, fn UpdateFunc) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, err := t.load(key)
+	if err != nil {
+		return "", err
+	}
+
+	var value string
+	if e != nil {
+		value = e.value
+	}
+	value, err = fn(value, e != nil)
+	if err != nil {
+		return "", err
+	}
+
+	t.set(key, value)
+	return value, nil
+}
+
+// Stats returns the number of keys and bytes in the memory tier, the hits in
+// each tier, the writes to disk and the ones that failed, the misses, and the
+// number of keys moved between tiers.
+func (t *TieredStore) Stats() map[string]any {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var bytes, dirty int
+	for key, e := range t.hot {
+		bytes += len(key) + len(e.value)
+		if e.dirty {
+			dirty++
+		}
+	}
+
+	return map[string]any{
+		"hot": map[string]any{
+			"keys":     len(t.hot),
+			"dirty":    dirty,
+			"bytes":    bytes,
+			"capacity": t.capacity,
+			"hits":     t.stats.hotHits,
+		},
+		"cold": map[string]any{
+			"hits":           t.stats.coldHits,
+			"writes":         t.stats.flushes,
+			"write_failures": t.stats.flushFailures,
+		},
+		"misses":     t.stats.misses,
+		"promotions": t.stats.promotions,
+		"demotions":  t.stats.demotions,
+	}
+}
+
+// Flush writes the dirty keys of the memory tier to disk, keeping them in memory.
+func (t *TieredStore) Flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, e := range t.hot {
+		if !e.dirty {
+			continue
+		}
+		if err := t.cold.Put(key, e.value); err != nil {
+			t.stats.flushFailures++
+			return err
+		}
+		e.dirty = false
+		t.stats.flushes++
+	}
+	return nil
+}
+
+// Close stops the background flusher and flushes the memory tier to disk, so
+// that no write is lost on shutdown.
+func (t *TieredStore) Close() error {
+	t.stopFlusher()
+	return t.Flush()
+}
+
+// Drop stops the background flusher and removes the keys of both tiers.
+func (t *TieredStore) Drop() error {
+	t.stopFlusher()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	clear(t.hot)
+	t.policy = &lfuPolicy{heap: newKeyHeap()}
+	for i := range t.generations {
+		t.generations[i]++
+	}
+	return t.cold.Drop()
+}
@@ -0,0 +1,339 @@
+package kv_store
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// onDisk returns the value of key in the disk tier of store, bypassing the memory tier.
+func onDisk(t *testing.T, store *TieredStore, key string) (string, bool) {
+	t.Helper()
+	value, err := store.cold.Get(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return "", false
+	}
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return value, true
+}
+
+func TestTieredStore(t *testing.T) {
+	t.Run("writes stay in memory", func(t *testing.T) {
+		store := NewTieredStore(t.TempDir(), 2)
+
+		store.Put("key", "value")
+		if value, err := store.Get("key"); err != nil || value != "value" {
+			t.Fatalf("Expected 'value', got '%s', %v", value, err)
+		}
+		if _, ok := onDisk(t, store, "key"); ok {
+			t.Fatal("Expected key not to be written to disk")
+		}
+	})
+
+	t.Run("least frequently used keys are demoted", func(t *testing.T) {
+		store := NewTieredStore(t.TempDir(), 2)
+
+		store.Put("hot", "1")
+		store.Put("cold", "2")
+		store.Get("hot")
+		store.Get("hot")
+		store.Put("new", "3")
+
+		if value, ok := onDisk(t, store, "cold"); !ok || value != "2" {
+			t.Fatalf("Expected cold key to be demoted with value '2', got '%s', %v", value, ok)
+		}
+		if _, ok := onDisk(t, store, "hot"); ok {
+			t.Fatal("Expected hot key to stay in memory")
+		}
+		if _, ok := store.hot["cold"]; ok {
+			t.Fatal("Expected cold key to be removed from memory")
+		}
+	})
+
+	t.Run("keys that are no longer used are demoted", func(t *testing.T) {
+		store := NewTieredStore(t.TempDir(), 2)
+
+		store.Put("a", "1")
+		store.Put("b", "2")
+		for i := 0; i < 100; i++ {
+			store.Get("a")
+			store.Get("b")
+		}
+		store.Put("c", "3")
+		store.Put("d", "4")
+
+		// Once the access counts of a and b have decayed, c and d stay in memory
+		for i := 0; i < 100; i++ {
+			store.Get("c")
+			store.Get("d")
+		}
+		for _, key := range []string{"a", "b"} {
+			if _, ok := store.hot[key]; ok {
+				t.Fatalf("Expected %s to be demoted", key)
+			}
+		}
+		for _, key := range []string{"c", "d"} {
+			if _, ok := store.hot[key]; !ok {
+				t.Fatalf("Expected %s to be in memory", key)
+			}
+		}
+	})
+
+	t.Run("reads promote demoted keys", func(t *testing.T) {
+		store := NewTieredStore(t.TempDir(), 1)
+
+		store.Put("a", "1")
+		store.Put("b", "2")
+		if _, ok := store.hot["a"]; ok {
+			t.Fatal("Expected a to be demoted")
+		}
+
+		if value, err := store.Get("a"); err != nil || value != "1" {
+			t.Fatalf("Expected '1', got '%s', %v", value, err)
+		}
+		if _, ok := store.hot["a"]; !ok {
+			t.Fatal("Expected a to be promoted")
+		}
+		if value, ok := onDisk(t, store, "b"); !ok || value != "2" {
+			t.Fatalf("Expected b to be demoted with value '2', got '%s', %v", value, ok)
+		}
+	})
+
+	t.Run("clean keys are demoted without writing", func(t *testing.T) {
+		store := NewTieredStore(t.TempDir(), 1)
+
+		store.Put("a", "1")
+		store.Put("b", "2")
+		store.Get("a")
+		store.Get("b")
+
+		stats := store.Stats()
+		if writes := stats["cold"].(map[string]any)["writes"]; writes != int64(2) {
+			t.Fatalf("Expected 2 writes to disk, got %v", writes)
+		}
+		if demotions := stats["demotions"]; demotions != int64(3) {
+			t.Fatalf("Expected 3 demotions, got %v", demotions)
+		}
+	})
+
+	t.Run("delete removes both tiers", func(t *testing.T) {
+		store := NewTieredStore(t.TempDir(), 1)
+
+		store.Put("a", "1")
+		store.Put("b", "2")
+		store.Delete("a")
+		store.Delete("b")
+
+		for _, key := range []string{"a", "b"} {
+			if _, err := store.Get(key); !errors.Is(err, ErrKeyNotFound) {
+				t.Fatalf("Expected ErrKeyNotFound for %s, got %v", key, err)
+			}
+		}
+	})
+
+	t.Run("failed demotions don't fail reads and writes", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewTieredStore(root, 1)
+
+		// A directory in place of b makes writing b to disk fail
+		os.Mkdir(root+"/b", fileMode)
+		store.Put("a", "1")
+		if err := store.Put("b", "2"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		// Promoting a demotes b, which fails
+		if value, err := store.Get("a"); err != nil || value != "1" {
+			t.Fatalf("Expected '1', got '%s', %v", value, err)
+		}
+		if value, err := store.Get("b"); err != nil || value != "2" {
+			t.Fatalf("Expected b to stay in memory with '2', got '%s', %v", value, err)
+		}
+		if failures := store.Stats()["cold"].(map[string]any)["write_failures"]; failures != int64(1) {
+			t.Fatalf("Expected 1 failed write to disk, got %v", failures)
+		}
+	})
+
+	t.Run("failed deletes keep the value", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewTieredStore(root, 10)
+
+		// A non-empty directory in place of a makes deleting a from disk fail
+		os.MkdirAll(root+"/a/child", fileMode)
+		store.Put("a", "1")
+
+		if err := store.Delete("a"); err == nil {
+			t.Fatal("Expected the delete to fail")
+		}
+		if value, err := store.Get("a"); err != nil || value != "1" {
+			t.Fatalf("Expected '1', got '%s', %v", value, err)
+		}
+	})
+
+	t.Run("entries merge both tiers", func(t *testing.T) {
+		store := NewTieredStore(t.TempDir(), 1)
+
+		store.Put("a", "1")
+		store.Put("b", "2")
+		store.Flush()
+		store.Put("b", "3")
+
+		entries, err := store.Entries()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		values := make(map[string]string)
+		for _, e := range entries {
+			values[e.Key] = e.Value
+		}
+		if len(entries) != 2 || values["a"] != "1" || values["b"] != "3" {
+			t.Fatalf("Expected a=1 and b=3, got %v", entries)
+		}
+	})
+
+	t.Run("read-modify-write operations", func(t *testing.T) {
+		store := NewTieredStore(t.TempDir(), 1)
+
+		store.Put("n", "1")
+		store.Put("other", "x")
+		if n, err := store.Increment("n", 2); err != nil || n != 3 {
+			t.Fatalf("Expected 3, got %d, %v", n, err)
+		}
+		if n, err := store.Decrement("n", 1); err != nil || n != 2 {
+			t.Fatalf("Expected 2, got %d, %v", n, err)
+		}
+		if n, err := store.Append("other", "yz"); err != nil || n != 3 {
+			t.Fatalf("Expected 3, got %d, %v", n, err)
+		}
+		if n, err := store.SetRange("other", 1, "Y"); err != nil || n != 3 {
+			t.Fatalf("Expected 3, got %d, %v", n, err)
+		}
+		if n, err := store.SetRange("missing", 0, ""); err != nil || n != 0 {
+			t.Fatalf("Expected 0, got %d, %v", n, err)
+		}
+		if value, _ := store.Get("other"); value != "xYz" {
+			t.Fatalf("Expected 'xYz', got '%s'", value)
+		}
+		if value, _ := store.Get("n"); value != "2" {
+			t.Fatalf("Expected '2', got '%s'", value)
+		}
+	})
+
+	t.Run("close flushes dirty keys", func(t *testing.T) {
+		root := t.TempDir()
+		store := NewTieredStore(root, 10)
+
+		store.Put("a", "1")
+		store.Put("b", "2")
+		if err := store.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		reopened := NewTieredStore(root, 10)
+		for key, want := range map[string]string{"a": "1", "b": "2"} {
+			if value, err := reopened.Get(key); err != nil || value != want {
+				t.Fatalf("Expected '%s', got '%s', %v", want, value, err)
+			}
+		}
+	})
+
+	t.Run("the flusher writes dirty keys periodically", func(t *testing.T) {
+		store := NewTieredStore(t.TempDir(), 10).FlushEvery(10 * time.Millisecond)
+		defer store.Close()
+
+		store.Put("key", "value")
+		deadline := time.Now().Add(time.Second)
+		for {
+			if value, ok := onDisk(t, store, "key"); ok {
+				if value != "value" {
+					t.Fatalf("Expected 'value', got '%s'", value)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Expected key to be flushed to disk")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		store := NewTieredStore(t.TempDir(), 1)
+
+		store.Put("a", "1")
+		store.Put("b", "2")
+		store.Get("b")
+		store.Get("a")
+		store.Get("missing")
+
+		stats := store.Stats()
+		hot := stats["hot"].(map[string]any)
+		if hot["keys"] != 1 || hot["hits"] != int64(1) || hot["capacity"] != 1 {
+			t.Fatalf("Expected 1 key, 1 hit and capacity 1 in memory, got %v", hot)
+		}
+		if hits := stats["cold"].(map[string]any)["hits"]; hits != int64(1) {
+			t.Fatalf("Expected 1 hit on disk, got %v", hits)
+		}
+		if stats["misses"] != int64(1) || stats["promotions"] != int64(1) {
+			t.Fatalf("Expected 1 miss and 1 promotion, got %v", stats)
+		}
+	})
+}
+
+func TestTieredStoreConcurrency(t *testing.T) {
+	store := NewTieredStore(t.TempDir(), 4)
+
+	const goroutines = 8
+	const iterations = 100
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				store.Increment("counter", 1)
+				store.Put("key"+strconv.Itoa((g+i)%10), "value")
+				store.Get("key" + strconv.Itoa(i%10))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if value, _ := store.Get("counter"); value != strconv.Itoa(goroutines*iterations) {
+		t.Fatalf("Expected '%d', got '%s'", goroutines*iterations, value)
+	}
+}
+
+func TestTieredStoreConcurrentPromotion(t *testing.T) {
+	// Keys are demoted and promoted while being read and written, so reads of
+	// the disk race with writes of the same keys
+	store := NewTieredStore(t.TempDir(), 2).FlushEvery(time.Millisecond)
+	defer store.Close()
+
+	const goroutines = 4
+	const iterations = 200
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			key := "key" + strconv.Itoa(g)
+			for i := 0; i < iterations; i++ {
+				store.Put(key, strconv.Itoa(i))
+				store.Get("key" + strconv.Itoa((g+1)%goroutines))
+				if value, err := store.Get(key); err != nil || value != strconv.Itoa(i) {
+					t.Errorf("Expected '%d', got '%s', %v", i, value, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,39 @@
+package kv_store
+
+import "strings"
+
+// maxValueLength bounds the length of values produced by range writes, so that
+// a large offset cannot make the store allocate an arbitrary amount of memory.
+const maxValueLength = 512 << 20
+
+// checkRange validates a range write of length bytes at offset.
+func checkRange(offset int64, length int) error {
+	if offset < 0 || offset+int64(length) > maxValueLength {
+		return ErrInvalidOffset
+	}
+	return nil
+}
+
+// setRange overwrites value with data starting at offset, padding the value
+// with zero bytes if offset is past its end.
+func setRange(value string, offset int64, data string) string {
+	if data == "" {
+		return value
+	}
+
+	var b strings.Builder
+	end := int(offset) + len(data)
+	b.Grow(max(len(value), end))
+
+	if int(offset) <= len(value) {
+		b.WriteString(value[:offset])
+	} else {
+		b.WriteString(value)
+		b.WriteString(strings.Repeat("\x00", int(offset)-len(value)))
+	}
+	b.WriteString(data)
+	if end < len(value) {
+		b.WriteString(value[end:])
+	}
+	return b.String()
+}
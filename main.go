@@ -1,36 +1,241 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 
 	"github.com/bonearadu/kvstore/api"
+	"github.com/bonearadu/kvstore/cache"
 	"github.com/bonearadu/kvstore/config"
 	"github.com/bonearadu/kvstore/kv_store"
 	"github.com/bonearadu/kvstore/server"
 )
 
+// indexesSuffix is appended to the root of a persistent store to name the file
+// holding the paths of its indexes, next to the root rather than in it
+const indexesSuffix = ".indexes"
+
+// newStore creates a store of the configured kind, keeping persistent data under root
+func newStore(cfg *config.ServerConfig, root string) (kv_store.KeyValueStore, error) {
+	if cfg.KeyFilterFPRate >= 1 {
+		return nil, fmt.Errorf("key filter false positive rate %v is not below 1", cfg.KeyFilterFPRate)
+	}
+
+	var store kv_store.KeyValueStore
+	switch cfg.Mode {
+	case config.InMemory:
+		var err error
+		policy := kv_store.EvictionPolicy(cfg.EvictionPolicy)
+		switch {
+		case cfg.Shards > 1 && cfg.MaxMemory > 0:
+			store, err = kv_store.NewBoundedShardedInMemoryStore(cfg.Shards, cfg.MaxMemory, policy)
+		case cfg.Shards > 1:
+			store, err = kv_store.NewShardedInMemoryStore(cfg.Shards)
+		case cfg.MaxMemory > 0:
+			store, err = kv_store.NewBoundedInMemoryStore(cfg.MaxMemory, policy)
+		default:
+			store = kv_store.NewInMemoryStore()
+		}
+		if err != nil {
+			return nil, err
+		}
+	case config.Persistent:
+		persistent := kv_store.NewPersistentStore(root)
+		if cfg.KeyFilterFPRate > 0 {
+			if err := persistent.FilterKeys(cfg.KeyFilterFPRate); err != nil {
+				return nil, err
+			}
+		}
+		store = persistent
+	case config.PersistentCached:
+		c, err := newCache(cfg)
+		if err != nil {
+			return nil, err
+		}
+		var cached *kv_store.PersistentCachedStore
+		if cfg.WriteBackInterval > 0 {
+			cached = kv_store.NewWriteBackCachedStore(root, c, kv_store.WriteBack{
+				Interval:  cfg.WriteBackInterval,
+				BatchSize: cfg.WriteBackBatch,
+			})
+		} else {
+			cached = kv_store.NewPersistentCachedStoreWithCache(root, c)
+		}
+		if cfg.CacheMissTTL > 0 {
+			cached.CacheMisses(cfg.CacheCapacity, cfg.CacheMissTTL)
+		}
+		if cfg.KeyFilterFPRate > 0 {
+			if err := cached.FilterKeys(cfg.KeyFilterFPRate); err != nil {
+				return nil, err
+			}
+		}
+		if cfg.CacheWarm {
+			cached.WarmCache(cfg.CacheWarmTimeout, cfg.CacheWarmSave)
+		}
+		store = cached
+	case config.Tiered:
+		tiered := kv_store.NewTieredStore(root, cfg.HotCapacity)
+		if cfg.TieredFlush > 0 {
+			tiered.FlushEvery(cfg.TieredFlush)
+		}
+		store = tiered
+	default:
+		log.Panicf("Unknown map store implementation specified: %d", cfg.Mode)
+	}
+
+	if cfg.Indexing {
+		indexedStore := kv_store.NewIndexedStore(store)
+		// Indexes created through the API are saved next to the root of persistent stores
+		if cfg.Mode != config.InMemory {
+			if err := indexedStore.PersistIndexes(filepath.Clean(root) + indexesSuffix); err != nil {
+				return nil, err
+			}
+		}
+		for name, path := range cfg.Indexes {
+			if _, err := indexedStore.CreateIndex(name, path); err != nil {
+				return nil, fmt.Errorf("index %s: %w", name, err)
+			}
+		}
+		store = indexedStore
+	}
+
+	limits := limitsOf(cfg)
+	if limits != (kv_store.Limits{}) {
+		var err error
+		store, err = kv_store.NewQuotaStore(store, limits)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.MVCCRetention >= 0 || cfg.HistoryVersions > 0 {
+		return kv_store.NewMVCCStore(store, max(cfg.MVCCRetention, 0), cfg.HistoryVersions)
+	}
+	return store, nil
+}
+
+// newCache creates the cache of a persistent cached store, as set in the configuration
+func newCache(cfg *config.ServerConfig) (cache.Cache[string, string], error) {
+	policy := cache.Policy(cfg.CachePolicy)
+	weights := cache.Weights[string, string]{MaxWeight: cfg.CacheMaxBytes, MaxEntryWeight: cfg.CacheMaxEntryBytes}
+
+	if cfg.CacheShards > 1 {
+		if policy != cache.PolicyLRU {
+			return nil, fmt.Errorf("cache policy %q doesn't support sharding", policy)
+		}
+		if cfg.CacheMaxBytes > 0 {
+			return cache.NewWeightedShardedCache(cfg.CacheShards, weights)
+		}
+		return cache.NewShardedCache[string, string](cfg.CacheShards, cfg.CacheCapacity)
+	}
+
+	if cfg.CacheMaxBytes > 0 {
+		return cache.NewWeighted(policy, weights)
+	}
+	return cache.New[string, string](policy, cfg.CacheCapacity)
+}
+
+// limitsOf returns the store limits set in the configuration
+func limitsOf(cfg *config.ServerConfig) kv_store.Limits {
+	return kv_store.Limits{
+		MaxKeyLength:  cfg.MaxKeyLength,
+		MaxValueSize:  cfg.MaxValueSize,
+		MaxKeys:       cfg.MaxKeys,
+		MaxTotalBytes: cfg.MaxTotalBytes,
+	}
+}
+
 func main() {
 	// Parse configuration
 	cfg := config.ParseFlags()
 
+	// Evicted keys would bypass the wrappers tracking the store's contents
+	if cfg.MaxMemory > 0 && (cfg.Mode != config.InMemory || cfg.Indexing || limitsOf(cfg) != (kv_store.Limits{}) ||
+		cfg.MVCCRetention >= 0 || cfg.HistoryVersions > 0) {
+		log.Fatalf("-max_memory is only supported by the in-memory store, without indexing, limits or versioning")
+	}
+
 	// Initialize components
-	var store kv_store.KeyValueStore
 	switch cfg.Mode {
 	case config.InMemory:
-		store = kv_store.NewInMemoryStore()
-		log.Printf("Using in-memory KV store")
+		log.Printf("Using in-memory KV store. Shards: %d", max(cfg.Shards, 1))
+		if cfg.MaxMemory > 0 {
+			log.Printf("Memory budget: %d bytes. Eviction policy: %s", cfg.MaxMemory, cfg.EvictionPolicy)
+		}
 	case config.Persistent:
-		store = kv_store.NewPersistentStore(cfg.StorePath)
 		log.Printf("Using persistent KV store. Store root path: %s", cfg.StorePath)
 	case config.PersistentCached:
-		store = kv_store.NewPersistentCachedStore(cfg.StorePath, cfg.CacheCapacity)
-		log.Printf("Using persistent KV store with caching. Store root path: %s. Cache size: %d",
-			cfg.StorePath, cfg.CacheCapacity)
-	default:
-		log.Panicf("Unknown map store implementation specified: %d", cfg.Mode)
+		log.Printf("Using persistent KV store with caching. Store root path: %s. Cache size: %d. Cache policy: %s",
+			cfg.StorePath, cfg.CacheCapacity, cfg.CachePolicy)
+		if cfg.CacheMaxBytes > 0 {
+			log.Printf("Cache bounded by size: %d bytes", cfg.CacheMaxBytes)
+		}
+		if cfg.CacheShards > 1 {
+			log.Printf("Cache shards: %d", cfg.CacheShards)
+		}
+		if cfg.CacheMissTTL > 0 {
+			log.Printf("Caching missing keys for %v", cfg.CacheMissTTL)
+		}
+		if cfg.CacheWarm {
+			log.Printf("Warming the cache from the saved keys. Timeout: %v. Save interval: %v",
+				cfg.CacheWarmTimeout, cfg.CacheWarmSave)
+		}
+		if cfg.WriteBackInterval > 0 {
+			log.Printf("Using write-back caching. Flush interval: %v. Batch size: %d",
+				cfg.WriteBackInterval, cfg.WriteBackBatch)
+		}
+	case config.Tiered:
+		log.Printf("Using tiered KV store. Store root path: %s. Keys in memory: %d", cfg.StorePath, cfg.HotCapacity)
+		if cfg.TieredFlush > 0 {
+			log.Printf("Flushing tiered writes to disk every %v", cfg.TieredFlush)
+		}
+	}
+	if cfg.KeyFilterFPRate > 0 && (cfg.Mode == config.Persistent || cfg.Mode == config.PersistentCached) {
+		log.Printf("Filtering keys on disk. False positive rate: %v", cfg.KeyFilterFPRate)
+	}
+	if cfg.MVCCRetention >= 0 || cfg.HistoryVersions > 0 {
+		log.Printf("Using multi-version concurrency control. Retained revisions: %d. Versions kept per key: %d",
+			max(cfg.MVCCRetention, 0), cfg.HistoryVersions)
+	}
+
+	for name, path := range cfg.Indexes {
+		log.Printf("Indexing %s on %s", name, path)
+	}
+	if limits := limitsOf(cfg); limits != (kv_store.Limits{}) {
+		log.Printf("Enforcing limits. Max key length: %d. Max value size: %d. Max keys: %d. Max total bytes: %d",
+			limits.MaxKeyLength, limits.MaxValueSize, limits.MaxKeys, limits.MaxTotalBytes)
+	}
+
+	store, err := newStore(cfg, cfg.StorePath)
+	if err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
 	}
 
-	handler := api.NewHandler(store)
+	// Each bucket other than the default one gets its own store
+	buckets := kv_store.NewBuckets(store, func(bucket string) (kv_store.KeyValueStore, error) {
+		return newStore(cfg, filepath.Join(cfg.BucketsPath, bucket))
+	})
+
+	// Reopen the buckets left by a previous run of a persistent store
+	if cfg.Mode != config.InMemory {
+		dirs, err := os.ReadDir(cfg.BucketsPath)
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatalf("Failed to read buckets path: %v", err)
+		}
+		for _, dir := range dirs {
+			if !dir.IsDir() {
+				continue
+			}
+			if _, err := buckets.Create(dir.Name()); err != nil {
+				log.Fatalf("Failed to open bucket %s: %v", dir.Name(), err)
+			}
+		}
+		log.Printf("Buckets root path: %s. Opened %d bucket(s)", cfg.BucketsPath, len(buckets.Names())-1)
+	}
+
+	handler := api.NewBucketHandler(buckets, api.WithMaxBodySize(cfg.MaxValueSize))
 	srv := server.New(cfg, handler)
 
 	// Start server
@@ -41,4 +246,9 @@ func main() {
 
 	// Perform graceful shutdown
 	server.GracefulShutdown(srv)
+
+	// Flush the writes held in memory by the stores
+	if err := buckets.Close(); err != nil {
+		log.Fatalf("Failed to close store: %v", err)
+	}
 }